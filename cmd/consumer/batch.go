@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+// consumeBatch trata uma entrega em lote: cada evento passa sozinho pela
+// validação, deduplicação e dispatcher, e a entrega só é confirmada quando
+// todos forem aplicados; se algum falhar, c.batchPolicy decide. Usuário e
+// tipo vêm de cada evento; o tenant e as demais dimensões routing.* vêm da
+// chave de roteamento, quando ela segue o padrão, e o tenant também do
+// header.
+func (c *consumer) consumeBatch(ctx context.Context, msg broker.Delivery) {
+	entries, err := c.payloadRules.DecodeBatch(msg.Message)
+	if err != nil {
+		c.rejectPayload(ctx, msg, domain.AsValidationError(err))
+		return
+	}
+
+	key_fields, _ := c.dispatcher.ParseRoutingKeyFields(msg.RoutingKey)
+	tenant := c.messageTenant(msg, key_fields)
+	if err := routing.ValidTenant(tenant); err != nil {
+		logger.Error("Lote %s descartado: %v", msg.MessageID, err)
+		msg.Nack(false)
+		return
+	}
+	counter := c.tenants.Counter(tenant)
+
+	logger.Process("Processando lote %s com %d eventos, Tenant=%s", msg.MessageID, len(entries), tenant)
+	settlement := domain.NewBatchSettlement(len(entries), func(result domain.BatchResult) {
+		c.settleBatch(msg, result)
+	})
+
+	for i, entry := range entries {
+		if entry.Err != nil {
+			verr := domain.AsValidationError(entry.Err)
+			c.rejections.Add(verr.Reason)
+			logger.Error("Evento %d do lote %s rejeitado: %v", i, msg.MessageID, verr)
+			settlement.Failed(false)
+			continue
+		}
+
+		event := entry.Event
+		event_type := strings.ToLower(event.EventType)
+		filtered := domain.EventMessage{UserID: event.UserID, EventType: event_type, Tenant: tenant, Attributes: key_fields.Attributes}
+		if allowed, rule := c.filter.Allow(filtered, msg.Headers, event.Attributes); !allowed {
+			logger.Info("Evento %s do lote %s ignorado pelo filtro: %s", event.ID, msg.MessageID, rule)
+			settlement.Applied()
+			continue
+		}
+
+		if counter.IsProcessed(event.ID) {
+			logger.Warning("Evento %s já processado, ignorando", event.ID)
+			settlement.Applied()
+			continue
+		}
+
+		logger.Process("Processando evento: ID=%s, Tenant=%s, UserID=%s, Type=%s", event.ID, tenant, event.UserID, event.EventType)
+		counter.MarkProcessed(event.ID)
+
+		event_msg := domain.EventMessage{
+			UserID:     event.UserID,
+			EventType:  event_type,
+			MessageID:  event.ID,
+			Tenant:     tenant,
+			Attributes: key_fields.Attributes,
+			Value:      event.Value,
+			OnApplied:  settlement.Applied,
+			OnDropped: func() {
+				counter.UnmarkProcessed(event.ID)
+				settlement.Failed(false)
+			},
+		}
+		event_msg.Group = c.groupBy.Values(event_msg, msg.Headers, event.Attributes)
+		if err := c.dispatcher.Dispatch(ctx, event_msg); err != nil {
+			counter.UnmarkProcessed(event.ID)
+			if errors.Is(err, domain.ErrDispatcherFull) {
+				logger.Warning("Dispatcher cheio, evento %s do lote %s não aplicado", event.ID, msg.MessageID)
+			} else {
+				logger.Error("Falha ao despachar evento %s: %v", event.ID, err)
+			}
+			settlement.Failed(true)
+		}
+	}
+}
+
+// settleBatch confirma ou rejeita a entrega conforme c.batchPolicy depois
+// que todos os eventos do lote terminaram.
+func (c *consumer) settleBatch(msg broker.Delivery, result domain.BatchResult) {
+	if result.Failed > 0 {
+		logger.Warning("Lote %s com falhas (%s), política %s", msg.MessageID, result, c.batchPolicy)
+	}
+
+	switch c.batchPolicy.Action(result) {
+	case domain.BatchActionAck:
+		msg.Ack()
+	case domain.BatchActionRequeue:
+		msg.Nack(true)
+	default:
+		msg.Nack(false)
+	}
+}
@@ -1,40 +1,591 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
 	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	RabbitMQConnString string
-	QueueName          string
+	InstanceID        string
+	Source            string
+	SourceOffset      int64
+	IdleTimeout       time.Duration
+	Workers           int
+	ResultsDir        string
+	FlushInterval     time.Duration
+	LogLevel          string
+	RoutingKeyPattern string
+	Lifecycle         bool
+	AMQP              AMQPConfig
+	Kafka             KafkaConfig
+	Tenant            TenantConfig
+	Dispatcher        DispatcherConfig
+	Validation        ValidationConfig
+	Batch             BatchConfig
+	Aggregations      AggregationsConfig
+	GroupBy           GroupByConfig
+	Filter            FilterConfig
+
+	// File é o arquivo de configuração lido, se houver; PrintConfig pede
+	// que a configuração efetiva seja impressa em vez de executar.
+	File        string
+	PrintConfig bool
+}
+
+type AMQPConfig struct {
+	URL      string
+	User     string
+	Password string
+	Host     string
+	Port     int
+	VHost    string
+	Queue    string
+	Exchange string
+	Bindings []string
+	Prefetch int
+	Auth     string
+	TLS      TLSConfig
+
+	ExchangeType         string
+	QueueType            string
+	MaxLength            int
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	DeadLetterQueue      string
+	QuarantineQueue      string
+	QueueArgs            []string
+	Passive              bool
+}
+
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	Group   string
+}
+
+type TenantConfig struct {
+	Header   string
+	MaxUsers int
+}
+
+type ValidationConfig struct {
+	Required            []string
+	IDFormat            string
+	MaxSize             int
+	MaxDecompressedSize int
+	AllowUnknown        bool
+}
+
+// PayloadRules converte a configuração nas regras de validação do domínio.
+func (v ValidationConfig) PayloadRules() domain.PayloadRules {
+	return domain.PayloadRules{
+		Required:            v.Required,
+		IDFormat:            v.IDFormat,
+		MaxSize:             v.MaxSize,
+		MaxDecompressedSize: v.MaxDecompressedSize,
+		AllowUnknown:        v.AllowUnknown,
+	}
+}
+
+// GroupByConfig define as dimensões que, com o tipo de evento, formam a
+// chave das contagens; sem Dimensions vale o Preset.
+type GroupByConfig struct {
+	Preset     string
+	Dimensions []string
+}
+
+func (g GroupByConfig) GroupBy() (domain.GroupBy, error) {
+	return domain.ParseGroupBy(g.Preset, g.Dimensions)
+}
+
+// FilterConfig lista as regras que incluem ou excluem eventos antes da
+// contagem, na forma <include|exclude> <campo> <operador> <valor>.
+type FilterConfig struct {
+	Rules []string
+}
+
+func (f FilterConfig) Filter() (*domain.Filter, error) {
+	return domain.ParseFilter(f.Rules)
+}
+
+// AggregationsConfig lista as funções de agregação dos valores de cada tipo
+// de evento (count, sum, min, max, mean e percentis como p95).
+type AggregationsConfig struct {
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+func (a AggregationsConfig) Aggregations() domain.Aggregations {
+	return domain.Aggregations{
+		"created": a.Created,
+		"updated": a.Updated,
+		"deleted": a.Deleted,
+	}
+}
+
+// BatchConfig trata das entregas em lote (envelope com vários eventos).
+type BatchConfig struct {
+	FailurePolicy string
+}
+
+type DispatcherConfig struct {
+	Lanes    int
+	Capacity int
+	Overflow string
+	SpillDir string
+}
+
+func Default() *Config {
+	return &Config{
+		InstanceID:        defaultInstanceID(),
+		Source:            "amqp",
+		SourceOffset:      -1,
+		IdleTimeout:       5 * time.Second,
+		Workers:           1,
+		ResultsDir:        "results",
+		LogLevel:          "info",
+		RoutingKeyPattern: routing.DefaultPattern,
+		AMQP: AMQPConfig{
+			User:     "guest",
+			Password: "guest",
+			Host:     "localhost",
+			Port:     5672,
+			Queue:    "eventcountertest",
+			Exchange: "",
+			Bindings: []string{"*.event.*"},
+			Prefetch: 1,
+			Auth:     "plain",
+
+			ExchangeType: "topic",
+		},
+		Kafka: KafkaConfig{
+			Brokers: []string{"localhost:9092"},
+			Topic:   "user-events",
+			Group:   "eventcounter",
+		},
+		Tenant: TenantConfig{
+			Header: "x-tenant",
+		},
+		Validation: ValidationConfig{
+			Required:            []string{"id"},
+			IDFormat:            domain.IDFormatAny,
+			MaxSize:             64 * 1024,
+			MaxDecompressedSize: 1024 * 1024,
+		},
+		Dispatcher: DispatcherConfig{
+			Capacity: 100,
+			Overflow: string(domain.OverflowBlock),
+		},
+		Batch: BatchConfig{
+			FailurePolicy: string(domain.BatchRequeue),
+		},
+		GroupBy: GroupByConfig{
+			Preset: domain.DefaultGroupByPreset,
+		},
+	}
+}
+
+// Load monta a configuração com precedência crescente: valores padrão,
+// .env, arquivo (-config ou CONFIG_FILE), variáveis de ambiente e flags. O
+// .env não é copiado para o ambiente, então fica abaixo do arquivo e é lido
+// de novo a cada recarga. Todos os erros de leitura e validação são
+// devolvidos juntos; a configuração parcial é devolvida mesmo com erro
+// para que -print-config funcione.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("consumer", flag.ContinueOnError)
+	flag_values := make(map[string]string)
+	defaults := Default()
+	for _, f := range fields {
+		_, is_bool := f.value(defaults).(*boolValue)
+		flags.Var(&rawFlag{name: f.flag, values: flag_values, def: f.value(defaults).String(), isBool: is_bool}, f.flag, f.usage)
+	}
+	config_file := flags.String("config", "", "Arquivo de configuração YAML ou TOML")
+	print_config := flags.Bool("print-config", false, "Imprime a configuração efetiva (com segredos ocultos) e sai")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	dotenv, err := godotenv.Read()
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if !*print_config {
+			logger.Warning("Arquivo .env não encontrado, lendo variáveis de ambiente")
+		}
+	case err != nil:
+		errs = append(errs, fmt.Errorf("arquivo .env: %w", err))
+	}
+
+	cfg := Default()
+	cfg.PrintConfig = *print_config
+
+	for _, f := range fields {
+		if value, ok := dotenv[f.env]; ok {
+			if err := f.value(cfg).Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("variável %s no .env: %w", f.env, err))
+			}
+		}
+	}
+
+	cfg.File = *config_file
+	if cfg.File == "" {
+		cfg.File = os.Getenv("CONFIG_FILE")
+	}
+	if cfg.File == "" {
+		cfg.File = dotenv["CONFIG_FILE"]
+	}
+	if cfg.File != "" {
+		errs = append(errs, cfg.loadFile(cfg.File)...)
+	}
+
+	for _, f := range fields {
+		if value, ok := os.LookupEnv(f.env); ok {
+			if err := f.value(cfg).Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("variável %s: %w", f.env, err))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := flag_values[f.flag]; ok {
+			if err := f.value(cfg).Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("flag -%s: %w", f.flag, err))
+			}
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	return cfg, errors.Join(errs...)
+}
+
+// ResumesCounts diz se a instância retoma, ao iniciar, as contagens do
+// próprio snapshot. Um replay iniciado explicitamente na linha 0, ou a
+// entrada padrão sem -source-offset, recomeça do zero para não contar as
+// mesmas linhas duas vezes.
+func (c *Config) ResumesCounts() bool {
+	switch {
+	case strings.HasPrefix(c.Source, "file:"):
+		return c.SourceOffset != 0
+	case c.Source == "stdin":
+		return c.SourceOffset > 0
+	}
+	return true
+}
+
+func (c *Config) Validate() error {
+	return errors.Join(c.validate()...)
+}
+
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.InstanceID == "" {
+		fail("instance_id não pode ser vazio")
+	}
+	if c.IdleTimeout <= 0 {
+		fail("idle_timeout deve ser positivo, obtido %s", c.IdleTimeout)
+	}
+	if c.Workers < 1 {
+		fail("workers deve ser pelo menos 1, obtido %d", c.Workers)
+	}
+	if c.ResultsDir == "" {
+		fail("results_dir não pode ser vazio")
+	}
+	if c.FlushInterval < 0 {
+		fail("flush_interval não pode ser negativo, obtido %s", c.FlushInterval)
+	}
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+		fail("log_level: %v", err)
+	}
+	if _, err := routing.NewSchema(c.RoutingKeyPattern); err != nil {
+		fail("routing_key_pattern: %v", err)
+	}
+	if c.Tenant.Header == "" {
+		fail("tenant.header não pode ser vazio")
+	}
+	if c.Tenant.MaxUsers < 0 {
+		fail("tenant.max_users não pode ser negativo, obtido %d", c.Tenant.MaxUsers)
+	}
+	for _, name := range c.Validation.Required {
+		if !domain.KnownPayloadField(name) {
+			fail("validation.required: campo desconhecido %q", name)
+		}
+	}
+	switch c.Validation.IDFormat {
+	case domain.IDFormatAny, domain.IDFormatUUID:
+	default:
+		fail("validation.id_format desconhecido: %q (use any ou uuid)", c.Validation.IDFormat)
+	}
+	if c.Validation.MaxSize < 0 {
+		fail("validation.max_size não pode ser negativo, obtido %d", c.Validation.MaxSize)
+	}
+	if c.Validation.MaxDecompressedSize < 0 {
+		fail("validation.max_decompressed_size não pode ser negativo, obtido %d", c.Validation.MaxDecompressedSize)
+	}
+	if c.Dispatcher.Lanes < 0 {
+		fail("dispatcher.lanes não pode ser negativo, obtido %d", c.Dispatcher.Lanes)
+	}
+	if c.Dispatcher.Capacity < 1 {
+		fail("dispatcher.capacity deve ser pelo menos 1, obtido %d", c.Dispatcher.Capacity)
+	}
+	if overflow, err := domain.ParseOverflowPolicy(c.Dispatcher.Overflow); err != nil {
+		fail("dispatcher.overflow: %v", err)
+	} else if c.Dispatcher.Lanes > 0 && (overflow == domain.OverflowDropOldest || overflow == domain.OverflowReject) {
+		// Descartar ou reenfileirar um evento de uma lane quebra a ordem do
+		// usuário que as lanes existem para garantir.
+		fail("dispatcher.overflow %s não preserva a ordem de dispatcher.lanes; use block ou spill-to-disk", overflow)
+	}
+	if _, err := domain.ParseBatchFailurePolicy(c.Batch.FailurePolicy); err != nil {
+		fail("batch.failure_policy: %v", err)
+	}
+	if _, err := c.GroupBy.GroupBy(); err != nil {
+		fail("group_by: %v", err)
+	}
+	if _, err := c.Filter.Filter(); err != nil {
+		fail("filter.rules: %v", err)
+	}
+	for event_type, names := range c.Aggregations.Aggregations() {
+		for _, name := range names {
+			if _, err := domain.ParseAggregation(name); err != nil {
+				fail("aggregations.%s: %v", event_type, err)
+			}
+		}
+	}
+
+	switch {
+	case c.Source == "amqp":
+		errs = append(errs, c.AMQP.validate()...)
+	case c.Source == "kafka":
+		if len(c.Kafka.Brokers) == 0 {
+			fail("kafka.brokers não pode ser vazio")
+		}
+		if c.Kafka.Topic == "" {
+			fail("kafka.topic não pode ser vazio")
+		}
+		if c.Kafka.Group == "" {
+			fail("kafka.group não pode ser vazio")
+		}
+	case c.Source == "stdin":
+	case strings.HasPrefix(c.Source, "file:"):
+		if strings.TrimPrefix(c.Source, "file:") == "" {
+			fail("source file: exige o caminho do arquivo")
+		}
+	default:
+		fail("source desconhecida: %q (use amqp, kafka, file:<caminho> ou stdin)", c.Source)
+	}
+
+	return errs
+}
+
+func (a AMQPConfig) validate() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if a.URL != "" {
+		u, err := url.Parse(a.URL)
+		if err != nil {
+			fail("amqp.url inválida: %v", err)
+		} else if u.Scheme != "amqp" && u.Scheme != "amqps" {
+			fail("amqp.url deve usar amqp:// ou amqps://, obtido %q", u.Scheme)
+		}
+	} else {
+		if a.Host == "" {
+			fail("amqp.host não pode ser vazio")
+		}
+		if a.Port < 1 || a.Port > 65535 {
+			fail("amqp.port fora do intervalo 1-65535: %d", a.Port)
+		}
+	}
+	if a.Queue == "" {
+		fail("amqp.queue não pode ser vazio")
+	}
+	if a.Exchange != "" && len(a.Bindings) == 0 {
+		fail("amqp.bindings não pode ser vazio quando amqp.exchange é definido")
+	}
+	switch a.ExchangeType {
+	case "topic", "direct", "fanout", "headers":
+	default:
+		fail("amqp.exchange_type desconhecido: %q", a.ExchangeType)
+	}
+	switch a.QueueType {
+	case "", "classic", "quorum":
+	default:
+		fail("amqp.queue_type desconhecido: %q (use classic ou quorum)", a.QueueType)
+	}
+	if a.MaxLength < 0 {
+		fail("amqp.max_length não pode ser negativo, obtido %d", a.MaxLength)
+	}
+	if a.DeadLetterExchange == "" && (a.DeadLetterQueue != "" || a.DeadLetterRoutingKey != "") {
+		fail("amqp.dead_letter_queue e amqp.dead_letter_routing_key exigem amqp.dead_letter_exchange")
+	}
+	if a.QuarantineQueue != "" && a.QuarantineQueue == a.Queue {
+		fail("amqp.quarantine_queue não pode ser a própria fila consumida")
+	}
+	if _, err := a.QueueArguments(); err != nil {
+		fail("%v", err)
+	}
+	if a.Prefetch < 1 {
+		fail("amqp.prefetch deve ser pelo menos 1, obtido %d", a.Prefetch)
+	}
+	switch a.Auth {
+	case "plain":
+	case "external":
+		if !a.usesTLS() || a.TLS.CertFile == "" {
+			fail("amqp.auth external exige TLS e certificado de cliente (amqp.tls.cert_file)")
+		}
+	default:
+		fail("amqp.auth desconhecido: %q (use plain ou external)", a.Auth)
+	}
+	if a.TLS.Enabled && strings.HasPrefix(a.URL, "amqp://") {
+		fail("amqp.tls.enabled exige amqp.url com amqps://")
+	}
+	if (a.TLS.CertFile == "") != (a.TLS.KeyFile == "") {
+		fail("amqp.tls.cert_file e amqp.tls.key_file devem ser informados juntos")
+	}
+	if !a.usesTLS() &&
+		(a.TLS.CAFile != "" || a.TLS.CertFile != "" || a.TLS.ServerName != "" || a.TLS.InsecureSkipVerify) {
+		fail("opções amqp.tls definidas sem amqp.tls.enabled")
+	}
+
+	return errs
 }
 
-func Load() (*Config, error) {
-	if err := godotenv.Load(); err != nil {
-		logger.Warning("Arquivo .env não encontrado, lendo variáveis de ambiente")
+// QueueArguments junta os argumentos da fila: os campos dedicados
+// (queue_type, max_length, DLX) e os pares chave=valor de queue_args, com
+// números e booleanos convertidos. O DLX em si é aplicado pela topologia.
+func (a AMQPConfig) QueueArguments() (map[string]interface{}, error) {
+	args, err := broker.ParseQueueArgs(a.QueueArgs)
+	if err != nil {
+		return nil, fmt.Errorf("amqp.queue_args: %w", err)
 	}
 
-	rabbitmq_user := getEnv("RABBITMQ_USER", "guest")
-	rabbitmq_password := getEnv("RABBITMQ_PASSWORD", "guest")
-	rabbitmq_host := getEnv("RABBITMQ_HOST", "localhost")
-	rabbitmq_port := getEnv("RABBITMQ_PORT", "5672")
-	queue_name := getEnv("RABBITMQ_QUEUE_NAME", "eventcountertest")
+	if a.QueueType != "" {
+		args[broker.ArgQueueType] = a.QueueType
+	}
+	if a.MaxLength > 0 {
+		args[broker.ArgMaxLength] = int64(a.MaxLength)
+	}
+	if a.DeadLetterRoutingKey != "" {
+		args[broker.ArgDeadLetterRoutingKey] = a.DeadLetterRoutingKey
+	}
+	return args, nil
+}
 
-	cfg := &Config{
-		RabbitMQConnString: fmt.Sprintf("amqp://%s:%s@%s:%s/", rabbitmq_user, rabbitmq_password, rabbitmq_host, rabbitmq_port),
-		QueueName:          queue_name,
+func (a AMQPConfig) usesTLS() bool {
+	return a.TLS.Enabled || strings.HasPrefix(a.URL, "amqps://")
+}
+
+// DialOptions carrega os arquivos TLS quando a conexão usa amqps:// e
+// seleciona o mecanismo de autenticação.
+func (a AMQPConfig) DialOptions() (broker.AMQPOptions, error) {
+	opts := broker.AMQPOptions{External: a.Auth == "external"}
+	if !a.usesTLS() {
+		return opts, nil
+	}
+
+	tls_config, err := broker.TLSFiles{
+		CAFile:             a.TLS.CAFile,
+		CertFile:           a.TLS.CertFile,
+		KeyFile:            a.TLS.KeyFile,
+		ServerName:         a.TLS.ServerName,
+		InsecureSkipVerify: a.TLS.InsecureSkipVerify,
+	}.Config()
+	if err != nil {
+		return opts, err
+	}
+	opts.TLS = tls_config
+	return opts, nil
+}
+
+// ConnString devolve amqp.url quando definida ou monta a URL a partir dos
+// campos separados, usando amqps:// quando o TLS está habilitado.
+func (a AMQPConfig) ConnString() string {
+	if a.URL != "" {
+		return a.URL
 	}
 
-	return cfg, nil
+	scheme := "amqp"
+	if a.TLS.Enabled {
+		scheme = "amqps"
+	}
+	u := url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(a.User, a.Password),
+		Host:   net.JoinHostPort(a.Host, strconv.Itoa(a.Port)),
+		Path:   "/" + a.VHost,
+	}
+	return u.String()
+}
+
+// Print escreve a configuração efetiva no formato do arquivo YAML, com
+// senhas ocultas.
+func (c *Config) Print(w io.Writer) error {
+	out := make(map[string]interface{})
+	for _, f := range fields {
+		value := f.value(c).Get()
+		if f.redact != nil {
+			value = f.redact(value)
+		}
+
+		section := out
+		parts := strings.Split(f.key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := section[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				section[part] = next
+			}
+			section = next
+		}
+		section[parts[len(parts)-1]] = value
+	}
+
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("falha ao serializar configuração: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
 }
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
+// defaultInstanceID usa o hostname, que se mantém entre reinícios, para que
+// a instância encontre o próprio snapshot ao retomar as contagens. Processos
+// simultâneos no mesmo host precisam de INSTANCE_ID explícito.
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "consumer"
 	}
-	return fallback
+	return hostname
 }
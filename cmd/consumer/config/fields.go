@@ -0,0 +1,410 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field liga uma opção às suas três origens: a chave no arquivo (seções
+// separadas por ponto), a flag e a variável de ambiente. Campos reloadable
+// podem mudar com o consumidor rodando (veja Watcher).
+type field struct {
+	key        string
+	flag       string
+	env        string
+	usage      string
+	value      func(c *Config) valueSetter
+	redact     func(value interface{}) interface{}
+	reloadable bool
+}
+
+type valueSetter interface {
+	Set(string) error
+	String() string
+	Get() interface{}
+}
+
+// listSetter recebe os itens de uma lista do arquivo de configuração já
+// separados, sem passar pela divisão por vírgulas de Set.
+type listSetter interface {
+	SetList([]string) error
+}
+
+var fields = []field{
+	{key: "instance_id", flag: "instance-id", env: "INSTANCE_ID", usage: "Identificador da instância nos snapshots",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.InstanceID) }},
+	{key: "source", flag: "source", env: "SOURCE", usage: "Origem dos eventos: amqp, kafka, file:<caminho.ndjson> ou stdin",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Source) }},
+	{key: "source_offset", flag: "source-offset", env: "SOURCE_OFFSET", usage: "Linha inicial do replay (negativo retoma do checkpoint)",
+		value: func(c *Config) valueSetter { return (*int64Value)(&c.SourceOffset) }},
+	{key: "idle_timeout", flag: "idle-timeout", env: "IDLE_TIMEOUT", usage: "Tempo sem mensagens até encerrar",
+		value: func(c *Config) valueSetter { return (*durationValue)(&c.IdleTimeout) }},
+	{key: "workers", flag: "workers", env: "WORKERS", usage: "Workers por tipo de evento",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.Workers) }, reloadable: true},
+	{key: "results_dir", flag: "results-dir", env: "RESULTS_DIR", usage: "Diretório dos resultados e snapshots",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.ResultsDir) }},
+	{key: "flush_interval", flag: "flush-interval", env: "FLUSH_INTERVAL", usage: "Intervalo de gravação parcial dos resultados (0 grava só ao encerrar)",
+		value: func(c *Config) valueSetter { return (*durationValue)(&c.FlushInterval) }, reloadable: true},
+	{key: "log_level", flag: "log-level", env: "LOG_LEVEL", usage: "Nível de log: info, warning ou error",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.LogLevel) }, reloadable: true},
+	{key: "routing_key_pattern", flag: "routing-key-pattern", env: "ROUTING_KEY_PATTERN", usage: "Padrão da chave de roteamento",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.RoutingKeyPattern) }},
+	{key: "lifecycle", flag: "lifecycle", env: "LIFECYCLE_TRACKING", usage: "Acompanha o ciclo de vida dos usuários e grava anomalies.json",
+		value: func(c *Config) valueSetter { return (*boolValue)(&c.Lifecycle) }},
+
+	{key: "amqp.url", flag: "amqp-url", env: "RABBITMQ_URL", usage: "URL completa do RabbitMQ (substitui host, porta e credenciais)",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.URL) }, redact: redactURL},
+	{key: "amqp.user", flag: "amqp-user", env: "RABBITMQ_USER", usage: "Usuário do RabbitMQ",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.User) }},
+	{key: "amqp.password", flag: "amqp-password", env: "RABBITMQ_PASSWORD", usage: "Senha do RabbitMQ",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.Password) }, redact: redactSecret},
+	{key: "amqp.host", flag: "amqp-host", env: "RABBITMQ_HOST", usage: "Host do RabbitMQ",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.Host) }},
+	{key: "amqp.port", flag: "amqp-port", env: "RABBITMQ_PORT", usage: "Porta do RabbitMQ",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.AMQP.Port) }},
+	{key: "amqp.vhost", flag: "amqp-vhost", env: "RABBITMQ_VHOST", usage: "Virtual host do RabbitMQ",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.VHost) }},
+	{key: "amqp.queue", flag: "queue", env: "RABBITMQ_QUEUE_NAME", usage: "Fila consumida",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.Queue) }},
+	{key: "amqp.exchange", flag: "exchange", env: "RABBITMQ_EXCHANGE", usage: "Exchange ligada à fila (vazio não cria bindings)",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.Exchange) }},
+	{key: "amqp.bindings", flag: "bindings", env: "RABBITMQ_BINDINGS", usage: "Chaves de binding separadas por vírgula",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.AMQP.Bindings) }},
+	{key: "amqp.exchange_type", flag: "exchange-type", env: "RABBITMQ_EXCHANGE_TYPE", usage: "Tipo da exchange: topic, direct, fanout ou headers",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.ExchangeType) }},
+	{key: "amqp.queue_type", flag: "queue-type", env: "RABBITMQ_QUEUE_TYPE", usage: "Tipo da fila: classic ou quorum (vazio usa o padrão do broker)",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.QueueType) }},
+	{key: "amqp.max_length", flag: "queue-max-length", env: "RABBITMQ_QUEUE_MAX_LENGTH", usage: "x-max-length da fila (0 = sem limite)",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.AMQP.MaxLength) }},
+	{key: "amqp.dead_letter_exchange", flag: "dead-letter-exchange", env: "RABBITMQ_DEAD_LETTER_EXCHANGE", usage: "DLX (fanout) das mensagens rejeitadas ou descartadas",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.DeadLetterExchange) }},
+	{key: "amqp.dead_letter_routing_key", flag: "dead-letter-routing-key", env: "RABBITMQ_DEAD_LETTER_ROUTING_KEY", usage: "Chave usada ao republicar no DLX (vazio mantém a original)",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.DeadLetterRoutingKey) }},
+	{key: "amqp.dead_letter_queue", flag: "dead-letter-queue", env: "RABBITMQ_DEAD_LETTER_QUEUE", usage: "Fila ligada ao DLX",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.DeadLetterQueue) }},
+	{key: "amqp.quarantine_queue", flag: "quarantine-queue", env: "RABBITMQ_QUARANTINE_QUEUE", usage: "Fila que recebe os payloads inválidos, com o motivo nos headers",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.QuarantineQueue) }},
+	{key: "amqp.queue_args", flag: "queue-args", env: "RABBITMQ_QUEUE_ARGS", usage: "Argumentos extras da fila (chave=valor separados por vírgula)",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.AMQP.QueueArgs) }},
+	{key: "amqp.passive", flag: "passive", env: "RABBITMQ_PASSIVE", usage: "Só verifica que exchange e filas existem, sem declarar",
+		value: func(c *Config) valueSetter { return (*boolValue)(&c.AMQP.Passive) }},
+	{key: "amqp.prefetch", flag: "prefetch", env: "RABBITMQ_PREFETCH", usage: "Mensagens não confirmadas por consumidor",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.AMQP.Prefetch) }},
+	{key: "amqp.auth", flag: "amqp-auth", env: "RABBITMQ_AUTH_MECHANISM", usage: "Autenticação: plain (usuário e senha) ou external (certificado do cliente)",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.Auth) }},
+	{key: "amqp.tls.enabled", flag: "tls", env: "RABBITMQ_TLS_ENABLED", usage: "Conecta com amqps://",
+		value: func(c *Config) valueSetter { return (*boolValue)(&c.AMQP.TLS.Enabled) }},
+	{key: "amqp.tls.ca_file", flag: "tls-ca", env: "RABBITMQ_TLS_CA_FILE", usage: "CA usada para validar o servidor",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.TLS.CAFile) }},
+	{key: "amqp.tls.cert_file", flag: "tls-cert", env: "RABBITMQ_TLS_CERT_FILE", usage: "Certificado do cliente",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.TLS.CertFile) }},
+	{key: "amqp.tls.key_file", flag: "tls-key", env: "RABBITMQ_TLS_KEY_FILE", usage: "Chave privada do certificado do cliente",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.TLS.KeyFile) }},
+	{key: "amqp.tls.server_name", flag: "tls-server-name", env: "RABBITMQ_TLS_SERVER_NAME", usage: "Nome esperado no certificado do servidor",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.AMQP.TLS.ServerName) }},
+	{key: "amqp.tls.insecure_skip_verify", flag: "tls-insecure-skip-verify", env: "RABBITMQ_TLS_INSECURE_SKIP_VERIFY", usage: "Não valida o certificado do servidor (apenas testes)",
+		value: func(c *Config) valueSetter { return (*boolValue)(&c.AMQP.TLS.InsecureSkipVerify) }},
+
+	{key: "kafka.brokers", flag: "kafka-brokers", env: "KAFKA_BROKERS", usage: "Brokers Kafka separados por vírgula",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.Kafka.Brokers) }},
+	{key: "kafka.topic", flag: "kafka-topic", env: "KAFKA_TOPIC", usage: "Tópico Kafka",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Kafka.Topic) }},
+	{key: "kafka.group", flag: "kafka-group", env: "KAFKA_GROUP", usage: "Consumer group Kafka",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Kafka.Group) }},
+
+	{key: "tenant.header", flag: "tenant-header", env: "TENANT_HEADER", usage: "Header com o tenant quando a chave não o captura",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Tenant.Header) }},
+	{key: "tenant.max_users", flag: "tenant-max-users", env: "TENANT_MAX_USERS", usage: "Usuários rastreados por tenant (0 = sem limite)",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.Tenant.MaxUsers) }},
+
+	{key: "validation.required", flag: "validation-required", env: "VALIDATION_REQUIRED", usage: "Campos obrigatórios e não vazios do payload (separados por vírgula)",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.Validation.Required) }},
+	{key: "validation.id_format", flag: "validation-id-format", env: "VALIDATION_ID_FORMAT", usage: "Formato exigido do id: any ou uuid",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Validation.IDFormat) }},
+	{key: "validation.max_size", flag: "validation-max-size", env: "VALIDATION_MAX_SIZE", usage: "Tamanho máximo do payload em bytes (0 = sem limite)",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.Validation.MaxSize) }},
+	{key: "validation.max_decompressed_size", flag: "validation-max-decompressed-size", env: "VALIDATION_MAX_DECOMPRESSED_SIZE", usage: "Tamanho máximo do payload depois de descomprimido, em bytes (0 = sem limite)",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.Validation.MaxDecompressedSize) }},
+	{key: "validation.allow_unknown", flag: "validation-allow-unknown", env: "VALIDATION_ALLOW_UNKNOWN", usage: "Aceita campos desconhecidos no payload",
+		value: func(c *Config) valueSetter { return (*boolValue)(&c.Validation.AllowUnknown) }},
+
+	{key: "dispatcher.lanes", flag: "dispatcher-lanes", env: "DISPATCHER_LANES", usage: "Lanes seriais por usuário que preservam a ordem entre tipos (0 = canais por tipo)",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.Dispatcher.Lanes) }},
+	{key: "dispatcher.capacity", flag: "dispatcher-capacity", env: "DISPATCHER_CAPACITY", usage: "Eventos acumulados por tipo antes de aplicar a política de overflow",
+		value: func(c *Config) valueSetter { return (*intValue)(&c.Dispatcher.Capacity) }},
+	{key: "dispatcher.overflow", flag: "dispatcher-overflow", env: "DISPATCHER_OVERFLOW", usage: "Política com o dispatcher cheio: block, drop-oldest, reject-and-nack ou spill-to-disk",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Dispatcher.Overflow) }},
+	{key: "dispatcher.spill_dir", flag: "dispatcher-spill-dir", env: "DISPATCHER_SPILL_DIR", usage: "Diretório do arquivo de spill-to-disk (vazio = temporário do sistema)",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Dispatcher.SpillDir) }},
+
+	{key: "batch.failure_policy", flag: "batch-failure-policy", env: "BATCH_FAILURE_POLICY", usage: "Destino de um lote com eventos não aplicados: requeue, dead-letter ou ack",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.Batch.FailurePolicy) }},
+
+	{key: "group_by.preset", flag: "group-by-preset", env: "GROUP_BY_PRESET", usage: "Agrupamento pronto dos resultados: per-user ou per-type",
+		value: func(c *Config) valueSetter { return (*stringValue)(&c.GroupBy.Preset) }},
+	{key: "group_by.dimensions", flag: "group-by-dimensions", env: "GROUP_BY_DIMENSIONS", usage: "Dimensões dos resultados: user_id, routing.<captura>, header.<nome> ou payload.<campo> (substitui o preset)",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.GroupBy.Dimensions) }},
+
+	{key: "filter.rules", flag: "filter-rules", env: "FILTER_RULES", usage: "Regras de filtro, separadas por vírgula (vírgulas entre aspas não separam): <include|exclude> <campo> <operador> <valor> [and ...]",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.Filter.Rules) }},
+
+	{key: "aggregations.created", flag: "aggregations-created", env: "AGGREGATIONS_CREATED", usage: "Agregações dos valores de created: count, sum, min, max, mean, pNN (separadas por vírgula)",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.Aggregations.Created) }},
+	{key: "aggregations.updated", flag: "aggregations-updated", env: "AGGREGATIONS_UPDATED", usage: "Agregações dos valores de updated: count, sum, min, max, mean, pNN (separadas por vírgula)",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.Aggregations.Updated) }},
+	{key: "aggregations.deleted", flag: "aggregations-deleted", env: "AGGREGATIONS_DELETED", usage: "Agregações dos valores de deleted: count, sum, min, max, mean, pNN (separadas por vírgula)",
+		value: func(c *Config) valueSetter { return (*listValue)(&c.Aggregations.Deleted) }},
+}
+
+// loadFile aplica um arquivo YAML ou TOML (pela extensão) sobre a
+// configuração. Chaves desconhecidas são erro, para que erros de digitação
+// não passem despercebidos.
+func (c *Config) loadFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("erro ao ler arquivo de configuração: %w", err)}
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return []error{fmt.Errorf("erro ao interpretar %s: %w", path, err)}
+	}
+
+	values := make(map[string]interface{})
+	flatten("", raw, values)
+
+	by_key := make(map[string]field, len(fields))
+	for _, f := range fields {
+		by_key[f.key] = f
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		f, ok := by_key[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: chave desconhecida %q", path, key))
+			continue
+		}
+		setter := f.value(c)
+		switch value := values[key].(type) {
+		case []string:
+			if list, ok := setter.(listSetter); ok {
+				err = list.SetList(value)
+			} else {
+				err = setter.Set(strings.Join(value, ","))
+			}
+		default:
+			err = setter.Set(value.(string))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+		}
+	}
+	return errs
+}
+
+// flatten transforma seções aninhadas em chaves com ponto. Escalares viram
+// texto, como nas variáveis de ambiente, e listas ficam como []string, para
+// que itens com vírgula (como regras de filtro) não sejam divididos.
+func flatten(prefix string, raw map[string]interface{}, out map[string]interface{}) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			out[key] = items
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func redactSecret(value interface{}) interface{} {
+	if value == "" {
+		return ""
+	}
+	return "***"
+}
+
+func redactURL(value interface{}) interface{} {
+	raw, _ := value.(string)
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, has_password := u.User.Password(); has_password {
+		u.User = url.UserPassword(u.User.Username(), "***")
+	}
+	return u.String()
+}
+
+// rawFlag só registra o texto da flag; ele é aplicado depois do arquivo e
+// do ambiente para respeitar a precedência.
+type rawFlag struct {
+	name   string
+	values map[string]string
+	def    string
+	isBool bool
+}
+
+func (f *rawFlag) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f *rawFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.def
+}
+
+func (f *rawFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+func (v *stringValue) String() string   { return string(*v) }
+func (v *stringValue) Get() interface{} { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("número inteiro inválido: %q", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string   { return strconv.Itoa(int(*v)) }
+func (v *intValue) Get() interface{} { return int(*v) }
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return fmt.Errorf("número inteiro inválido: %q", s)
+	}
+	*v = int64Value(n)
+	return nil
+}
+
+func (v *int64Value) String() string   { return strconv.FormatInt(int64(*v), 10) }
+func (v *int64Value) Get() interface{} { return int64(*v) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("booleano inválido: %q", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) Get() interface{} { return bool(*v) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("duração inválida: %q", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string   { return time.Duration(*v).String() }
+func (v *durationValue) Get() interface{} { return time.Duration(*v).String() }
+
+type listValue []string
+
+// Set divide s nas vírgulas fora de aspas, para que um item possa ter
+// vírgulas num valor entre aspas, como em exclude header.x-tags == "a,b".
+func (v *listValue) Set(s string) error {
+	return v.SetList(splitList(s))
+}
+
+func (v *listValue) SetList(list []string) error {
+	var items []string
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v = items
+	return nil
+}
+
+// splitList separa s nas vírgulas que não estão entre aspas duplas ou
+// crases; as aspas ficam no item. Dentro de aspas duplas, \ escapa o
+// caractere seguinte, como em strconv.Unquote.
+func splitList(s string) []string {
+	var items []string
+	var quote rune
+	escaped := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+func (v *listValue) String() string   { return strings.Join(*v, ",") }
+func (v *listValue) Get() interface{} { return []string(*v) }
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+)
+
+// Diff devolve as chaves cujo valor mudou entre as duas configurações,
+// separando as que podem ser aplicadas em execução das que exigem reinício.
+func Diff(old, new *Config) (safe, unsafe []string) {
+	for _, f := range fields {
+		if f.value(old).String() == f.value(new).String() {
+			continue
+		}
+		if f.reloadable {
+			safe = append(safe, f.key)
+		} else {
+			unsafe = append(unsafe, f.key)
+		}
+	}
+	return safe, unsafe
+}
+
+// Watcher recarrega a configuração com os mesmos argumentos da linha de
+// comando ao receber SIGHUP ou quando o arquivo de configuração ou o .env
+// mudam. Uma
+// configuração inválida, ou que altere campos não recarregáveis, é
+// rejeitada por inteiro e a atual continua valendo.
+type Watcher struct {
+	args         []string
+	current      *Config
+	apply        func(*Config)
+	pollInterval time.Duration
+	modTime      time.Time
+	envModTime   time.Time
+}
+
+func NewWatcher(args []string, current *Config, apply func(*Config)) *Watcher {
+	return &Watcher{
+		args:         args,
+		current:      current,
+		apply:        apply,
+		pollInterval: time.Second,
+		modTime:      fileModTime(current.File),
+		envModTime:   fileModTime(".env"),
+	}
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	poll := time.NewTicker(w.pollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-hup:
+			logger.System("SIGHUP recebido, recarregando configuração")
+			w.Reload()
+		case <-poll.C:
+			if w.current.File != "" {
+				if t := fileModTime(w.current.File); !t.Equal(w.modTime) {
+					w.modTime = t
+					logger.System("Arquivo %s alterado, recarregando configuração", w.current.File)
+					w.Reload()
+					continue
+				}
+			}
+			if t := fileModTime(".env"); !t.Equal(w.envModTime) {
+				w.envModTime = t
+				logger.System("Arquivo .env alterado, recarregando configuração")
+				w.Reload()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reload lê a configuração de novo e, se for válida e só mudar campos
+// recarregáveis, a aplica. Retorna se a nova configuração foi aplicada.
+func (w *Watcher) Reload() bool {
+	next, err := Load(w.args)
+	if err != nil {
+		logger.Error("Recarga rejeitada, configuração inválida:\n%v", err)
+		return false
+	}
+
+	safe, unsafe := Diff(w.current, next)
+	if len(unsafe) > 0 {
+		logger.Error("Recarga rejeitada: mudanças em %s exigem reinício", strings.Join(unsafe, ", "))
+		return false
+	}
+	if len(safe) == 0 {
+		logger.Info("Configuração recarregada sem mudanças")
+		return false
+	}
+
+	logger.System("Aplicando configuração recarregada: %s", strings.Join(safe, ", "))
+	w.current = next
+	w.apply(next)
+	return true
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
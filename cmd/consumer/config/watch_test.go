@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_Reload(t *testing.T) {
+	path := writeFile(t, "consumer.yaml", "workers: 1\nlog_level: info\n")
+	args := []string{"-config", path}
+
+	current, err := Load(args)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+
+	var applied []*Config
+	watcher := NewWatcher(args, current, func(next *Config) { applied = append(applied, next) })
+
+	os.WriteFile(path, []byte("workers: 4\nlog_level: warning\nflush_interval: 10s\n"), 0644)
+	if !watcher.Reload() {
+		t.Fatal("Mudanças recarregáveis deveriam ser aplicadas")
+	}
+	if len(applied) != 1 || applied[0].Workers != 4 || applied[0].LogLevel != "warning" || applied[0].FlushInterval != 10*time.Second {
+		t.Fatalf("Configuração aplicada incorreta: %+v", applied)
+	}
+
+	os.WriteFile(path, []byte("workers: 8\namqp:\n  queue: outra\n"), 0644)
+	if watcher.Reload() {
+		t.Error("Mudança de amqp.queue exige reinício e deveria rejeitar a recarga")
+	}
+
+	os.WriteFile(path, []byte("workers: 0\n"), 0644)
+	if watcher.Reload() {
+		t.Error("Configuração inválida deveria ser rejeitada")
+	}
+	if len(applied) != 1 {
+		t.Errorf("Recargas rejeitadas não deveriam ser aplicadas, aplicadas %d", len(applied))
+	}
+}
+
+func TestWatcher_ReloadWithDotEnv(t *testing.T) {
+	dir := withDotEnv(t, "WORKERS=2\nLOG_LEVEL=error\nRESULTS_DIR=from-dotenv\nFLUSH_INTERVAL=5s\n")
+	path := writeFile(t, "consumer.yaml", "workers: 1\n")
+	args := []string{"-config", path}
+
+	current, err := Load(args)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if current.Workers != 1 || current.ResultsDir != "from-dotenv" {
+		t.Fatalf("Carga inicial incorreta: workers=%d results_dir=%s", current.Workers, current.ResultsDir)
+	}
+
+	var applied []*Config
+	watcher := NewWatcher(args, current, func(next *Config) { applied = append(applied, next) })
+
+	// As chaves recarregáveis do .env não podem esconder as do arquivo.
+	os.WriteFile(path, []byte("workers: 4\nlog_level: warning\nflush_interval: 10s\n"), 0644)
+	if !watcher.Reload() {
+		t.Fatal("Mudanças no arquivo deveriam ser aplicadas mesmo com .env")
+	}
+	if next := applied[0]; next.Workers != 4 || next.LogLevel != "warning" || next.FlushInterval != 10*time.Second {
+		t.Fatalf("Configuração aplicada incorreta: %+v", next)
+	}
+
+	// O .env é lido de novo a cada recarga; results_dir só muda com reinício.
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("RESULTS_DIR=outro\n"), 0644)
+	if watcher.Reload() {
+		t.Fatal("Mudança de results_dir no .env deveria exigir reinício")
+	}
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("RESULTS_DIR=from-dotenv\nWORKERS=9\n"), 0644)
+	os.WriteFile(path, []byte("log_level: warning\nflush_interval: 10s\n"), 0644)
+	if !watcher.Reload() {
+		t.Fatal("Mudança no .env deveria ser aplicada")
+	}
+	if next := applied[1]; next.ResultsDir != "from-dotenv" || next.Workers != 9 {
+		t.Errorf("Configuração aplicada incorreta: results_dir=%s workers=%d", next.ResultsDir, next.Workers)
+	}
+}
+
+func TestWatcher_RunReloadsOnFileChange(t *testing.T) {
+	path := writeFile(t, "consumer.yaml", "workers: 1\n")
+	args := []string{"-config", path}
+
+	current, err := Load(args)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+
+	applied := make(chan *Config, 1)
+	watcher := NewWatcher(args, current, func(next *Config) { applied <- next })
+	watcher.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Run(ctx)
+
+	os.WriteFile(path, []byte("workers: 3\n"), 0644)
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+
+	select {
+	case next := <-applied:
+		if next.Workers != 3 {
+			t.Errorf("Esperado workers=3, obtido %d", next.Workers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Mudança no arquivo não foi recarregada")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := Default()
+	next := Default()
+	next.Workers = 5
+	next.ResultsDir = "out"
+	next.AMQP.Prefetch = 10
+
+	safe, unsafe := Diff(old, next)
+	if len(safe) != 1 || safe[0] != "workers" {
+		t.Errorf("Mudanças seguras incorretas: %v", safe)
+	}
+	if len(unsafe) != 2 || unsafe[0] != "results_dir" || unsafe[1] != "amqp.prefetch" {
+		t.Errorf("Mudanças que exigem reinício incorretas: %v", unsafe)
+	}
+}
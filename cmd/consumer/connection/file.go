@@ -0,0 +1,355 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+const replayProgressInterval = time.Second
+
+// replayRecord é uma linha do NDJSON exportado. Aceita tanto o formato do
+// consumidor (id) quanto o de pkg.Message (uid), e a chave de roteamento
+// original quando ela foi exportada; sem ela, a chave é montada com o
+// padrão configurado, e os campos além de user e type vêm de chaves de
+// mesmo nome na linha.
+type replayRecord struct {
+	ID         string          `json:"id"`
+	UID        string          `json:"uid"`
+	UserID     string          `json:"user_id"`
+	EventType  string          `json:"event_type"`
+	RoutingKey string          `json:"routing_key"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// replaySource lê eventos NDJSON de um arquivo ou da entrada padrão. O
+// offset é o número da linha; ao fechar, o maior offset contíguo aplicado e
+// as linhas já aplicadas depois dele são gravados em <arquivo>.offset para
+// que a próxima execução continue dali sem contá-las de novo. Linhas
+// devolvidas com Nack(true) são reentregues, e o fim do arquivo só encerra
+// as entregas depois que todas as linhas foram confirmadas.
+type replaySource struct {
+	name       string
+	reader     io.ReadCloser
+	size       int64
+	start      int64
+	skip       map[int64]bool
+	checkpoint string
+	schema     *routing.Schema
+
+	mu         sync.Mutex
+	offsets    *watermark
+	settled    chan struct{}
+	redelivery redelivery
+	deliveries chan broker.Delivery
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// ConsumeFile reprocessa um arquivo NDJSON a partir da linha offset; com
+// offset negativo, retoma do checkpoint salvo na execução anterior. Sem
+// schema, as chaves seguem o padrão padrão.
+func ConsumeFile(path string, offset int64, schema *routing.Schema) (broker.Source, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir arquivo de replay: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("erro ao ler arquivo de replay: %w", err)
+	}
+
+	checkpoint := path + ".offset"
+	var skip []int64
+	if offset < 0 {
+		if offset, skip, err = readCheckpoint(checkpoint); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return newReplaySource(path, file, info.Size(), offset, skip, checkpoint, schema)
+}
+
+// ConsumeReader reprocessa eventos NDJSON de um leitor sem checkpoint, como
+// a entrada padrão, pulando as primeiras offset linhas.
+func ConsumeReader(name string, reader io.Reader, offset int64, schema *routing.Schema) (broker.Source, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	return newReplaySource(name, io.NopCloser(reader), 0, offset, nil, "", schema)
+}
+
+func newReplaySource(name string, reader io.ReadCloser, size, offset int64, skip []int64, checkpoint string, schema *routing.Schema) (*replaySource, error) {
+	if schema == nil {
+		schema = routing.MustSchema(routing.DefaultPattern)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &replaySource{
+		name:       name,
+		reader:     reader,
+		size:       size,
+		start:      offset,
+		skip:       make(map[int64]bool, len(skip)),
+		checkpoint: checkpoint,
+		schema:     schema,
+		offsets:    newWatermark(offset),
+		settled:    make(chan struct{}, 1),
+		deliveries: make(chan broker.Delivery),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	for _, line := range skip {
+		s.skip[line] = true
+	}
+	go s.run()
+	return s, nil
+}
+
+// readCheckpoint lê a linha de retomada e, em seguida, as linhas já
+// aplicadas depois dela, todas separadas por espaço.
+func readCheckpoint(path string) (int64, []int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("erro ao ler checkpoint %s: %w", path, err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("checkpoint %s vazio", path)
+	}
+	lines := make([]int64, len(fields))
+	for i, field := range fields {
+		if lines[i], err = strconv.ParseInt(field, 10, 64); err != nil {
+			return 0, nil, fmt.Errorf("checkpoint %s inválido: %w", path, err)
+		}
+	}
+	return lines[0], lines[1:], nil
+}
+
+func writeCheckpoint(path string, offset int64, settled []int64) error {
+	fields := []string{strconv.FormatInt(offset, 10)}
+	for _, line := range settled {
+		fields = append(fields, strconv.FormatInt(line, 10))
+	}
+	return os.WriteFile(path, []byte(strings.Join(fields, " ")+"\n"), 0644)
+}
+
+func (s *replaySource) Deliveries() <-chan broker.Delivery {
+	return s.deliveries
+}
+
+func (s *replaySource) run() {
+	defer close(s.done)
+	defer close(s.deliveries)
+	defer s.redelivery.stop()
+
+	if s.start > 0 {
+		logger.System("Replay %s: retomando a partir da linha %d", s.name, s.start)
+	}
+
+	reader := bufio.NewReader(s.reader)
+	progress := time.NewTicker(replayProgressInterval)
+	defer progress.Stop()
+
+	var line, read int64
+	for {
+		data, err := reader.ReadBytes('\n')
+		read += int64(len(data))
+
+		if len(data) > 0 {
+			if line >= s.start {
+				if !s.emit(line, bytes.TrimSpace(data)) {
+					return
+				}
+			}
+			line++
+		}
+
+		select {
+		case <-progress.C:
+			s.reportProgress(line, read)
+		default:
+		}
+
+		if err == io.EOF {
+			if !s.waitSettled() {
+				return
+			}
+			s.reportProgress(line, read)
+			logger.System("Replay %s concluído: %d linhas lidas", s.name, line)
+			return
+		}
+		if err != nil {
+			logger.Error("Erro ao ler %s na linha %d: %v", s.name, line, err)
+			return
+		}
+	}
+}
+
+func (s *replaySource) emit(line int64, data []byte) bool {
+	s.mu.Lock()
+	s.offsets.deliver(line)
+	s.mu.Unlock()
+
+	// Linhas em branco e as já aplicadas antes do checkpoint só avançam o
+	// offset.
+	if len(data) == 0 || s.skip[line] {
+		s.settle(line)
+		return true
+	}
+
+	select {
+	case s.deliveries <- s.delivery(line, data, false):
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+func (s *replaySource) delivery(line int64, data []byte, redelivered bool) broker.Delivery {
+	settle := func() error {
+		s.settle(line)
+		return nil
+	}
+
+	return broker.NewDelivery(replayMessage(data, s.schema), uint64(line), redelivered,
+		settle,
+		func(requeue bool) error {
+			if requeue {
+				s.redelivery.send(s.ctx, s.deliveries, s.delivery(line, data, true))
+				return nil
+			}
+			return settle()
+		})
+}
+
+// waitSettled espera, no fim do arquivo, a confirmação das linhas ainda
+// pendentes, que podem voltar ao canal por Nack(true).
+func (s *replaySource) waitSettled() bool {
+	for {
+		s.mu.Lock()
+		pending := s.offsets.Pending()
+		s.mu.Unlock()
+		if pending == 0 {
+			return true
+		}
+
+		select {
+		case <-s.settled:
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+}
+
+func replayMessage(data []byte, schema *routing.Schema) broker.Message {
+	var record replayRecord
+	var payload map[string]json.RawMessage
+	if json.Unmarshal(data, &record) != nil || json.Unmarshal(data, &payload) != nil {
+		// Mantém o corpo original para que o consumidor rejeite a linha
+		// pelo mesmo caminho de JSON inválido do AMQP.
+		return broker.Message{Body: data}
+	}
+
+	// O corpo é o próprio objeto da linha, para que os demais campos do
+	// payload cheguem às regras de filtro e às dimensões payload.*; só os
+	// campos que descrevem a chave de roteamento saem dele.
+	delete(payload, "uid")
+	delete(payload, "routing_key")
+	if record.ID == "" && record.UID != "" {
+		payload["id"], _ = json.Marshal(record.UID)
+	}
+
+	routing_key := record.RoutingKey
+	if routing_key == "" {
+		fields := make(map[string]string)
+		for _, name := range schema.Fields() {
+			var value string
+			if json.Unmarshal(payload[name], &value) == nil {
+				fields[name] = value
+			}
+			delete(payload, name)
+		}
+		fields["user"], fields["type"] = record.UserID, record.EventType
+		routing_key = schema.Format(fields)
+	}
+	body, _ := json.Marshal(payload)
+
+	return broker.Message{RoutingKey: routing_key, Body: body, ContentType: "application/json"}
+}
+
+func (s *replaySource) settle(line int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets.settle(line)
+
+	select {
+	case s.settled <- struct{}{}:
+	default:
+	}
+}
+
+func (s *replaySource) reportProgress(line, read int64) {
+	s.mu.Lock()
+	applied := s.offsets.Commit()
+	s.mu.Unlock()
+
+	if s.size > 0 {
+		logger.Info("Replay %s: %d linhas lidas (%.1f%%), %d aplicadas", s.name, line, 100*float64(read)/float64(s.size), applied)
+		return
+	}
+	logger.Info("Replay %s: %d linhas lidas, %d aplicadas", s.name, line, applied)
+}
+
+func (s *replaySource) Offset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offsets.Commit()
+}
+
+func (s *replaySource) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+		s.reader.Close()
+
+		if s.checkpoint == "" {
+			return
+		}
+
+		s.mu.Lock()
+		offset, settled := s.offsets.Commit(), s.offsets.Settled()
+		s.mu.Unlock()
+
+		if writeErr := writeCheckpoint(s.checkpoint, offset, settled); writeErr != nil {
+			err = fmt.Errorf("erro ao gravar checkpoint %s: %w", s.checkpoint, writeErr)
+			return
+		}
+		logger.System("Checkpoint de %s salvo na linha %d", s.name, offset)
+	})
+	return err
+}
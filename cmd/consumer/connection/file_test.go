@@ -0,0 +1,201 @@
+package rabbitmq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+const replayFixture = `{"id":"1","user_id":"user_a","event_type":"created"}
+{"uid":"2","user_id":"user_b","event_type":"deleted"}
+{"id":
+{"id":"3","routing_key":"user_c.event.updated"}
+
+{"id":"4","user_id":"user_a","event_type":"updated"}
+`
+
+func TestReplaySource_MapsLines(t *testing.T) {
+	source, err := ConsumeReader("stdin", strings.NewReader(replayFixture), 0, nil)
+	if err != nil {
+		t.Fatalf("Erro ao abrir replay: %v", err)
+	}
+	defer source.Close()
+
+	var keys []string
+	var bodies []string
+	for d := range source.Deliveries() {
+		keys = append(keys, d.RoutingKey)
+		bodies = append(bodies, string(d.Body))
+		d.Ack()
+	}
+
+	expectedKeys := []string{"user_a.event.created", "user_b.event.deleted", "", "user_c.event.updated", "user_a.event.updated"}
+	if strings.Join(keys, ",") != strings.Join(expectedKeys, ",") {
+		t.Errorf("Chaves de roteamento inesperadas: %v", keys)
+	}
+	if bodies[1] != `{"event_type":"deleted","id":"2","user_id":"user_b"}` {
+		t.Errorf("uid deveria ser mapeado para id, obtido %s", bodies[1])
+	}
+	if bodies[2] != `{"id":` {
+		t.Errorf("Linha inválida deveria manter o corpo original, obtido %s", bodies[2])
+	}
+}
+
+func TestReplaySource_ResumesFromCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	if err := os.WriteFile(path, []byte(replayFixture), 0644); err != nil {
+		t.Fatalf("Erro ao escrever arquivo: %v", err)
+	}
+
+	source, err := ConsumeFile(path, -1, nil)
+	if err != nil {
+		t.Fatalf("Erro ao abrir replay: %v", err)
+	}
+
+	first := <-source.Deliveries()
+	second := <-source.Deliveries()
+	malformed := <-source.Deliveries()
+	<-source.Deliveries()
+
+	second.Ack()
+	malformed.Nack(false)
+	first.Ack()
+
+	if err := source.Close(); err != nil {
+		t.Fatalf("Erro ao fechar replay: %v", err)
+	}
+
+	offset, _, err := readCheckpoint(path + ".offset")
+	if err != nil || offset != 3 {
+		t.Fatalf("Esperado checkpoint na linha 3, obtido %d (erro: %v)", offset, err)
+	}
+
+	source, err = ConsumeFile(path, -1, nil)
+	if err != nil {
+		t.Fatalf("Erro ao retomar replay: %v", err)
+	}
+	defer source.Close()
+
+	resumed := <-source.Deliveries()
+	if resumed.RoutingKey != "user_c.event.updated" {
+		t.Errorf("Replay deveria retomar na primeira linha não aplicada, obtido %s", resumed.RoutingKey)
+	}
+}
+
+func TestReplaySource_CheckpointSkipsAppliedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	if err := os.WriteFile(path, []byte(replayFixture), 0644); err != nil {
+		t.Fatalf("Erro ao escrever arquivo: %v", err)
+	}
+
+	source, err := ConsumeFile(path, -1, nil)
+	if err != nil {
+		t.Fatalf("Erro ao abrir replay: %v", err)
+	}
+
+	first := <-source.Deliveries()
+	<-source.Deliveries()
+	malformed := <-source.Deliveries()
+	fourth := <-source.Deliveries()
+
+	// A segunda linha segura o checkpoint, mas as seguintes já aplicadas
+	// não podem ser contadas de novo ao retomar.
+	first.Ack()
+	malformed.Nack(false)
+	fourth.Ack()
+
+	if err := source.Close(); err != nil {
+		t.Fatalf("Erro ao fechar replay: %v", err)
+	}
+
+	offset, settled, err := readCheckpoint(path + ".offset")
+	if err != nil || offset != 1 || !reflect.DeepEqual(settled, []int64{2, 3, 4}) {
+		t.Fatalf("Esperado checkpoint 1 com linhas 2, 3 e 4 aplicadas, obtido %d %v (erro: %v)", offset, settled, err)
+	}
+
+	source, err = ConsumeFile(path, -1, nil)
+	if err != nil {
+		t.Fatalf("Erro ao retomar replay: %v", err)
+	}
+	defer source.Close()
+
+	var keys []string
+	for d := range source.Deliveries() {
+		keys = append(keys, d.RoutingKey)
+		d.Ack()
+	}
+	if strings.Join(keys, ",") != "user_b.event.deleted,user_a.event.updated" {
+		t.Errorf("Replay deveria entregar só as linhas não aplicadas, obtido %v", keys)
+	}
+}
+
+func TestReplaySource_RedeliversRequeuedLines(t *testing.T) {
+	source, err := ConsumeReader("stdin", strings.NewReader(replayFixture), 0, nil)
+	if err != nil {
+		t.Fatalf("Erro ao abrir replay: %v", err)
+	}
+	defer source.Close()
+
+	requeued := false
+	var keys []string
+	for d := range source.Deliveries() {
+		if d.RoutingKey == "user_b.event.deleted" && !requeued {
+			requeued = true
+			d.Nack(true)
+			continue
+		}
+		if d.RoutingKey == "user_b.event.deleted" && !d.Redelivered {
+			t.Error("Linha reentregue deveria vir marcada como redelivered")
+		}
+		keys = append(keys, d.RoutingKey)
+		d.Ack()
+	}
+
+	if len(keys) != 5 || !strings.Contains(strings.Join(keys, ","), "user_b.event.deleted") {
+		t.Errorf("Linha devolvida deveria ser reentregue antes do fim do replay, obtido %v", keys)
+	}
+	if offset := source.(*replaySource).Offset(); offset != 6 {
+		t.Errorf("Todas as linhas deveriam estar aplicadas, offset %d", offset)
+	}
+}
+
+func TestReplaySource_BuildsKeyFromSchema(t *testing.T) {
+	schema, err := routing.NewSchema("{tenant}.{user}.event.{type}")
+	if err != nil {
+		t.Fatalf("Erro ao compilar padrão: %v", err)
+	}
+	input := `{"id":"1","user_id":"user_a","event_type":"created","tenant":"acme"}` + "\n"
+	source, err := ConsumeReader("stdin", strings.NewReader(input), 0, schema)
+	if err != nil {
+		t.Fatalf("Erro ao abrir replay: %v", err)
+	}
+	defer source.Close()
+
+	d := <-source.Deliveries()
+	d.Ack()
+	if d.RoutingKey != "acme.user_a.event.created" {
+		t.Errorf("Chave deveria seguir o padrão configurado, obtido %s", d.RoutingKey)
+	}
+	if string(d.Body) != `{"event_type":"created","id":"1","user_id":"user_a"}` {
+		t.Errorf("Campos da chave não deveriam ficar no corpo, obtido %s", d.Body)
+	}
+}
+
+func TestReplaySource_KeepsPayloadFields(t *testing.T) {
+	input := `{"id":"1","user_id":"user_a","event_type":"created","value":2.5,"region":"br"}` + "\n"
+	source, err := ConsumeReader("stdin", strings.NewReader(input), 0, nil)
+	if err != nil {
+		t.Fatalf("Erro ao abrir replay: %v", err)
+	}
+	defer source.Close()
+
+	d := <-source.Deliveries()
+	d.Ack()
+	if string(d.Body) != `{"event_type":"created","id":"1","region":"br","user_id":"user_a","value":2.5}` {
+		t.Errorf("Campos do payload deveriam ser mantidos no replay, obtido %s", d.Body)
+	}
+}
@@ -0,0 +1,243 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type KafkaConfig struct {
+	Brokers          []string
+	Topic            string
+	Group            string
+	UserIDHeader     string
+	EventTypeHeader  string
+	RoutingKeyHeader string
+	Schema           *routing.Schema
+}
+
+// kafkaSource converte registros Kafka em Delivery. A chave de roteamento
+// vem do header RoutingKeyHeader ou é montada com Schema: o usuário vem da
+// chave do registro (ou do header UserIDHeader), o tipo do header
+// EventTypeHeader e os demais campos do padrão de headers de mesmo nome.
+// Offsets só são marcados para commit quando todos os registros anteriores
+// da partição foram confirmados, ou seja, aplicados pelo dispatcher;
+// registros devolvidos com Nack(true) são reentregues no próprio processo.
+type kafkaSource struct {
+	cfg        KafkaConfig
+	client     *kgo.Client
+	offsets    *offsetTracker
+	redelivery redelivery
+	deliveries chan broker.Delivery
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func ConsumeKafka(cfg KafkaConfig) (broker.Source, error) {
+	if cfg.UserIDHeader == "" {
+		cfg.UserIDHeader = "user_id"
+	}
+	if cfg.EventTypeHeader == "" {
+		cfg.EventTypeHeader = "event_type"
+	}
+	if cfg.RoutingKeyHeader == "" {
+		cfg.RoutingKeyHeader = "routing_key"
+	}
+	if cfg.Schema == nil {
+		cfg.Schema = routing.MustSchema(routing.DefaultPattern)
+	}
+
+	offsets := newOffsetTracker()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ConsumeTopics(cfg.Topic),
+		kgo.ConsumerGroup(cfg.Group),
+		kgo.AutoCommitMarks(),
+		kgo.OnPartitionsRevoked(func(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+			offsets.forget(revoked)
+		}),
+		kgo.OnPartitionsLost(func(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+			offsets.forget(lost)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar cliente Kafka: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &kafkaSource{
+		cfg:        cfg,
+		client:     client,
+		offsets:    offsets,
+		deliveries: make(chan broker.Delivery),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *kafkaSource) Deliveries() <-chan broker.Delivery {
+	return s.deliveries
+}
+
+func (s *kafkaSource) run() {
+	defer close(s.done)
+	defer close(s.deliveries)
+	defer s.redelivery.stop()
+
+	for {
+		fetches := s.client.PollFetches(s.ctx)
+		if fetches.IsClientClosed() || s.ctx.Err() != nil {
+			return
+		}
+
+		fetches.EachError(func(topic string, partition int32, err error) {
+			logger.Error("Erro ao ler partição %s/%d: %v", topic, partition, err)
+		})
+
+		iter := fetches.RecordIter()
+		for !iter.Done() {
+			record := iter.Next()
+			s.offsets.deliver(record)
+
+			select {
+			case s.deliveries <- s.toDelivery(record, false):
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (s *kafkaSource) toDelivery(record *kgo.Record, redelivered bool) broker.Delivery {
+	headers := make(map[string]interface{}, len(record.Headers))
+	for _, h := range record.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	msg := broker.Message{
+		RoutingKey: s.routingKey(record, headers),
+		Body:       record.Value,
+		Headers:    headers,
+	}
+	if content_type, ok := headers["content-type"].(string); ok {
+		msg.ContentType = content_type
+	}
+
+	settle := func() error {
+		s.offsets.settle(s.client, record)
+		return nil
+	}
+
+	return broker.NewDelivery(msg, uint64(record.Offset), redelivered,
+		settle,
+		func(requeue bool) error {
+			if requeue {
+				// Kafka não reentrega registros individuais: o offset segue
+				// pendente e o mesmo registro volta ao canal de entregas.
+				s.redelivery.send(s.ctx, s.deliveries, s.toDelivery(record, true))
+				return nil
+			}
+			return settle()
+		})
+}
+
+func (s *kafkaSource) routingKey(record *kgo.Record, headers map[string]interface{}) string {
+	if routing_key, _ := headers[s.cfg.RoutingKeyHeader].(string); routing_key != "" {
+		return routing_key
+	}
+
+	fields := make(map[string]string)
+	for _, name := range s.cfg.Schema.Fields() {
+		fields[name], _ = headers[name].(string)
+	}
+	fields["user"] = string(record.Key)
+	if fields["user"] == "" {
+		fields["user"], _ = headers[s.cfg.UserIDHeader].(string)
+	}
+	fields["type"], _ = headers[s.cfg.EventTypeHeader].(string)
+	return s.cfg.Schema.Format(fields)
+}
+
+func (s *kafkaSource) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+
+		if commitErr := s.client.CommitMarkedOffsets(context.Background()); commitErr != nil {
+			err = fmt.Errorf("erro ao confirmar offsets no Kafka: %w", commitErr)
+		}
+		s.client.Close()
+	})
+	return err
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+type partitionOffsets struct {
+	*watermark
+	epoch int32
+}
+
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+func (t *offsetTracker) deliver(record *kgo.Record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{record.Topic, record.Partition}
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionOffsets{watermark: newWatermark(record.Offset)}
+		t.partitions[key] = p
+	}
+	p.deliver(record.Offset)
+	p.epoch = record.LeaderEpoch
+}
+
+// settle remove o registro das pendências e marca para commit o menor
+// offset ainda pendente da partição (ou o próximo, se não houver).
+func (t *offsetTracker) settle(client *kgo.Client, record *kgo.Record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partitionKey{record.Topic, record.Partition}]
+	if !ok || !p.settle(record.Offset) {
+		return
+	}
+
+	client.MarkCommitOffsets(map[string]map[int32]kgo.EpochOffset{
+		record.Topic: {record.Partition: {Epoch: p.epoch, Offset: p.Commit()}},
+	})
+}
+
+func (t *offsetTracker) forget(partitions map[string][]int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for topic, ids := range partitions {
+		for _, id := range ids {
+			delete(t.partitions, partitionKey{topic, id})
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newKafkaCluster(t *testing.T, topic string, records ...*kgo.Record) []string {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, topic))
+	if err != nil {
+		t.Fatalf("Erro ao iniciar cluster Kafka falso: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+
+	produce(t, cluster.ListenAddrs(), topic, records...)
+	return cluster.ListenAddrs()
+}
+
+func produce(t *testing.T, brokers []string, topic string, records ...*kgo.Record) {
+	t.Helper()
+
+	producer, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.DefaultProduceTopic(topic))
+	if err != nil {
+		t.Fatalf("Erro ao criar produtor: %v", err)
+	}
+	defer producer.Close()
+
+	if err := producer.ProduceSync(context.Background(), records...).FirstErr(); err != nil {
+		t.Fatalf("Erro ao produzir registros: %v", err)
+	}
+}
+
+func receiveKafka(t *testing.T, source broker.Source) broker.Delivery {
+	t.Helper()
+
+	select {
+	case d, ok := <-source.Deliveries():
+		if !ok {
+			t.Fatal("Canal de entregas fechado inesperadamente")
+		}
+		return d
+	case <-time.After(10 * time.Second):
+		t.Fatal("Nenhum registro entregue")
+	}
+	return broker.Delivery{}
+}
+
+func userEvent(user_id, event_type, id string) *kgo.Record {
+	return &kgo.Record{
+		Key:     []byte(user_id),
+		Value:   []byte(fmt.Sprintf(`{"id":"%s"}`, id)),
+		Headers: []kgo.RecordHeader{{Key: "event_type", Value: []byte(event_type)}},
+	}
+}
+
+func TestKafkaSource_MapsKeyAndHeaders(t *testing.T) {
+	brokers := newKafkaCluster(t, "user-events",
+		userEvent("user_a", "created", "1"),
+		&kgo.Record{
+			Value: []byte(`{"id":"2"}`),
+			Headers: []kgo.RecordHeader{
+				{Key: "user_id", Value: []byte("user_b")},
+				{Key: "event_type", Value: []byte("deleted")},
+			},
+		},
+	)
+
+	source, err := ConsumeKafka(KafkaConfig{Brokers: brokers, Topic: "user-events", Group: "test"})
+	if err != nil {
+		t.Fatalf("Erro ao consumir tópico: %v", err)
+	}
+	defer source.Close()
+
+	first := receiveKafka(t, source)
+	if first.RoutingKey != "user_a.event.created" || string(first.Body) != `{"id":"1"}` {
+		t.Errorf("Registro com chave mapeado incorretamente: %s %s", first.RoutingKey, first.Body)
+	}
+
+	second := receiveKafka(t, source)
+	if second.RoutingKey != "user_b.event.deleted" {
+		t.Errorf("Registro sem chave deveria usar o header user_id, obtido %s", second.RoutingKey)
+	}
+}
+
+func TestKafkaSource_CommitsOnlyContiguousAckedOffsets(t *testing.T) {
+	brokers := newKafkaCluster(t, "user-events",
+		userEvent("user_a", "created", "1"),
+		userEvent("user_a", "updated", "2"),
+		userEvent("user_a", "deleted", "3"),
+	)
+	cfg := KafkaConfig{Brokers: brokers, Topic: "user-events", Group: "counter"}
+
+	source, err := ConsumeKafka(cfg)
+	if err != nil {
+		t.Fatalf("Erro ao consumir tópico: %v", err)
+	}
+
+	first := receiveKafka(t, source)
+	second := receiveKafka(t, source)
+	third := receiveKafka(t, source)
+
+	// O terceiro registro é aplicado antes do segundo, que nunca é
+	// confirmado: o commit não pode passar do segundo offset.
+	third.Ack()
+	first.Ack()
+	_ = second
+
+	if err := source.Close(); err != nil {
+		t.Fatalf("Erro ao fechar origem: %v", err)
+	}
+
+	source, err = ConsumeKafka(cfg)
+	if err != nil {
+		t.Fatalf("Erro ao reabrir origem: %v", err)
+	}
+	defer source.Close()
+
+	resumed := receiveKafka(t, source)
+	if string(resumed.Body) != `{"id":"2"}` {
+		t.Errorf("Consumo deveria retomar no primeiro registro não aplicado, obtido %s", resumed.Body)
+	}
+}
+
+func TestKafkaSource_BuildsRoutingKeyFromSchema(t *testing.T) {
+	brokers := newKafkaCluster(t, "user-events",
+		&kgo.Record{
+			Key:   []byte("user_a"),
+			Value: []byte(`{"id":"1"}`),
+			Headers: []kgo.RecordHeader{
+				{Key: "event_type", Value: []byte("created")},
+				{Key: "tenant", Value: []byte("acme")},
+			},
+		},
+		&kgo.Record{
+			Key:     []byte("user_a"),
+			Value:   []byte(`{"id":"2"}`),
+			Headers: []kgo.RecordHeader{{Key: "routing_key", Value: []byte("globex.user_b.event.deleted")}},
+		},
+	)
+
+	schema, err := routing.NewSchema("{tenant}.{user}.event.{type}")
+	if err != nil {
+		t.Fatalf("Erro ao compilar padrão: %v", err)
+	}
+	source, err := ConsumeKafka(KafkaConfig{Brokers: brokers, Topic: "user-events", Group: "test", Schema: schema})
+	if err != nil {
+		t.Fatalf("Erro ao consumir tópico: %v", err)
+	}
+	defer source.Close()
+
+	if first := receiveKafka(t, source); first.RoutingKey != "acme.user_a.event.created" {
+		t.Errorf("Chave deveria seguir o padrão configurado, obtido %s", first.RoutingKey)
+	}
+	if second := receiveKafka(t, source); second.RoutingKey != "globex.user_b.event.deleted" {
+		t.Errorf("Header routing_key deveria ter precedência, obtido %s", second.RoutingKey)
+	}
+}
+
+func TestKafkaSource_RedeliversRequeuedRecords(t *testing.T) {
+	brokers := newKafkaCluster(t, "user-events",
+		userEvent("user_a", "created", "1"),
+		userEvent("user_a", "updated", "2"),
+	)
+	cfg := KafkaConfig{Brokers: brokers, Topic: "user-events", Group: "counter"}
+
+	source, err := ConsumeKafka(cfg)
+	if err != nil {
+		t.Fatalf("Erro ao consumir tópico: %v", err)
+	}
+
+	first := receiveKafka(t, source)
+	first.Nack(true)
+	second := receiveKafka(t, source)
+	second.Ack()
+
+	retried := receiveKafka(t, source)
+	if string(retried.Body) != `{"id":"1"}` || !retried.Redelivered {
+		t.Fatalf("Registro devolvido deveria ser reentregue, obtido %s (redelivered=%v)", retried.Body, retried.Redelivered)
+	}
+	retried.Ack()
+
+	if err := source.Close(); err != nil {
+		t.Fatalf("Erro ao fechar origem: %v", err)
+	}
+
+	// Com os dois registros aplicados, o commit passa de ambos.
+	produce(t, brokers, "user-events", userEvent("user_a", "deleted", "3"))
+	source, err = ConsumeKafka(cfg)
+	if err != nil {
+		t.Fatalf("Erro ao reabrir origem: %v", err)
+	}
+	defer source.Close()
+
+	if resumed := receiveKafka(t, source); string(resumed.Body) != `{"id":"3"}` {
+		t.Errorf("Consumo deveria retomar após os registros reentregues, obtido %s", resumed.Body)
+	}
+}
@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+)
+
+// Headers adicionados às mensagens em quarentena.
+const (
+	HeaderQuarantineReason = "x-quarantine-reason"
+	HeaderQuarantineDetail = "x-quarantine-detail"
+	HeaderOriginalKey      = "x-original-routing-key"
+)
+
+// Quarantine publica na fila de quarentena, pela exchange padrão, as
+// mensagens que não passaram na validação, com o motivo nos headers.
+type Quarantine struct {
+	broker broker.Broker
+	queue  string
+}
+
+func NewQuarantine(b broker.Broker, queue string) *Quarantine {
+	return &Quarantine{broker: b, queue: queue}
+}
+
+func (q *Quarantine) Queue() string {
+	return q.queue
+}
+
+func (q *Quarantine) Send(ctx context.Context, msg broker.Message, reason, detail string) error {
+	headers := make(map[string]interface{}, len(msg.Headers)+3)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderQuarantineReason] = reason
+	headers[HeaderQuarantineDetail] = detail
+	headers[HeaderOriginalKey] = msg.RoutingKey
+
+	quarantined := msg
+	quarantined.RoutingKey = q.queue
+	quarantined.Headers = headers
+
+	confirmation, err := q.broker.Publish(ctx, "", quarantined, true)
+	if err != nil {
+		return fmt.Errorf("erro ao publicar na quarentena %s: %w", q.queue, err)
+	}
+	if confirmation == nil {
+		return nil
+	}
+
+	select {
+	case <-confirmation.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if confirmation.Returned() {
+		return fmt.Errorf("fila de quarentena %s não existe", q.queue)
+	}
+	if !confirmation.Acked() {
+		return fmt.Errorf("broker não confirmou a mensagem na quarentena %s", q.queue)
+	}
+	return nil
+}
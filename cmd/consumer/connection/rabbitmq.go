@@ -1,58 +1,49 @@
 package rabbitmq
 
 import (
-	"fmt"
-
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
 )
 
-func ConsumeMessages(conn_string string, queue_name string) (<-chan amqp.Delivery, *amqp.Connection, *amqp.Channel, error) {
-	conn, err := amqp.Dial(conn_string)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("erro ao conectar com o RabbitMQ: %w", err)
-	}
+// AMQPConfig descreve a conexão e a topologia da fila consumida (veja
+// DeclareTopology).
+type AMQPConfig struct {
+	URL                string
+	Queue              string
+	QueueArgs          map[string]interface{}
+	Exchange           string
+	ExchangeType       string
+	Bindings           []string
+	DeadLetterExchange string
+	DeadLetterQueue    string
+	QuarantineQueue    string
+	Passive            bool
+	Prefetch           int
+	Options            broker.AMQPOptions
+}
 
-	ch, err := conn.Channel()
+func ConsumeMessages(cfg AMQPConfig) (broker.Broker, broker.Source, error) {
+	b, err := broker.DialAMQPWithOptions(cfg.URL, cfg.Options)
 	if err != nil {
-		conn.Close()
-		return nil, nil, nil, fmt.Errorf("erro ao abrir um canal: %w", err)
+		return nil, nil, err
 	}
 
-	err = ch.Qos(1, 0, false)
+	source, err := Consume(b, cfg)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, nil, nil, fmt.Errorf("erro ao definir QoS: %w", err)
+		b.Close()
+		return nil, nil, err
 	}
 
-	queue, err := ch.QueueDeclare(
-		"eventcountertest",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, nil, nil, fmt.Errorf("erro ao declarar uma queue: %w", err)
-	}
+	return b, source, nil
+}
 
-	messages, err := ch.Consume(
-		queue.Name,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, nil, nil, fmt.Errorf("erro ao consumir mensagens: %w", err)
+func Consume(b broker.Broker, cfg AMQPConfig) (broker.Source, error) {
+	if err := DeclareTopology(b, cfg); err != nil {
+		return nil, err
 	}
 
-	return messages, conn, ch, nil
+	prefetch := cfg.Prefetch
+	if prefetch < 1 {
+		prefetch = 1
+	}
+	return b.Consume(cfg.Queue, prefetch)
 }
@@ -0,0 +1,42 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+)
+
+// redelivery reentrega no próprio processo as entregas devolvidas com
+// Nack(true) por origens sem reentrega nativa (Kafka e replay). Sem isso o
+// registro ficaria pendente e seguraria o offset até o reinício. stop deve
+// ser chamado antes de fechar o canal de entregas.
+type redelivery struct {
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func (r *redelivery) send(ctx context.Context, deliveries chan<- broker.Delivery, d broker.Delivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		select {
+		case deliveries <- d:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+func (r *redelivery) stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	r.wg.Wait()
+}
@@ -0,0 +1,97 @@
+package rabbitmq
+
+import (
+	"fmt"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+)
+
+// DeclareTopology declara o DLX e sua fila, a exchange, a fila com seus
+// argumentos e os bindings, para que o consumidor suba sem depender do
+// gerador. Em modo passivo nada é criado: só verifica que exchange e filas
+// já existem, para ambientes em que a topologia é gerida por fora.
+func DeclareTopology(b broker.Broker, cfg AMQPConfig) error {
+	exchange_type := cfg.ExchangeType
+	if exchange_type == "" {
+		exchange_type = "topic"
+	}
+
+	if cfg.Passive {
+		return checkTopology(b, cfg, exchange_type)
+	}
+
+	args := cfg.QueueArgs
+	if cfg.DeadLetterExchange != "" {
+		if err := b.DeclareExchange(cfg.DeadLetterExchange, "fanout"); err != nil {
+			return err
+		}
+		if cfg.DeadLetterQueue != "" {
+			if err := b.DeclareQueue(cfg.DeadLetterQueue, nil); err != nil {
+				return err
+			}
+			if err := b.BindQueue(cfg.DeadLetterQueue, "", cfg.DeadLetterExchange); err != nil {
+				return fmt.Errorf("erro ao ligar fila %s ao DLX %s: %w", cfg.DeadLetterQueue, cfg.DeadLetterExchange, err)
+			}
+		}
+
+		args = make(map[string]interface{}, len(cfg.QueueArgs)+1)
+		for k, v := range cfg.QueueArgs {
+			args[k] = v
+		}
+		args[broker.ArgDeadLetterExchange] = cfg.DeadLetterExchange
+	}
+
+	if err := b.DeclareQueue(cfg.Queue, args); err != nil {
+		return err
+	}
+	if cfg.QuarantineQueue != "" {
+		if err := b.DeclareQueue(cfg.QuarantineQueue, nil); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Exchange != "" {
+		if err := b.DeclareExchange(cfg.Exchange, exchange_type); err != nil {
+			return err
+		}
+		for _, key := range cfg.Bindings {
+			if err := b.BindQueue(cfg.Queue, key, cfg.Exchange); err != nil {
+				return fmt.Errorf("erro ao ligar fila %s com %s: %w", cfg.Queue, key, err)
+			}
+		}
+	}
+
+	logger.Info("Topologia declarada: fila %s %v, exchange %q (%s), bindings %v, DLX %q, quarentena %q",
+		cfg.Queue, args, cfg.Exchange, exchange_type, cfg.Bindings, cfg.DeadLetterExchange, cfg.QuarantineQueue)
+	return nil
+}
+
+func checkTopology(b broker.Broker, cfg AMQPConfig, exchange_type string) error {
+	if cfg.Exchange != "" {
+		if err := b.CheckExchange(cfg.Exchange, exchange_type); err != nil {
+			return err
+		}
+	}
+	if cfg.DeadLetterExchange != "" {
+		if err := b.CheckExchange(cfg.DeadLetterExchange, "fanout"); err != nil {
+			return err
+		}
+	}
+	if cfg.DeadLetterQueue != "" {
+		if err := b.CheckQueue(cfg.DeadLetterQueue); err != nil {
+			return err
+		}
+	}
+	if cfg.QuarantineQueue != "" {
+		if err := b.CheckQueue(cfg.QuarantineQueue); err != nil {
+			return err
+		}
+	}
+	if err := b.CheckQueue(cfg.Queue); err != nil {
+		return err
+	}
+
+	logger.Info("Topologia verificada em modo passivo: fila %s, exchange %q", cfg.Queue, cfg.Exchange)
+	return nil
+}
@@ -0,0 +1,75 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+)
+
+func topologyConfig() AMQPConfig {
+	return AMQPConfig{
+		Queue:              "counter",
+		QueueArgs:          map[string]interface{}{broker.ArgQueueType: "quorum"},
+		Exchange:           "user-events",
+		Bindings:           []string{"*.event.*"},
+		DeadLetterExchange: "user-events.dlx",
+		DeadLetterQueue:    "counter.dead",
+	}
+}
+
+func TestDeclareTopology_RoutesAndDeadLetters(t *testing.T) {
+	b := broker.NewMemory()
+	source, err := Consume(b, topologyConfig())
+	if err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+	defer source.Close()
+
+	conf, err := b.Publish(context.Background(), "user-events", broker.Message{RoutingKey: "user_a.event.created"}, true)
+	if err != nil || conf.Returned() {
+		t.Fatalf("Mensagem deveria ser roteada para a fila do consumidor (erro %v)", err)
+	}
+
+	select {
+	case d := <-source.Deliveries():
+		d.Nack(false)
+	case <-time.After(time.Second):
+		t.Fatal("Nenhuma mensagem entregue")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for b.Depth("counter.dead") != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if depth := b.Depth("counter.dead"); depth != 1 {
+		t.Errorf("Mensagem rejeitada deveria ir para a fila do DLX, profundidade %d", depth)
+	}
+
+	if err := DeclareTopology(b, topologyConfig()); err != nil {
+		t.Errorf("Declarar a mesma topologia de novo deveria ser idempotente: %v", err)
+	}
+}
+
+func TestDeclareTopology_Passive(t *testing.T) {
+	b := broker.NewMemory()
+	cfg := topologyConfig()
+	cfg.Passive = true
+
+	if err := DeclareTopology(b, cfg); err == nil {
+		t.Fatal("Modo passivo deveria falhar sem a topologia existente")
+	}
+	if err := b.CheckQueue("counter"); err == nil {
+		t.Error("Modo passivo não deveria declarar a fila")
+	}
+
+	cfg.Passive = false
+	if err := DeclareTopology(b, cfg); err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+	cfg.Passive = true
+	if err := DeclareTopology(b, cfg); err != nil {
+		t.Errorf("Modo passivo deveria aceitar a topologia existente: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package rabbitmq
+
+// watermark acompanha offsets entregues e ainda não confirmados de um fluxo
+// ordenado. Commit é o menor offset pendente (ou o próximo a ser entregue),
+// então um offset só é considerado concluído quando todos os anteriores
+// também foram.
+type watermark struct {
+	pending map[int64]bool
+	next    int64
+}
+
+func newWatermark(start int64) *watermark {
+	return &watermark{pending: make(map[int64]bool), next: start}
+}
+
+func (w *watermark) deliver(offset int64) {
+	w.pending[offset] = true
+	w.next = offset + 1
+}
+
+func (w *watermark) settle(offset int64) bool {
+	if !w.pending[offset] {
+		return false
+	}
+	delete(w.pending, offset)
+	return true
+}
+
+func (w *watermark) Commit() int64 {
+	commit := w.next
+	for offset := range w.pending {
+		if offset < commit {
+			commit = offset
+		}
+	}
+	return commit
+}
+
+// Settled devolve, em ordem, os offsets já confirmados depois de Commit,
+// que ainda teriam de ser pulados ao retomar do commit.
+func (w *watermark) Settled() []int64 {
+	var settled []int64
+	for offset := w.Commit(); offset < w.next; offset++ {
+		if !w.pending[offset] {
+			settled = append(settled, offset)
+		}
+	}
+	return settled
+}
+
+// Pending diz quantos offsets entregues ainda aguardam confirmação.
+func (w *watermark) Pending() int {
+	return len(w.pending)
+}
@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Funções de agregação dos valores de um tipo de evento. Percentis são
+// pedidos como pNN (p50, p95, p99.9) e estimados por um t-digest; count é
+// sempre escrito.
+const (
+	AggCount = "count"
+	AggSum   = "sum"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggMean  = "mean"
+)
+
+// Aggregations lista as funções de agregação por tipo de evento. Tipos sem
+// funções além de count não guardam os valores recebidos.
+type Aggregations map[string][]string
+
+// ParseAggregation valida o nome da função e, para um percentil, devolve o
+// quantil correspondente (p95 = 0.95); para as demais o quantil é -1.
+func ParseAggregation(name string) (float64, error) {
+	switch name {
+	case AggCount, AggSum, AggMin, AggMax, AggMean:
+		return -1, nil
+	}
+	if digits, ok := strings.CutPrefix(name, "p"); ok {
+		percentile, err := strconv.ParseFloat(digits, 64)
+		if err == nil && percentile >= 0 && percentile <= 100 {
+			return percentile / 100, nil
+		}
+	}
+	return 0, fmt.Errorf("agregação desconhecida: %q (use count, sum, min, max, mean ou pNN, como p95)", name)
+}
+
+// TracksValues diz se o tipo tem alguma função que precise dos valores.
+func (a Aggregations) TracksValues(event_type string) bool {
+	for _, name := range a[event_type] {
+		if name != AggCount {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge acrescenta as funções de other que ainda não estão em a.
+func (a Aggregations) Merge(other Aggregations) {
+	for event_type, names := range other {
+		for _, name := range names {
+			if !containsString(a[event_type], name) {
+				a[event_type] = append(a[event_type], name)
+			}
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValueStats acumula os valores de um usuário em um tipo de evento. Count
+// conta só os eventos que trouxeram valor.
+type ValueStats struct {
+	Count  int64
+	Sum    float64
+	Min    float64
+	Max    float64
+	digest tdigest
+}
+
+func (s *ValueStats) Add(value float64) {
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+	s.digest.add(value, 1)
+}
+
+// Merge soma as estatísticas de other, de outra instância ou tenant.
+func (s *ValueStats) Merge(other *ValueStats) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+	s.digest.merge(&other.digest)
+}
+
+func (s *ValueStats) Clone() *ValueStats {
+	clone := &ValueStats{}
+	clone.Merge(s)
+	return clone
+}
+
+func (s *ValueStats) Quantile(q float64) float64 {
+	return s.digest.quantile(q, s.Min, s.Max)
+}
+
+// summarize preenche em out as funções pedidas; sem valores nada é escrito.
+func (s *ValueStats) summarize(names []string, out *RowStats) {
+	if s == nil || s.Count == 0 {
+		return
+	}
+	for _, name := range names {
+		q, err := ParseAggregation(name)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case AggCount:
+		case AggSum:
+			out.Sum = floatPtr(s.Sum)
+		case AggMin:
+			out.Min = floatPtr(s.Min)
+		case AggMax:
+			out.Max = floatPtr(s.Max)
+		case AggMean:
+			out.Mean = floatPtr(s.Sum / float64(s.Count))
+		default:
+			if out.Percentiles == nil {
+				out.Percentiles = make(map[string]float64)
+			}
+			out.Percentiles[name] = s.Quantile(q)
+		}
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// valueStatsJSON é a forma serializada de ValueStats nos snapshots: os
+// centróides do t-digest como pares [média, peso].
+type valueStatsJSON struct {
+	Count     int64        `json:"count"`
+	Sum       float64      `json:"sum"`
+	Min       float64      `json:"min"`
+	Max       float64      `json:"max"`
+	Centroids [][2]float64 `json:"centroids,omitempty"`
+}
+
+func (s *ValueStats) MarshalJSON() ([]byte, error) {
+	centroids := s.digest.all()
+	pairs := make([][2]float64, len(centroids))
+	for i, c := range centroids {
+		pairs[i] = [2]float64{c.Mean, c.Weight}
+	}
+	return json.Marshal(valueStatsJSON{Count: s.Count, Sum: s.Sum, Min: s.Min, Max: s.Max, Centroids: pairs})
+}
+
+func (s *ValueStats) UnmarshalJSON(data []byte) error {
+	var raw valueStatsJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = ValueStats{Count: raw.Count, Sum: raw.Sum, Min: raw.Min, Max: raw.Max}
+	for _, pair := range raw.Centroids {
+		if pair[1] <= 0 || math.IsNaN(pair[0]) {
+			return fmt.Errorf("centróide inválido: %v", pair)
+		}
+		s.digest.add(pair[0], pair[1])
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE AGREGAÇÃO DE VALORES
+// =============================================================================
+
+func TestParseAggregation(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     float64
+		valid bool
+	}{
+		{"sum", -1, true},
+		{"mean", -1, true},
+		{"p50", 0.5, true},
+		{"p99.9", 0.999, true},
+		{"p101", 0, false},
+		{"median", 0, false},
+		{"p", 0, false},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseAggregation(tt.name)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: validade esperada %v, erro %v", tt.name, tt.valid, err)
+		}
+		if tt.valid && math.Abs(q-tt.q) > 1e-9 {
+			t.Errorf("%s: quantil esperado %v, obtido %v", tt.name, tt.q, q)
+		}
+	}
+}
+
+func TestValueStats_PercentilesAndMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var a, b ValueStats
+	for i, n := range rng.Perm(10000) {
+		value := float64(n + 1)
+		if i%2 == 0 {
+			a.Add(value)
+		} else {
+			b.Add(value)
+		}
+	}
+
+	merged := a.Clone()
+	merged.Merge(&b)
+	if merged.Count != 10000 || merged.Min != 1 || merged.Max != 10000 || merged.Sum != 50005000 {
+		t.Fatalf("Estatísticas exatas incorretas: %+v", merged)
+	}
+
+	for q, want := range map[float64]float64{0.5: 5000, 0.95: 9500, 0.99: 9900, 0.999: 9990} {
+		if got := merged.Quantile(q); math.Abs(got-want) > want*0.01 {
+			t.Errorf("Quantil %v: esperado ~%v, obtido %v", q, want, got)
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		t.Fatalf("Erro ao serializar: %v", err)
+	}
+	var loaded ValueStats
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Erro ao desserializar: %v", err)
+	}
+	if loaded.Count != merged.Count || math.Abs(loaded.Quantile(0.99)-merged.Quantile(0.99)) > 1 {
+		t.Errorf("Serialização deveria preservar o t-digest: %v contra %v", loaded.Quantile(0.99), merged.Quantile(0.99))
+	}
+}
+
+func TestEventCounter_AggregatesValuesPerType(t *testing.T) {
+	ctx := context.Background()
+	counter := NewEventCounter()
+	counter.SetAggregations(Aggregations{"updated": {"count", "sum", "min", "max", "mean", "p50"}, "created": {"count"}})
+
+	dispatcher := NewDispatcher(counter)
+	defer dispatcher.Close()
+	dispatcher.StartWorkers(ctx)
+
+	for _, v := range []float64{10, 20, 60} {
+		value := v
+		dispatcher.Dispatch(ctx, EventMessage{UserID: "user1", EventType: "updated", Value: &value})
+	}
+	value := 5.0
+	dispatcher.Dispatch(ctx, EventMessage{UserID: "user1", EventType: "updated"})
+	dispatcher.Dispatch(ctx, EventMessage{UserID: "user1", EventType: "created", Value: &value})
+	dispatcher.WaitForCompletion()
+
+	dir := t.TempDir()
+	if err := WriteResults(dir, counter.counters, counter.values, counter.columns, counter.aggregations); err != nil {
+		t.Fatalf("Erro ao salvar resultados: %v", err)
+	}
+
+	var updated []UserCount
+	data, _ := os.ReadFile(filepath.Join(dir, "updated.json"))
+	if err := json.Unmarshal(data, &updated); err != nil || len(updated) != 1 {
+		t.Fatalf("Resultado updated inesperado: %s (%v)", data, err)
+	}
+	row := updated[0]
+	if row.Count != 4 || *row.Sum != 90 || *row.Min != 10 || *row.Max != 60 || *row.Mean != 30 {
+		t.Errorf("Agregações incorretas: %s", data)
+	}
+	if got := row.Percentiles["p50"]; got < 10 || got > 60 {
+		t.Errorf("Mediana fora do intervalo: %v", got)
+	}
+
+	var created []UserCount
+	data, _ = os.ReadFile(filepath.Join(dir, "created.json"))
+	if err := json.Unmarshal(data, &created); err != nil || len(created) != 1 || created[0].Sum != nil {
+		t.Errorf("Tipo só com count não deveria guardar valores: %s (%v)", data, err)
+	}
+}
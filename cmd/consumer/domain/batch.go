@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BatchFailurePolicy define o destino de uma entrega em lote quando algum
+// dos seus eventos não foi aplicado.
+type BatchFailurePolicy string
+
+const (
+	// BatchRequeue devolve o lote para a fila se alguma falha for
+	// passageira (dispatcher cheio, encerramento); na nova entrega os
+	// eventos já aplicados são descartados pela deduplicação. Falhas
+	// definitivas (evento inválido ou descartado) rejeitam o lote sem
+	// reenfileirar, como uma mensagem avulsa.
+	BatchRequeue BatchFailurePolicy = "requeue"
+	// BatchDeadLetter rejeita o lote sem reenfileirar, mandando-o para a
+	// dead-letter exchange, se houver.
+	BatchDeadLetter BatchFailurePolicy = "dead-letter"
+	// BatchAck confirma o lote mesmo assim, aceitando a perda dos eventos
+	// que falharam.
+	BatchAck BatchFailurePolicy = "ack"
+)
+
+func ParseBatchFailurePolicy(name string) (BatchFailurePolicy, error) {
+	switch policy := BatchFailurePolicy(name); policy {
+	case BatchRequeue, BatchDeadLetter, BatchAck:
+		return policy, nil
+	}
+	return "", fmt.Errorf("política de falha de lote desconhecida: %q (use requeue, dead-letter ou ack)", name)
+}
+
+// BatchAction é o que fazer com a entrega em lote.
+type BatchAction int
+
+const (
+	BatchActionAck BatchAction = iota
+	BatchActionRequeue
+	BatchActionReject
+)
+
+// BatchResult resume os eventos de um lote: quantos foram aplicados e
+// quantos falharam, dos quais Retriable de forma passageira.
+type BatchResult struct {
+	Total     int
+	Applied   int
+	Failed    int
+	Retriable int
+}
+
+func (r BatchResult) String() string {
+	return fmt.Sprintf("%d de %d aplicados, %d com falha (%d passageiras)", r.Applied, r.Total, r.Failed, r.Retriable)
+}
+
+// Action decide o destino da entrega; um lote totalmente aplicado é sempre
+// confirmado.
+func (p BatchFailurePolicy) Action(r BatchResult) BatchAction {
+	switch {
+	case r.Failed == 0 || p == BatchAck:
+		return BatchActionAck
+	case p == BatchRequeue && r.Retriable > 0:
+		return BatchActionRequeue
+	}
+	return BatchActionReject
+}
+
+// BatchSettlement acompanha os eventos de uma entrega em lote e chama done
+// uma única vez, quando o último deles é aplicado ou falha. Cada evento
+// deve ser resolvido exatamente uma vez, por Applied ou Failed.
+type BatchSettlement struct {
+	mu     sync.Mutex
+	result BatchResult
+	done   func(BatchResult)
+}
+
+func NewBatchSettlement(total int, done func(BatchResult)) *BatchSettlement {
+	return &BatchSettlement{result: BatchResult{Total: total}, done: done}
+}
+
+func (s *BatchSettlement) Applied() {
+	s.settle(func(r *BatchResult) { r.Applied++ })
+}
+
+// Failed registra um evento que não foi aplicado; retriable indica se uma
+// nova entrega pode aplicá-lo.
+func (s *BatchSettlement) Failed(retriable bool) {
+	s.settle(func(r *BatchResult) {
+		r.Failed++
+		if retriable {
+			r.Retriable++
+		}
+	})
+}
+
+func (s *BatchSettlement) settle(update func(*BatchResult)) {
+	s.mu.Lock()
+	update(&s.result)
+	result := s.result
+	s.mu.Unlock()
+
+	if result.Applied+result.Failed == result.Total {
+		s.done(result)
+	}
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBatchFailurePolicy_Action(t *testing.T) {
+	tests := []struct {
+		policy BatchFailurePolicy
+		result BatchResult
+		want   BatchAction
+	}{
+		{BatchRequeue, BatchResult{Total: 3, Applied: 3}, BatchActionAck},
+		{BatchRequeue, BatchResult{Total: 3, Applied: 1, Failed: 2, Retriable: 1}, BatchActionRequeue},
+		{BatchRequeue, BatchResult{Total: 3, Applied: 2, Failed: 1}, BatchActionReject},
+		{BatchDeadLetter, BatchResult{Total: 3, Applied: 2, Failed: 1, Retriable: 1}, BatchActionReject},
+		{BatchAck, BatchResult{Total: 3, Failed: 3, Retriable: 3}, BatchActionAck},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Action(tt.result); got != tt.want {
+			t.Errorf("%s com %s: esperado %d, obtido %d", tt.policy, tt.result, tt.want, got)
+		}
+	}
+
+	if _, err := ParseBatchFailurePolicy("retry"); err == nil {
+		t.Error("Política desconhecida deveria falhar")
+	}
+}
+
+func TestBatchSettlement_DoneOnce(t *testing.T) {
+	var calls []BatchResult
+	var mu sync.Mutex
+	settlement := NewBatchSettlement(10, func(r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%3 == 0 {
+				settlement.Failed(i == 0)
+				return
+			}
+			settlement.Applied()
+		}(i)
+	}
+	wg.Wait()
+
+	if len(calls) != 1 {
+		t.Fatalf("done deveria ser chamado uma vez, obtido %d", len(calls))
+	}
+	if want := (BatchResult{Total: 10, Applied: 6, Failed: 4, Retriable: 1}); calls[0] != want {
+		t.Errorf("Esperado %+v, obtido %+v", want, calls[0])
+	}
+}
@@ -2,126 +2,513 @@ package domain
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"strings"
 	"sync"
+	"time"
 
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
 	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
 )
 
 type EventMessage struct {
-	UserID    string
-	EventType string
-	MessageID string
+	UserID     string
+	EventType  string
+	MessageID  string
+	Tenant     string
+	Attributes map[string]string
+	// Value é o valor numérico opcional do evento, agregado depois da
+	// contagem quando o tipo tem agregações configuradas.
+	Value *float64
+	// Group são os valores das dimensões de agrupamento; nil conta por
+	// usuário.
+	Group     []string
+	OnApplied func()
+	OnDropped func()
+}
+
+// applied sinaliza que o evento saiu do pipeline (contado ou descartado),
+// para que a origem só confirme a mensagem depois disso.
+func (m EventMessage) applied() {
+	if m.OnApplied != nil {
+		m.OnApplied()
+	}
+}
+
+// groupKey é a chave do evento no EventCounter.
+func (m EventMessage) groupKey() string {
+	if m.Group == nil {
+		return m.UserID
+	}
+	return GroupKey(m.Group)
+}
+
+// dropped sinaliza que o evento foi descartado sem ser aplicado, pela
+// política de overflow ou pela cota de usuários, para que a origem o
+// rejeite em vez de confirmá-lo.
+func (m EventMessage) dropped() {
+	if m.OnDropped != nil {
+		m.OnDropped()
+	}
 }
 
 type Dispatcher struct {
 	created_chan chan EventMessage
 	updated_chan chan EventMessage
 	deleted_chan chan EventMessage
+	lanes        []chan EventMessage
+	lane_count   int
 	counter      *EventCounter
+	tenants      *TenantRegistry
+	lifecycle    *LifecycleRegistry
+	consumers    []eventcounter.Consumer
+	schema       *routing.Schema
+	workers      int
+	workers_mu   sync.Mutex
+	workers_ctx  context.Context
+	stops        []chan struct{}
+	capacity     int
+	overflow     OverflowPolicy
+	spill_dir    string
+	spill        *spillQueue
+	stats_mu     sync.Mutex
+	stats        DispatcherStats
 	wg           *sync.WaitGroup
 }
 
-func NewDispatcher(counter *EventCounter) *Dispatcher {
-	return &Dispatcher{
-		created_chan: make(chan EventMessage, 100),
-		updated_chan: make(chan EventMessage, 100),
-		deleted_chan: make(chan EventMessage, 100),
-		counter:      counter,
-		wg:           &sync.WaitGroup{},
+type DispatcherOption func(*Dispatcher)
+
+func WithRoutingKeySchema(schema *routing.Schema) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.schema = schema
 	}
 }
 
-func (d *Dispatcher) ParseRoutingKey(routing_key string) (user_id, event_type string, err error) {
-	parts := strings.Split(routing_key, ".")
-	if len(parts) != 3 || parts[1] != "event" {
-		return "", "", nil
+// WithTenants faz os workers contarem cada evento no contador do seu tenant.
+func WithTenants(tenants *TenantRegistry) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.tenants = tenants
 	}
+}
 
-	user_id = parts[0]
-	event_type = parts[2]
-	return user_id, event_type, nil
+// WithLifecycle faz os workers alimentarem também o LifecycleTracker do
+// tenant de cada evento contado.
+func WithLifecycle(lifecycle *LifecycleRegistry) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.lifecycle = lifecycle
+	}
 }
 
-func (d *Dispatcher) Dispatch(ctx context.Context, msg EventMessage) {
-	d.wg.Add(1)
+// WithConsumer registra um eventcounter.Consumer que recebe cada evento
+// depois do contador, com o usuário original. Com WithOrderedLanes ele vê
+// os eventos de cada usuário na ordem de chegada.
+func WithConsumer(consumer eventcounter.Consumer) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.consumers = append(d.consumers, consumer)
+	}
+}
+
+// WithWorkers define quantos workers consomem cada tipo de evento.
+func WithWorkers(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.workers = n
+		}
+	}
+}
+
+// WithOrderedLanes troca os canais por tipo por n lanes seriais: os eventos
+// são particionados por tenant e usuário, e cada lane aplica os seus na
+// ordem de chegada, qualquer que seja o tipo. Assim um deleted nunca é
+// aplicado antes do created que o precedeu. O número de lanes é fixo
+// enquanto o dispatcher roda.
+func WithOrderedLanes(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.lane_count = n
+		}
+	}
+}
+
+// WithCapacity define quantos eventos cada canal de tipo acumula antes de
+// aplicar a política de overflow.
+func WithCapacity(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.capacity = n
+		}
+	}
+}
+
+// WithOverflowPolicy escolhe o que fazer com os canais cheios; spillDir é
+// o diretório do arquivo de OverflowSpill (vazio usa o temporário do
+// sistema).
+func WithOverflowPolicy(policy OverflowPolicy, spillDir string) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.overflow = policy
+		d.spill_dir = spillDir
+	}
+}
+
+func NewDispatcher(counter *EventCounter, opts ...DispatcherOption) *Dispatcher {
+	schema := routing.MustSchema(routing.DefaultPattern)
+
+	d := &Dispatcher{
+		counter:  counter,
+		schema:   schema,
+		workers:  1,
+		capacity: 100,
+		overflow: OverflowBlock,
+		wg:       &sync.WaitGroup{},
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.created_chan = make(chan EventMessage, d.capacity)
+	d.updated_chan = make(chan EventMessage, d.capacity)
+	d.deleted_chan = make(chan EventMessage, d.capacity)
+	for i := 0; i < d.lane_count; i++ {
+		d.lanes = append(d.lanes, make(chan EventMessage, d.capacity))
+	}
+
+	if d.overflow == OverflowSpill {
+		spill, err := newSpillQueue(d.spill_dir)
+		if err != nil {
+			logger.Error("%v; usando a política block", err)
+			d.overflow = OverflowBlock
+		} else {
+			d.spill = spill
+		}
+	}
+	return d
+}
+
+func (d *Dispatcher) ParseRoutingKey(routing_key string) (user_id, event_type string, err error) {
+	fields, err := d.schema.Parse(routing_key)
+	if err != nil {
+		return "", "", err
+	}
+	return fields["user"], fields["type"], nil
+}
+
+// ParseRoutingKeyFields devolve o evento com usuário, tipo e os demais
+// campos capturados pelo padrão (como tenant) em Attributes.
+func (d *Dispatcher) ParseRoutingKeyFields(routing_key string) (EventMessage, error) {
+	fields, err := d.schema.Parse(routing_key)
+	if err != nil {
+		return EventMessage{}, err
+	}
+
+	msg := EventMessage{
+		UserID:    fields["user"],
+		EventType: fields["type"],
+	}
+	for name, value := range fields {
+		if name == "user" || name == "type" {
+			continue
+		}
+		if msg.Attributes == nil {
+			msg.Attributes = make(map[string]string)
+		}
+		msg.Attributes[name] = value
+	}
+	return msg, nil
+}
 
+func (d *Dispatcher) route(msg EventMessage) (chan EventMessage, string) {
+	var ch chan EventMessage
 	switch msg.EventType {
 	case "created":
-		select {
-		case d.created_chan <- msg:
-			logger.Process("Evento (CREATED) enviado ao usuário %s", msg.UserID)
-		case <-ctx.Done():
-			d.wg.Done()
-			return
-		}
+		ch = d.created_chan
 	case "updated":
-		select {
-		case d.updated_chan <- msg:
-			logger.Process("Evento (UPDATED) enviado ao usuário %s", msg.UserID)
-		case <-ctx.Done():
-			d.wg.Done()
-			return
-		}
+		ch = d.updated_chan
 	case "deleted":
-		select {
-		case d.deleted_chan <- msg:
-			logger.Process("Evento (DELETED) enviado ao usuário %s", msg.UserID)
-		case <-ctx.Done():
-			d.wg.Done()
-			return
-		}
+		ch = d.deleted_chan
 	default:
+		return nil, ""
+	}
+
+	label := strings.ToUpper(msg.EventType)
+	if len(d.lanes) > 0 {
+		ch = d.lanes[d.laneFor(msg)]
+	}
+	return ch, label
+}
+
+// laneFor escolhe a lane do usuário; o tenant entra na chave porque o mesmo
+// UserID em tenants diferentes são usuários diferentes.
+func (d *Dispatcher) laneFor(msg EventMessage) int {
+	h := fnv.New32a()
+	h.Write([]byte(msg.Tenant))
+	h.Write([]byte{0})
+	h.Write([]byte(msg.UserID))
+	return int(h.Sum32() % uint32(len(d.lanes)))
+}
+
+// Dispatch entrega o evento ao worker do seu tipo. Com o canal cheio, segue
+// a política de overflow; devolve ErrDispatcherFull quando a política é
+// OverflowReject, ou o erro do contexto se ele for cancelado.
+func (d *Dispatcher) Dispatch(ctx context.Context, msg EventMessage) error {
+	ch, label := d.route(msg)
+	if ch == nil {
 		logger.Warning("Tipo de evento desconhecido: %s - usuário %s", msg.EventType, msg.UserID)
+		msg.applied()
+		return nil
+	}
+
+	d.wg.Add(1)
+	if err := d.enqueue(ctx, ch, msg); err != nil {
 		d.wg.Done()
+		return err
 	}
+
+	logger.Process("Evento (%s) enviado ao usuário %s", label, msg.UserID)
+	return nil
 }
 
-func (d *Dispatcher) StartWorkers(ctx context.Context) {
-	go func() {
+func (d *Dispatcher) enqueue(ctx context.Context, ch chan EventMessage, msg EventMessage) error {
+	// Com eventos em disco, os novos entram atrás deles para manter a ordem.
+	if d.spill != nil && d.spill.Pending() > 0 {
+		return d.spillMessage(msg)
+	}
+
+	select {
+	case ch <- msg:
+		return nil
+	default:
+	}
+
+	switch d.overflow {
+	case OverflowDropOldest:
 		for {
 			select {
-			case msg := <-d.created_chan:
-				if err := d.counter.Created(ctx, msg.UserID); err != nil {
-					logger.Error("Erro ao processar evento (CREATED) para usuário %s: %v", msg.UserID, err)
-				}
+			case ch <- msg:
+				return nil
+			default:
+			}
+			select {
+			case oldest := <-ch:
+				logger.Warning("Dispatcher cheio, descartando evento %s do usuário %s", oldest.MessageID, oldest.UserID)
+				d.recordStats(func(s *DispatcherStats) { s.Dropped++ })
+				oldest.dropped()
 				d.wg.Done()
-			case <-ctx.Done():
-				logger.System("Worker (CREATED) parado")
-				return
+			default:
 			}
 		}
-	}()
+	case OverflowReject:
+		d.recordStats(func(s *DispatcherStats) { s.Rejected++ })
+		return ErrDispatcherFull
+	case OverflowSpill:
+		return d.spillMessage(msg)
+	default:
+		start := time.Now()
+		select {
+		case ch <- msg:
+			d.recordStats(func(s *DispatcherStats) {
+				s.BlockedTime += time.Since(start)
+				s.BlockedEvents++
+			})
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
 
-	go func() {
-		for {
-			select {
-			case msg := <-d.updated_chan:
-				if err := d.counter.Updated(ctx, msg.UserID); err != nil {
-					logger.Error("Erro ao processar evento (UPDATED) para usuário %s: %v", msg.UserID, err)
-				}
-				d.wg.Done()
-			case <-ctx.Done():
-				logger.System("Worker (UPDATED) parado")
+func (d *Dispatcher) spillMessage(msg EventMessage) error {
+	if err := d.spill.push(msg); err != nil {
+		return err
+	}
+	d.recordStats(func(s *DispatcherStats) { s.Spilled++ })
+	return nil
+}
+
+// drainSpill devolve aos canais, em ordem, os eventos gravados em disco.
+func (d *Dispatcher) drainSpill(ctx context.Context) {
+	for {
+		msg, err := d.spill.pop(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
 				return
 			}
+			logger.Error("Erro ao recuperar evento do disco: %v", err)
+			if errors.Is(err, errSpillLost) {
+				// O registro saiu da fila sem chegar a um canal: libera o
+				// pendente e descarta o evento para a origem não esperar
+				// para sempre pela confirmação.
+				d.spill.delivered()
+				d.recordStats(func(s *DispatcherStats) { s.Dropped++ })
+				msg.dropped()
+				d.wg.Done()
+			}
+			continue
 		}
-	}()
 
-	go func() {
-		for {
-			select {
-			case msg := <-d.deleted_chan:
-				if err := d.counter.Deleted(ctx, msg.UserID); err != nil {
-					logger.Error("Erro ao processar evento (DELETED) para usuário %s: %v", msg.UserID, err)
-				}
-				d.wg.Done()
-			case <-ctx.Done():
-				logger.System("Worker (DELETED) parado")
+		ch, _ := d.route(msg)
+		select {
+		case ch <- msg:
+			d.spill.delivered()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) recordStats(update func(*DispatcherStats)) {
+	d.stats_mu.Lock()
+	update(&d.stats)
+	d.stats_mu.Unlock()
+}
+
+func (d *Dispatcher) Stats() DispatcherStats {
+	d.stats_mu.Lock()
+	defer d.stats_mu.Unlock()
+	return d.stats
+}
+
+func (d *Dispatcher) counterFor(msg EventMessage) *EventCounter {
+	if d.tenants == nil {
+		return d.counter
+	}
+	return d.tenants.Counter(msg.Tenant)
+}
+
+func (d *Dispatcher) StartWorkers(ctx context.Context) {
+	d.workers_mu.Lock()
+	defer d.workers_mu.Unlock()
+
+	d.workers_ctx = ctx
+	d.scaleLocked()
+	if d.spill != nil {
+		go d.drainSpill(ctx)
+	}
+}
+
+// SetWorkers ajusta quantos workers consomem cada tipo de evento com o
+// dispatcher rodando. Workers removidos terminam o evento em andamento
+// antes de parar, então nada é perdido. No modo ordenado o número de lanes
+// não muda.
+func (d *Dispatcher) SetWorkers(n int) {
+	if n < 1 {
+		return
+	}
+	if len(d.lanes) > 0 {
+		logger.Warning("Modo ordenado usa %d lanes fixas, ignorando workers=%d", len(d.lanes), n)
+		return
+	}
+
+	d.workers_mu.Lock()
+	defer d.workers_mu.Unlock()
+
+	d.workers = n
+	if d.workers_ctx != nil {
+		d.scaleLocked()
+	}
+}
+
+func (d *Dispatcher) Workers() int {
+	if len(d.lanes) > 0 {
+		return len(d.lanes)
+	}
+
+	d.workers_mu.Lock()
+	defer d.workers_mu.Unlock()
+	return len(d.stops)
+}
+
+func (d *Dispatcher) scaleLocked() {
+	ctx := d.workers_ctx
+	if len(d.lanes) > 0 {
+		if len(d.stops) == 0 {
+			stop := make(chan struct{})
+			d.stops = append(d.stops, stop)
+			for i, lane := range d.lanes {
+				go d.work(ctx, stop, fmt.Sprintf("LANE %d", i), lane)
+			}
+		}
+		return
+	}
+
+	for len(d.stops) < d.workers {
+		stop := make(chan struct{})
+		d.stops = append(d.stops, stop)
+		go d.work(ctx, stop, "CREATED", d.created_chan)
+		go d.work(ctx, stop, "UPDATED", d.updated_chan)
+		go d.work(ctx, stop, "DELETED", d.deleted_chan)
+	}
+	for len(d.stops) > d.workers {
+		last := len(d.stops) - 1
+		close(d.stops[last])
+		d.stops = d.stops[:last]
+	}
+}
+
+func (d *Dispatcher) apply(ctx context.Context, msg EventMessage) error {
+	// O contador conta pela chave do agrupamento e admite pelo usuário; o
+	// ciclo de vida e os consumidores registrados continuam por usuário.
+	group_key := msg.groupKey()
+	counter := d.counterFor(msg)
+	if err := counter.Count(ctx, msg.EventType, msg.UserID, group_key); err != nil {
+		return err
+	}
+	if msg.Value != nil {
+		counter.Observe(msg.EventType, group_key, *msg.Value)
+	}
+	if d.lifecycle != nil {
+		if err := applyEvent(d.lifecycle.Tracker(msg.Tenant), ctx, msg); err != nil {
+			return err
+		}
+	}
+	for _, consumer := range d.consumers {
+		if err := applyEvent(consumer, ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyEvent(consumer eventcounter.Consumer, ctx context.Context, msg EventMessage) error {
+	switch msg.EventType {
+	case "created":
+		return consumer.Created(ctx, msg.UserID)
+	case "updated":
+		return consumer.Updated(ctx, msg.UserID)
+	default:
+		return consumer.Deleted(ctx, msg.UserID)
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context, stop <-chan struct{}, label string, ch <-chan EventMessage) {
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
 				return
 			}
+			err := d.apply(ctx, msg)
+			switch {
+			case errors.Is(err, ErrUserQuotaExceeded):
+				logger.Warning("Evento %s recusado (%s): %v", msg.MessageID, strings.ToUpper(msg.EventType), err)
+				d.recordStats(func(s *DispatcherStats) { s.OverQuota++ })
+				msg.dropped()
+			case err != nil:
+				logger.Error("Erro ao processar evento (%s) para usuário %s: %v", strings.ToUpper(msg.EventType), msg.UserID, err)
+				msg.applied()
+			default:
+				msg.applied()
+			}
+			d.wg.Done()
+		case <-stop:
+			return
+		case <-ctx.Done():
+			logger.System("Worker (%s) parado", label)
+			return
 		}
-	}()
+	}
 }
 
 func (d *Dispatcher) WaitForCompletion() {
@@ -132,4 +519,10 @@ func (d *Dispatcher) Close() {
 	close(d.created_chan)
 	close(d.updated_chan)
 	close(d.deleted_chan)
+	for _, lane := range d.lanes {
+		close(lane)
+	}
+	if d.spill != nil {
+		d.spill.Close()
+	}
 }
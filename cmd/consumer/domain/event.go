@@ -1,5 +1,14 @@
 package domain
 
+// Event é o payload de uma mensagem. UserID e EventType são opcionais: a
+// chave de roteamento continua sendo a fonte do usuário e do tipo. Value é
+// o valor numérico opcional agregado por tipo.
 type Event struct {
-	ID string `json:"id"`
+	ID        string   `json:"id"`
+	UserID    string   `json:"user_id,omitempty"`
+	EventType string   `json:"event_type,omitempty"`
+	Value     *float64 `json:"value,omitempty"`
+	// Attributes são os campos extras do payload aceitos por
+	// PayloadRules.Extra, como as dimensões de agrupamento.
+	Attributes map[string]string `json:"-"`
 }
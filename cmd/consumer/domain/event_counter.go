@@ -1,67 +1,129 @@
 package domain
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/Julia-Marcal/eventcounter/pkg/logger"
 )
 
+var EventTypes = []string{"created", "updated", "deleted"}
+
+var ErrUserQuotaExceeded = errors.New("limite de usuários rastreados atingido")
+
 type EventCounter struct {
-	mu        sync.Mutex
-	counters  map[string]map[string]int
-	processed map[string]bool
+	mu           sync.Mutex
+	counters     map[string]map[string]int
+	values       map[string]map[string]*ValueStats
+	columns      []string
+	aggregations Aggregations
+	processed    map[string]bool
+	users        map[string]bool
+	maxUsers     int
 }
 
 func NewEventCounter() *EventCounter {
 	return &EventCounter{
 		counters:  make(map[string]map[string]int),
+		values:    make(map[string]map[string]*ValueStats),
 		processed: make(map[string]bool),
+		users:     make(map[string]bool),
 	}
 }
 
-func (c *EventCounter) Created(ctx context.Context, userID string) error {
+// SetAggregations define as funções de agregação por tipo de evento; só os
+// tipos com funções além de count guardam os valores observados.
+func (c *EventCounter) SetAggregations(aggregations Aggregations) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.aggregations = aggregations
+}
+
+// SetColumns define as colunas que as chaves do contador representam nos
+// resultados (nil = user_id).
+func (c *EventCounter) SetColumns(columns []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.columns = columns
+}
+
+// Observe acumula o valor de um evento já contado nas estatísticas do
+// usuário, se o tipo tiver agregações que precisem dele.
+func (c *EventCounter) Observe(eventType, userID string, value float64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.counters["created"] == nil {
-		c.counters["created"] = make(map[string]int)
+	if !c.aggregations.TracksValues(eventType) {
+		return
+	}
+	if c.values[eventType] == nil {
+		c.values[eventType] = make(map[string]*ValueStats)
 	}
-	c.counters["created"][userID]++
+	stats := c.values[eventType][userID]
+	if stats == nil {
+		stats = &ValueStats{}
+		c.values[eventType][userID] = stats
+	}
+	stats.Add(value)
+}
 
-	logger.Success("(CREATE) Evento processado para usuário %s, total: %d", userID, c.counters["created"][userID])
-	fmt.Println()
+// admit registra o usuário como rastreado, recusando usuários novos quando
+// maxUsers (0 = sem limite) já foi atingido. Deve ser chamado com mu travado.
+func (c *EventCounter) admit(userID string) error {
+	if c.users[userID] {
+		return nil
+	}
+	if c.maxUsers > 0 && len(c.users) >= c.maxUsers {
+		return fmt.Errorf("%w (%d): usuário %s", ErrUserQuotaExceeded, c.maxUsers, userID)
+	}
+	c.users[userID] = true
 	return nil
 }
 
-func (c *EventCounter) Updated(ctx context.Context, userID string) error {
+func (c *EventCounter) TrackedUsers() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return len(c.users)
+}
 
-	if c.counters["updated"] == nil {
-		c.counters["updated"] = make(map[string]int)
-	}
-	c.counters["updated"][userID]++
+func (c *EventCounter) Created(ctx context.Context, userID string) error {
+	return c.Count(ctx, "created", userID, userID)
+}
 
-	logger.Success("(UPDATE) Evento processado para usuário %s, total: %d", userID, c.counters["updated"][userID])
-	fmt.Println()
-	return nil
+func (c *EventCounter) Updated(ctx context.Context, userID string) error {
+	return c.Count(ctx, "updated", userID, userID)
 }
 
 func (c *EventCounter) Deleted(ctx context.Context, userID string) error {
+	return c.Count(ctx, "deleted", userID, userID)
+}
+
+// eventLabels são os rótulos de cada tipo no log.
+var eventLabels = map[string]string{"created": "CREATE", "updated": "UPDATE", "deleted": "DELETE"}
+
+// Count conta um evento sob key, a chave do agrupamento, mas admite pelo
+// usuário real: a cota de usuários vale para usuários mesmo quando o
+// agrupamento (como per-type) não os separa.
+func (c *EventCounter) Count(ctx context.Context, eventType, userID, key string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.counters["deleted"] == nil {
-		c.counters["deleted"] = make(map[string]int)
+	if err := c.admit(userID); err != nil {
+		return err
+	}
+	if c.counters[eventType] == nil {
+		c.counters[eventType] = make(map[string]int)
 	}
-	c.counters["deleted"][userID]++
+	c.counters[eventType][key]++
 
-	logger.Success("(DELETE) Evento processado para usuário %s, total: %d", userID, c.counters["deleted"][userID])
+	logger.Success("(%s) Evento processado para usuário %s, total: %d", eventLabels[eventType], userID, c.counters[eventType][key])
 	fmt.Println()
 	return nil
 }
@@ -78,38 +140,103 @@ func (c *EventCounter) MarkProcessed(messageID string) {
 	c.processed[messageID] = true
 }
 
+// UnmarkProcessed esquece um evento que saiu do pipeline sem ser aplicado,
+// para que a reentrega da mensagem seja contada.
+func (c *EventCounter) UnmarkProcessed(messageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.processed, messageID)
+}
+
+// UserCount é a linha de um usuário nos resultados do agrupamento padrão
+// (per-user).
 type UserCount struct {
 	UserID string `json:"user_id"`
-	Count  int    `json:"count"`
+	RowStats
+}
+
+// RowStats são a contagem e as agregações de uma linha dos resultados. Os
+// campos de valor só aparecem para as funções de agregação configuradas no
+// tipo e para linhas que receberam algum valor.
+type RowStats struct {
+	Count       int                `json:"count"`
+	Sum         *float64           `json:"sum,omitempty"`
+	Min         *float64           `json:"min,omitempty"`
+	Max         *float64           `json:"max,omitempty"`
+	Mean        *float64           `json:"mean,omitempty"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// resultRow escreve as colunas do agrupamento, na ordem configurada, antes
+// da contagem e das agregações.
+type resultRow struct {
+	columns []string
+	values  []string
+	stats   RowStats
+}
+
+func (r resultRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range r.columns {
+		name, _ := json.Marshal(column)
+		value, _ := json.Marshal(r.values[i])
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+		buf.WriteByte(',')
+	}
+	stats, err := json.Marshal(r.stats)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(stats[1:])
+	return buf.Bytes(), nil
 }
 
 func (c *EventCounter) SaveResults() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	resultsDir := "results"
+	return WriteResults("results", c.counters, c.values, c.columns, c.aggregations)
+}
+
+// WriteResults grava um arquivo por tipo de evento com uma linha por chave
+// de agrupamento: as colunas (nil = user_id), a contagem e as agregações de
+// valores configuradas para o tipo.
+func WriteResults(resultsDir string, counters map[string]map[string]int, values map[string]map[string]*ValueStats, columns []string, aggregations Aggregations) error {
 	if err := os.MkdirAll(resultsDir, 0755); err != nil {
 		return fmt.Errorf("falha ao criar diretório results: %w", err)
 	}
+	if columns == nil {
+		columns = []string{DimensionUser}
+	}
 
-	event_types := []string{"created", "updated", "deleted"}
-
-	for _, event_type := range event_types {
+	for _, event_type := range EventTypes {
 		filename := filepath.Join(resultsDir, fmt.Sprintf("%s.json", event_type))
-		data := c.counters[event_type]
+		data := counters[event_type]
 		if data == nil {
 			data = make(map[string]int)
 		}
 
-		var userCounts []UserCount
-		for userID, count := range data {
-			userCounts = append(userCounts, UserCount{
-				UserID: userID,
-				Count:  count,
-			})
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var rows []resultRow
+		for _, key := range keys {
+			row := resultRow{
+				columns: columns,
+				values:  splitGroupKey(key, len(columns)),
+				stats:   RowStats{Count: data[key]},
+			}
+			values[event_type][key].summarize(aggregations[event_type], &row.stats)
+			rows = append(rows, row)
 		}
 
-		json_data, err := json.MarshalIndent(userCounts, "", "  ")
+		json_data, err := json.MarshalIndent(rows, "", "  ")
 		if err != nil {
 			return fmt.Errorf("falha ao usar marshal nos dados de %s: %w", event_type, err)
 		}
@@ -119,7 +246,7 @@ func (c *EventCounter) SaveResults() error {
 			return fmt.Errorf("falha ao escrever no arquivo %s: %w", event_type, err)
 		}
 
-		logger.Success("Salvo %s com %d usuários", filename, len(data))
+		logger.Success("Salvo %s com %d linhas", filename, len(data))
 	}
 
 	return nil
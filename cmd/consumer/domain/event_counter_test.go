@@ -268,6 +268,128 @@ func TestDispatcher_ConcurrentDispatching(t *testing.T) {
 	}
 }
 
+func TestDispatcher_SetWorkersWhileRunning(t *testing.T) {
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithWorkers(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher.StartWorkers(ctx)
+
+	if dispatcher.Workers() != 2 {
+		t.Fatalf("Esperado 2 workers por tipo, obtido %d", dispatcher.Workers())
+	}
+
+	for i := 0; i < 50; i++ {
+		dispatcher.Dispatch(ctx, EventMessage{UserID: "user1", EventType: "created"})
+		if i == 10 {
+			dispatcher.SetWorkers(4)
+		}
+		if i == 30 {
+			dispatcher.SetWorkers(1)
+		}
+	}
+	dispatcher.WaitForCompletion()
+
+	if dispatcher.Workers() != 1 {
+		t.Errorf("Esperado 1 worker por tipo após reduzir, obtido %d", dispatcher.Workers())
+	}
+	if got := counter.Snapshot("t").Totals()["created"]["user1"]; got != 50 {
+		t.Errorf("Nenhum evento deveria se perder ao ajustar workers, contados %d", got)
+	}
+}
+
+// orderRecorder é um eventcounter.Consumer que guarda a sequência de
+// eventos recebida por usuário.
+type orderRecorder struct {
+	mu    sync.Mutex
+	order map[string][]string
+}
+
+func (r *orderRecorder) record(uid, event_type string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order[uid] = append(r.order[uid], event_type)
+	return nil
+}
+
+func (r *orderRecorder) Created(ctx context.Context, uid string) error {
+	return r.record(uid, "created")
+}
+
+func (r *orderRecorder) Updated(ctx context.Context, uid string) error {
+	return r.record(uid, "updated")
+}
+
+func (r *orderRecorder) Deleted(ctx context.Context, uid string) error {
+	return r.record(uid, "deleted")
+}
+
+func TestDispatcher_WithConsumerSeesLaneOrder(t *testing.T) {
+	recorder := &orderRecorder{order: make(map[string][]string)}
+	dispatcher := NewDispatcher(NewEventCounter(), WithOrderedLanes(4), WithCapacity(10), WithConsumer(recorder))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher.StartWorkers(ctx)
+
+	types := []string{"created", "updated", "deleted"}
+	for i := 0; i < 90; i++ {
+		dispatcher.Dispatch(ctx, EventMessage{UserID: fmt.Sprintf("user%d", i%10), EventType: types[(i/10)%len(types)]})
+	}
+	dispatcher.WaitForCompletion()
+
+	for i := 0; i < 10; i++ {
+		user := fmt.Sprintf("user%d", i)
+		var want []string
+		for j := 0; j < 9; j++ {
+			want = append(want, types[j%len(types)])
+		}
+		if fmt.Sprint(recorder.order[user]) != fmt.Sprint(want) {
+			t.Errorf("Consumer recebeu eventos de %s fora de ordem:\nobtido   %v\nesperado %v", user, recorder.order[user], want)
+		}
+	}
+}
+
+func TestDispatcher_OrderedLanesKeepUserOrder(t *testing.T) {
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithOrderedLanes(4), WithCapacity(10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher.StartWorkers(ctx)
+
+	var mu sync.Mutex
+	order := make(map[string][]string)
+	types := []string{"created", "updated", "updated", "deleted"}
+	for i := 0; i < 200; i++ {
+		user := fmt.Sprintf("user%d", i%20)
+		event_type := types[(i/20)%len(types)]
+		dispatcher.Dispatch(ctx, EventMessage{UserID: user, EventType: event_type, OnApplied: func() {
+			mu.Lock()
+			order[user] = append(order[user], event_type)
+			mu.Unlock()
+		}})
+	}
+
+	dispatcher.SetWorkers(8)
+	dispatcher.WaitForCompletion()
+
+	if dispatcher.Workers() != 4 {
+		t.Errorf("Número de lanes não deveria mudar, obtido %d", dispatcher.Workers())
+	}
+	for i := 0; i < 20; i++ {
+		user := fmt.Sprintf("user%d", i)
+		var want []string
+		for j := 0; j < 10; j++ {
+			want = append(want, types[j%len(types)])
+		}
+		if fmt.Sprint(order[user]) != fmt.Sprint(want) {
+			t.Errorf("Eventos de %s fora de ordem:\nobtido   %v\nesperado %v", user, order[user], want)
+		}
+	}
+}
+
 // =============================================================================
 // TESTES DE PERSISTÊNCIA
 // =============================================================================
@@ -0,0 +1,290 @@
+package domain
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ações das regras de filtro.
+const (
+	FilterInclude = "include"
+	FilterExclude = "exclude"
+)
+
+// FilterDefaultRule é a chave dos descartes de eventos que não casaram com
+// nenhuma regra quando há regras de include.
+const FilterDefaultRule = "default"
+
+// Operadores das condições: igualdade, glob (path.Match) e pertença a uma
+// lista separada por |.
+const (
+	opEqual    = "=="
+	opNotEqual = "!="
+	opMatch    = "~"
+	opNotMatch = "!~"
+	opIn       = "in"
+)
+
+// filterCondition compara um campo do evento: user_id, event_type, tenant
+// ou, como nas dimensões de agrupamento, routing.<captura>, header.<nome> e
+// payload.<campo>.
+type filterCondition struct {
+	field  Dimension
+	op     string
+	values []string
+}
+
+func (c filterCondition) String() string {
+	field := c.field.Source + "." + c.field.Name
+	switch c.field.Source {
+	case DimensionUser, "event_type", "tenant":
+		field = c.field.Source
+	}
+	value := strings.Join(c.values, "|")
+	if value == "" || strings.ContainsAny(value, " \t\"") {
+		value = strconv.Quote(value)
+	}
+	return field + " " + c.op + " " + value
+}
+
+func (c filterCondition) matches(value string) bool {
+	switch c.op {
+	case opEqual:
+		return value == c.values[0]
+	case opNotEqual:
+		return value != c.values[0]
+	case opMatch, opNotMatch:
+		matched, _ := path.Match(c.values[0], value)
+		return matched == (c.op == opMatch)
+	default:
+		return containsString(c.values, value)
+	}
+}
+
+// FilterRule inclui ou exclui os eventos que satisfazem todas as suas
+// condições.
+type FilterRule struct {
+	Action     string
+	conditions []filterCondition
+}
+
+// String é a forma canônica da regra, usada como chave das contagens.
+func (r FilterRule) String() string {
+	parts := make([]string, len(r.conditions))
+	for i, c := range r.conditions {
+		parts[i] = c.String()
+	}
+	return r.Action + " " + strings.Join(parts, " and ")
+}
+
+// ParseFilterRule lê uma regra na forma
+//
+//	<include|exclude> <campo> <operador> <valor> [and ...]
+//
+// por exemplo exclude user_id ~ test-* ou include event_type in created|updated.
+// Valores com espaços vão entre aspas.
+func ParseFilterRule(spec string) (FilterRule, error) {
+	tokens, err := filterTokens(spec)
+	if err != nil {
+		return FilterRule{}, err
+	}
+	if len(tokens) == 0 {
+		return FilterRule{}, fmt.Errorf("regra vazia")
+	}
+
+	rule := FilterRule{Action: tokens[0]}
+	if rule.Action != FilterInclude && rule.Action != FilterExclude {
+		return FilterRule{}, fmt.Errorf("regra %q: ação desconhecida %q (use include ou exclude)", spec, rule.Action)
+	}
+
+	rest := tokens[1:]
+	for {
+		if len(rest) < 3 {
+			return FilterRule{}, fmt.Errorf("regra %q: condição incompleta (use <campo> <operador> <valor>)", spec)
+		}
+		condition, err := parseFilterCondition(rest[0], rest[1], rest[2])
+		if err != nil {
+			return FilterRule{}, fmt.Errorf("regra %q: %w", spec, err)
+		}
+		rule.conditions = append(rule.conditions, condition)
+
+		rest = rest[3:]
+		if len(rest) == 0 {
+			return rule, nil
+		}
+		if rest[0] != "and" {
+			return FilterRule{}, fmt.Errorf("regra %q: esperado and, obtido %q", spec, rest[0])
+		}
+		rest = rest[1:]
+	}
+}
+
+func parseFilterCondition(field, op, value string) (filterCondition, error) {
+	condition := filterCondition{op: op, values: []string{value}}
+	switch field {
+	case DimensionUser, "event_type", "tenant":
+		condition.field = Dimension{Source: field, Name: field}
+	default:
+		dimension, err := ParseDimension(field)
+		if err != nil || dimension.Source == DimensionUser {
+			return filterCondition{}, fmt.Errorf("campo desconhecido: %q (use user_id, event_type, tenant, routing.<captura>, header.<nome> ou payload.<campo>)", field)
+		}
+		condition.field = dimension
+	}
+
+	switch op {
+	case opEqual, opNotEqual:
+	case opMatch, opNotMatch:
+		if _, err := path.Match(value, ""); err != nil {
+			return filterCondition{}, fmt.Errorf("padrão inválido: %q", value)
+		}
+	case opIn:
+		condition.values = strings.Split(value, "|")
+	default:
+		return filterCondition{}, fmt.Errorf("operador desconhecido: %q (use ==, !=, ~, !~ ou in)", op)
+	}
+	return condition, nil
+}
+
+// filterTokens separa a regra por espaços, respeitando valores entre aspas.
+func filterTokens(spec string) ([]string, error) {
+	var tokens []string
+	for spec = strings.TrimSpace(spec); spec != ""; spec = strings.TrimSpace(spec) {
+		if spec[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(spec)
+			if err != nil {
+				return nil, fmt.Errorf("aspas não fechadas em %q", spec)
+			}
+			token, _ := strconv.Unquote(quoted)
+			tokens = append(tokens, token)
+			spec = spec[len(quoted):]
+			continue
+		}
+		end := strings.IndexAny(spec, " \t")
+		if end < 0 {
+			end = len(spec)
+		}
+		tokens = append(tokens, spec[:end])
+		spec = spec[end:]
+	}
+	return tokens, nil
+}
+
+// Filter decide, antes do dispatcher, quais eventos são contados. As regras
+// são avaliadas em ordem e a primeira que casar decide; sem nenhuma, o
+// evento passa, a não ser que haja regras de include. Os descartes são
+// contados por regra.
+type Filter struct {
+	rules    []FilterRule
+	includes bool
+
+	mu    sync.Mutex
+	drops map[string]int64
+}
+
+// ParseFilter monta o filtro das regras; sem regras todos os eventos passam.
+func ParseFilter(specs []string) (*Filter, error) {
+	f := &Filter{drops: make(map[string]int64)}
+	for _, spec := range specs {
+		rule, err := ParseFilterRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		f.rules = append(f.rules, rule)
+		f.includes = f.includes || rule.Action == FilterInclude
+	}
+	return f, nil
+}
+
+// PayloadFields são os campos do payload usados pelas regras; a validação
+// os aceita como conhecidos.
+func (f *Filter) PayloadFields() []string {
+	var fields []string
+	for _, rule := range f.rules {
+		for _, c := range rule.conditions {
+			if c.field.Source == DimensionPayload && !containsString(fields, c.field.Name) {
+				fields = append(fields, c.field.Name)
+			}
+		}
+	}
+	return fields
+}
+
+// Allow diz se o evento deve ser contado; quando não, devolve também a
+// regra que o descartou e conta o descarte.
+func (f *Filter) Allow(msg EventMessage, headers map[string]interface{}, payload map[string]string) (bool, string) {
+	for _, rule := range f.rules {
+		if !rule.matches(msg, headers, payload) {
+			continue
+		}
+		if rule.Action == FilterInclude {
+			return true, ""
+		}
+		f.drop(rule.String())
+		return false, rule.String()
+	}
+	if f.includes {
+		f.drop(FilterDefaultRule)
+		return false, FilterDefaultRule
+	}
+	return true, ""
+}
+
+func (r FilterRule) matches(msg EventMessage, headers map[string]interface{}, payload map[string]string) bool {
+	for _, c := range r.conditions {
+		var value string
+		switch c.field.Source {
+		case "event_type":
+			value = msg.EventType
+		case "tenant":
+			value = msg.Tenant
+		default:
+			value = GroupBy{c.field}.Values(msg, headers, payload)[0]
+		}
+		if !c.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) drop(rule string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drops[rule]++
+}
+
+// Drops devolve os descartes por regra.
+func (f *Filter) Drops() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	drops := make(map[string]int64, len(f.drops))
+	for rule, n := range f.drops {
+		drops[rule] = n
+	}
+	return drops
+}
+
+// String lista os descartes na ordem das regras.
+func (f *Filter) String() string {
+	drops := f.Drops()
+	if len(drops) == 0 {
+		return "nenhum"
+	}
+
+	var parts []string
+	for _, rule := range f.rules {
+		if n, ok := drops[rule.String()]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%d", rule, n))
+			delete(drops, rule.String())
+		}
+	}
+	if n, ok := drops[FilterDefaultRule]; ok {
+		parts = append(parts, fmt.Sprintf("%s=%d", FilterDefaultRule, n))
+	}
+	return strings.Join(parts, ", ")
+}
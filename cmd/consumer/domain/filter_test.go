@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE FILTRO
+// =============================================================================
+
+func TestParseFilterRule(t *testing.T) {
+	rule, err := ParseFilterRule(`exclude   user_id ~ test-* and header.x-env == "load test"`)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if got := rule.String(); got != `exclude user_id ~ test-* and header.x-env == "load test"` {
+		t.Errorf("Forma canônica inesperada: %s", got)
+	}
+
+	for _, spec := range []string{
+		"",
+		"drop user_id == a",
+		"exclude user_id",
+		"exclude cookie.x == a",
+		"exclude user_id <> a",
+		"exclude user_id == a or event_type == created",
+		"exclude user_id ~ [",
+		`exclude user_id == "a`,
+	} {
+		if _, err := ParseFilterRule(spec); err == nil {
+			t.Errorf("Regra %q deveria falhar", spec)
+		}
+	}
+}
+
+func TestFilter_Allow(t *testing.T) {
+	filter, err := ParseFilter([]string{
+		"exclude user_id ~ test-*",
+		"exclude payload.source == internal and tenant == acme",
+		"include event_type in created|updated",
+		"include header.x-plan != free",
+	})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if fields := filter.PayloadFields(); len(fields) != 1 || fields[0] != "source" {
+		t.Errorf("Campos do payload inesperados: %v", fields)
+	}
+
+	pro := map[string]interface{}{"x-plan": "pro"}
+	free := map[string]interface{}{"x-plan": "free"}
+	internal := map[string]string{"source": "internal"}
+	cases := []struct {
+		name    string
+		msg     EventMessage
+		headers map[string]interface{}
+		payload map[string]string
+		allowed bool
+		rule    string
+	}{
+		{"usuário de teste", EventMessage{UserID: "test-1", EventType: "created"}, pro, nil, false, "exclude user_id ~ test-*"},
+		{"origem interna do tenant", EventMessage{UserID: "u1", EventType: "created", Tenant: "acme"}, nil, internal, false, "exclude payload.source == internal and tenant == acme"},
+		{"origem interna de outro tenant", EventMessage{UserID: "u1", EventType: "created", Tenant: "beta"}, nil, internal, true, ""},
+		{"tipo incluído", EventMessage{UserID: "u1", EventType: "updated"}, free, nil, true, ""},
+		{"plano pago", EventMessage{UserID: "u1", EventType: "deleted"}, pro, nil, true, ""},
+		{"nenhuma regra", EventMessage{UserID: "u1", EventType: "deleted"}, free, nil, false, FilterDefaultRule},
+	}
+	for _, tc := range cases {
+		allowed, rule := filter.Allow(tc.msg, tc.headers, tc.payload)
+		if allowed != tc.allowed || rule != tc.rule {
+			t.Errorf("%s: esperado (%v, %q), obtido (%v, %q)", tc.name, tc.allowed, tc.rule, allowed, rule)
+		}
+	}
+
+	drops := filter.Drops()
+	if len(drops) != 3 || drops["exclude user_id ~ test-*"] != 1 || drops[FilterDefaultRule] != 1 {
+		t.Errorf("Descartes inesperados: %v", drops)
+	}
+	if got := filter.String(); got != "exclude user_id ~ test-*=1, exclude payload.source == internal and tenant == acme=1, default=1" {
+		t.Errorf("Resumo inesperado: %s", got)
+	}
+}
+
+func TestFilter_EmptyAllowsAll(t *testing.T) {
+	filter, _ := ParseFilter(nil)
+	if allowed, _ := filter.Allow(EventMessage{UserID: "test-1"}, nil, nil); !allowed {
+		t.Error("Filtro sem regras deveria aceitar tudo")
+	}
+	if filter.String() != "nenhum" {
+		t.Errorf("Resumo inesperado: %s", filter)
+	}
+}
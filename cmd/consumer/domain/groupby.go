@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Origens das dimensões de agrupamento. user_id é o usuário do evento; as
+// demais são escritas como origem.nome, por exemplo routing.region,
+// header.x-plan ou payload.plan.
+const (
+	DimensionUser    = "user_id"
+	DimensionRouting = "routing"
+	DimensionHeader  = "header"
+	DimensionPayload = "payload"
+)
+
+// DefaultGroupByPreset agrupa por usuário, como os resultados sempre foram.
+const DefaultGroupByPreset = "per-user"
+
+// GroupByPresets são agrupamentos prontos; group_by.dimensions, quando
+// informado, tem precedência sobre o preset.
+var GroupByPresets = map[string][]string{
+	"per-user": {DimensionUser},
+	"per-type": {},
+}
+
+// groupKeySeparator separa os valores de uma chave composta; com uma única
+// dimensão a chave é o próprio valor, compatível com os snapshots por
+// usuário.
+const groupKeySeparator = "\x1f"
+
+// reservedColumns são as colunas de contagem e agregação dos resultados.
+var reservedColumns = map[string]bool{
+	"count": true, AggSum: true, AggMin: true, AggMax: true, AggMean: true, "percentiles": true,
+}
+
+// Dimension é uma coluna de agrupamento: de onde vem o valor e o nome da
+// coluna (e do campo de origem).
+type Dimension struct {
+	Source string
+	Name   string
+}
+
+func ParseDimension(spec string) (Dimension, error) {
+	if spec == DimensionUser {
+		return Dimension{Source: DimensionUser, Name: DimensionUser}, nil
+	}
+	source, name, ok := strings.Cut(spec, ".")
+	if ok && name != "" {
+		switch source {
+		case DimensionRouting, DimensionHeader, DimensionPayload:
+			return Dimension{Source: source, Name: name}, nil
+		}
+	}
+	return Dimension{}, fmt.Errorf("dimensão desconhecida: %q (use user_id, routing.<captura>, header.<nome> ou payload.<campo>)", spec)
+}
+
+// GroupBy são as dimensões que, junto com o tipo de evento, formam a chave
+// de cada contagem.
+type GroupBy []Dimension
+
+// ParseGroupBy monta o agrupamento das dimensões ou, sem elas, do preset.
+func ParseGroupBy(preset string, dimensions []string) (GroupBy, error) {
+	specs := dimensions
+	if len(specs) == 0 {
+		var ok bool
+		if specs, ok = GroupByPresets[preset]; !ok {
+			names := make([]string, 0, len(GroupByPresets))
+			for name := range GroupByPresets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("preset desconhecido: %q (use %s)", preset, strings.Join(names, ", "))
+		}
+	}
+
+	group_by := make(GroupBy, 0, len(specs))
+	columns := make(map[string]bool)
+	for _, spec := range specs {
+		dimension, err := ParseDimension(spec)
+		if err != nil {
+			return nil, err
+		}
+		if reservedColumns[dimension.Name] || columns[dimension.Name] {
+			return nil, fmt.Errorf("coluna %q repetida ou reservada", dimension.Name)
+		}
+		columns[dimension.Name] = true
+		group_by = append(group_by, dimension)
+	}
+	return group_by, nil
+}
+
+func (g GroupBy) Columns() []string {
+	columns := make([]string, len(g))
+	for i, dimension := range g {
+		columns[i] = dimension.Name
+	}
+	return columns
+}
+
+// PayloadFields são os campos do payload usados como dimensão; a validação
+// os aceita como conhecidos.
+func (g GroupBy) PayloadFields() []string {
+	var fields []string
+	for _, dimension := range g {
+		if dimension.Source == DimensionPayload {
+			fields = append(fields, dimension.Name)
+		}
+	}
+	return fields
+}
+
+// Values resolve as dimensões de um evento; dimensões ausentes ficam
+// vazias.
+func (g GroupBy) Values(msg EventMessage, headers map[string]interface{}, payload map[string]string) []string {
+	values := make([]string, len(g))
+	for i, dimension := range g {
+		switch dimension.Source {
+		case DimensionUser:
+			values[i] = msg.UserID
+		case DimensionRouting:
+			values[i] = msg.Attributes[dimension.Name]
+		case DimensionHeader:
+			if value, ok := headers[dimension.Name]; ok && value != nil {
+				values[i] = fmt.Sprint(value)
+			}
+		case DimensionPayload:
+			values[i] = payload[dimension.Name]
+		}
+	}
+	return values
+}
+
+func GroupKey(values []string) string {
+	return strings.Join(values, groupKeySeparator)
+}
+
+// splitGroupKey separa a chave nas n colunas; chaves antigas (só o
+// usuário) viram a primeira coluna.
+func splitGroupKey(key string, n int) []string {
+	if n <= 1 {
+		return []string{key}[:n]
+	}
+	values := strings.SplitN(key, groupKeySeparator, n)
+	for len(values) < n {
+		values = append(values, "")
+	}
+	return values
+}
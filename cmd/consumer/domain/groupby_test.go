@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE AGRUPAMENTO
+// =============================================================================
+
+func TestParseGroupBy(t *testing.T) {
+	group_by, err := ParseGroupBy(DefaultGroupByPreset, nil)
+	if err != nil || len(group_by) != 1 || group_by[0].Source != DimensionUser {
+		t.Errorf("Preset per-user inesperado: %v (%v)", group_by, err)
+	}
+
+	group_by, err = ParseGroupBy("per-type", nil)
+	if err != nil || group_by == nil || len(group_by) != 0 {
+		t.Errorf("Preset per-type deveria não ter dimensões: %v (%v)", group_by, err)
+	}
+
+	group_by, err = ParseGroupBy("ignorado", []string{"routing.region", "header.x-plan", "payload.source"})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if got := strings.Join(group_by.Columns(), ","); got != "region,x-plan,source" {
+		t.Errorf("Colunas inesperadas: %s", got)
+	}
+	if fields := group_by.PayloadFields(); len(fields) != 1 || fields[0] != "source" {
+		t.Errorf("Campos do payload inesperados: %v", fields)
+	}
+
+	for _, dimensions := range [][]string{{"region"}, {"cookie.x"}, {"header.plan", "payload.plan"}, {"payload.count"}} {
+		if _, err := ParseGroupBy(DefaultGroupByPreset, dimensions); err == nil {
+			t.Errorf("Dimensões %v deveriam falhar", dimensions)
+		}
+	}
+	if _, err := ParseGroupBy("per-region", nil); err == nil {
+		t.Error("Preset desconhecido deveria falhar")
+	}
+}
+
+func TestGroupBy_ValuesAndResults(t *testing.T) {
+	group_by, _ := ParseGroupBy("", []string{"routing.region", "header.x-plan", "payload.source"})
+	msg := EventMessage{UserID: "user1", EventType: "created", Attributes: map[string]string{"region": "eu"}}
+
+	values := group_by.Values(msg, map[string]interface{}{"x-plan": "pro"}, map[string]string{"source": "web"})
+	if strings.Join(values, ",") != "eu,pro,web" {
+		t.Fatalf("Valores inesperados: %v", values)
+	}
+	if missing := group_by.Values(msg, nil, nil); strings.Join(missing, ",") != "eu,," {
+		t.Errorf("Dimensões ausentes deveriam ficar vazias: %v", missing)
+	}
+
+	counter := NewEventCounter()
+	counter.SetColumns(group_by.Columns())
+	dispatcher := NewDispatcher(counter)
+	defer dispatcher.Close()
+	ctx := context.Background()
+	dispatcher.StartWorkers(ctx)
+
+	msg.Group = values
+	dispatcher.Dispatch(ctx, msg)
+	msg.UserID = "user2"
+	dispatcher.Dispatch(ctx, msg)
+	dispatcher.WaitForCompletion()
+
+	if got := counter.Snapshot("a").Totals()["created"][GroupKey(values)]; got != 2 {
+		t.Errorf("Usuários da mesma chave deveriam somar, obtido %d", got)
+	}
+
+	dir := t.TempDir()
+	if err := WriteResults(dir, counter.counters, counter.values, counter.columns, counter.aggregations); err != nil {
+		t.Fatalf("Erro ao salvar resultados: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "created.json"))
+	if !strings.Contains(string(data), `"region": "eu",
+    "x-plan": "pro",
+    "source": "web",
+    "count": 2`) {
+		t.Errorf("Colunas fora da ordem configurada: %s", data)
+	}
+}
+
+func TestGroupBy_PerTypeAdmitsRealUsers(t *testing.T) {
+	group_by, _ := ParseGroupBy("per-type", nil)
+	tenants := NewTenantRegistry(NewEventCounter(), 2)
+	counter := tenants.Counter(DefaultTenant)
+	counter.SetColumns(group_by.Columns())
+	dispatcher := NewDispatcher(counter, WithTenants(tenants))
+	defer dispatcher.Close()
+	ctx := context.Background()
+	dispatcher.StartWorkers(ctx)
+
+	for _, user := range []string{"user1", "user2", "user1", "user3"} {
+		msg := EventMessage{UserID: user, EventType: "created"}
+		msg.Group = group_by.Values(msg, nil, nil)
+		dispatcher.Dispatch(ctx, msg)
+	}
+	dispatcher.WaitForCompletion()
+
+	if got := counter.Snapshot("a").Totals()["created"][GroupKey(nil)]; got != 3 {
+		t.Errorf("Esperados 3 eventos contados sob a chave do tipo, obtido %d", got)
+	}
+	if got := counter.TrackedUsers(); got != 2 {
+		t.Errorf("Cota deveria valer para usuários reais, rastreados %d", got)
+	}
+	if over := dispatcher.Stats().OverQuota; over != 1 {
+		t.Errorf("Esperado 1 evento recusado pela cota (user3), obtido %d", over)
+	}
+}
@@ -0,0 +1,332 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+)
+
+// Estados de um usuário no LifecycleTracker. UserUnknown é o de quem só
+// recebeu eventos inválidos antes de ser criado.
+const (
+	UserUnknown = "unknown"
+	UserActive  = "active"
+	UserDeleted = "deleted"
+)
+
+// Tipos de anomalia registrados no relatório.
+const (
+	AnomalyUpdateBeforeCreate = "update_before_create"
+	AnomalyDeleteBeforeCreate = "delete_before_create"
+	AnomalyDuplicateCreate    = "duplicate_create"
+	AnomalyDuplicateDelete    = "duplicate_delete"
+	AnomalyUpdateAfterDelete  = "update_after_delete"
+)
+
+const AnomaliesFile = "anomalies.json"
+
+// MaxLifecycleAnomalies limita quantas anomalias cada tracker guarda; as
+// seguintes só entram nos totais por tipo.
+const MaxLifecycleAnomalies = 10000
+
+var _ eventcounter.Consumer = (*LifecycleTracker)(nil)
+
+type LifecycleAnomaly struct {
+	UserID    string `json:"user_id"`
+	EventType string `json:"event_type"`
+	State     string `json:"state"`
+	Kind      string `json:"kind"`
+}
+
+type UserLifecycle struct {
+	UserID             string `json:"user_id"`
+	State              string `json:"state"`
+	UpdatesAfterDelete int    `json:"updates_after_delete,omitempty"`
+}
+
+// LifecycleReport é o conteúdo de anomalies.json e do estado gravado por
+// instância. Totals conta todas as anomalias por tipo; Omitted diz quantas
+// ficaram fora de Anomalies por causa de MaxLifecycleAnomalies.
+type LifecycleReport struct {
+	Users     []UserLifecycle    `json:"users"`
+	Anomalies []LifecycleAnomaly `json:"anomalies"`
+	Totals    map[string]int     `json:"totals"`
+	Omitted   int                `json:"omitted,omitempty"`
+}
+
+// LifecycleTracker acompanha o estado de cada usuário (criado, removido)
+// a partir da sequência de eventos e registra transições inválidas. Como
+// depende da ordem dos eventos de cada usuário, deve rodar com o
+// dispatcher em lanes ordenadas.
+type LifecycleTracker struct {
+	mu        sync.Mutex
+	users     map[string]*UserLifecycle
+	anomalies []LifecycleAnomaly
+	totals    map[string]int
+	omitted   int
+	limit     int
+}
+
+func NewLifecycleTracker() *LifecycleTracker {
+	return &LifecycleTracker{
+		users:  make(map[string]*UserLifecycle),
+		totals: make(map[string]int),
+		limit:  MaxLifecycleAnomalies,
+	}
+}
+
+func (l *LifecycleTracker) Created(ctx context.Context, uid string) error {
+	return l.transition(ctx, uid, "created")
+}
+
+func (l *LifecycleTracker) Updated(ctx context.Context, uid string) error {
+	return l.transition(ctx, uid, "updated")
+}
+
+func (l *LifecycleTracker) Deleted(ctx context.Context, uid string) error {
+	return l.transition(ctx, uid, "deleted")
+}
+
+func (l *LifecycleTracker) transition(ctx context.Context, uid, event_type string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	user, ok := l.users[uid]
+	if !ok {
+		user = &UserLifecycle{UserID: uid, State: UserUnknown}
+		l.users[uid] = user
+	}
+
+	anomaly := ""
+	switch event_type {
+	case "created":
+		if user.State == UserActive {
+			anomaly = AnomalyDuplicateCreate
+		}
+		user.State = UserActive
+	case "updated":
+		switch user.State {
+		case UserUnknown:
+			anomaly = AnomalyUpdateBeforeCreate
+		case UserDeleted:
+			anomaly = AnomalyUpdateAfterDelete
+			user.UpdatesAfterDelete++
+		}
+	case "deleted":
+		switch user.State {
+		case UserUnknown:
+			anomaly = AnomalyDeleteBeforeCreate
+		case UserDeleted:
+			anomaly = AnomalyDuplicateDelete
+		}
+		user.State = UserDeleted
+	}
+
+	if anomaly != "" {
+		logger.Warning("Anomalia de ciclo de vida: %s para usuário %s (%s)", event_type, uid, anomaly)
+		l.totals[anomaly]++
+		if len(l.anomalies) < l.limit {
+			l.anomalies = append(l.anomalies, LifecycleAnomaly{UserID: uid, EventType: event_type, State: user.State, Kind: anomaly})
+		} else {
+			l.omitted++
+		}
+	}
+	return nil
+}
+
+// State devolve o estado atual do usuário; ok é falso se ele nunca apareceu.
+func (l *LifecycleTracker) State(uid string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	user, ok := l.users[uid]
+	if !ok {
+		return "", false
+	}
+	return user.State, true
+}
+
+func (l *LifecycleTracker) Report() LifecycleReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := LifecycleReport{
+		Users:     make([]UserLifecycle, 0, len(l.users)),
+		Anomalies: append([]LifecycleAnomaly{}, l.anomalies...),
+		Totals:    make(map[string]int, len(l.totals)),
+		Omitted:   l.omitted,
+	}
+	for kind, total := range l.totals {
+		report.Totals[kind] = total
+	}
+	for _, user := range l.users {
+		report.Users = append(report.Users, *user)
+	}
+	sort.Slice(report.Users, func(i, j int) bool { return report.Users[i].UserID < report.Users[j].UserID })
+	return report
+}
+
+// Restore retoma o estado gravado por SaveState, para que uma instância
+// reiniciada não acuse update_before_create nos usuários que já conhecia.
+func (l *LifecycleTracker) Restore(report LifecycleReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, user := range report.Users {
+		restored := user
+		l.users[user.UserID] = &restored
+	}
+	l.anomalies = append(l.anomalies[:0], report.Anomalies...)
+	if len(l.anomalies) > l.limit {
+		l.anomalies = l.anomalies[:l.limit]
+	}
+	for kind, total := range report.Totals {
+		l.totals[kind] = total
+	}
+	l.omitted = report.Omitted
+}
+
+// SaveReport grava o relatório em dir/anomalies.json, ao lado dos arquivos
+// de contagem.
+func (l *LifecycleTracker) SaveReport(dir string) error {
+	report := l.Report()
+	filename := filepath.Join(dir, AnomaliesFile)
+	if err := saveLifecycleReport(filename, report); err != nil {
+		return err
+	}
+	logger.Success("Salvo %s com %d anomalias", filename, len(report.Anomalies))
+	return nil
+}
+
+// SaveState grava o estado do tracker em path, ao lado do snapshot da
+// instância.
+func (l *LifecycleTracker) SaveState(path string) error {
+	return saveLifecycleReport(path, l.Report())
+}
+
+func saveLifecycleReport(path string, report LifecycleReport) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("falha ao criar diretório results: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("falha ao usar marshal no relatório de anomalias: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("falha ao escrever no arquivo %s: %w", path, err)
+	}
+	return nil
+}
+
+func LoadLifecycleState(path string) (LifecycleReport, error) {
+	var report LifecycleReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, fmt.Errorf("falha ao ler estado do ciclo de vida %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, fmt.Errorf("falha ao deserializar estado do ciclo de vida %s: %w", path, err)
+	}
+	return report, nil
+}
+
+func LifecycleStatePath(dir, instanceID string) string {
+	return filepath.Join(dir, fmt.Sprintf("lifecycle-%s.json", instanceID))
+}
+
+// LifecycleRegistry mantém um LifecycleTracker por tenant, espelhando o
+// TenantRegistry.
+type LifecycleRegistry struct {
+	mu       sync.Mutex
+	trackers map[string]*LifecycleTracker
+}
+
+func NewLifecycleRegistry() *LifecycleRegistry {
+	return &LifecycleRegistry{trackers: make(map[string]*LifecycleTracker)}
+}
+
+func (r *LifecycleRegistry) Tracker(tenant string) *LifecycleTracker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tracker, ok := r.trackers[tenant]
+	if !ok {
+		tracker = NewLifecycleTracker()
+		r.trackers[tenant] = tracker
+	}
+	return tracker
+}
+
+func (r *LifecycleRegistry) SaveReports(root string) error {
+	r.mu.Lock()
+	tenants := make([]string, 0, len(r.trackers))
+	for tenant := range r.trackers {
+		tenants = append(tenants, tenant)
+	}
+	r.mu.Unlock()
+	sort.Strings(tenants)
+
+	for _, tenant := range tenants {
+		if err := r.Tracker(tenant).SaveReport(TenantDir(root, tenant)); err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+// SaveStates grava o estado de cada tenant em
+// <tenant>/lifecycle-<instanceID>.json, junto dos snapshots.
+func (r *LifecycleRegistry) SaveStates(root, instanceID string) error {
+	r.mu.Lock()
+	tenants := make([]string, 0, len(r.trackers))
+	for tenant := range r.trackers {
+		tenants = append(tenants, tenant)
+	}
+	r.mu.Unlock()
+
+	for _, tenant := range tenants {
+		if err := r.Tracker(tenant).SaveState(LifecycleStatePath(TenantDir(root, tenant), instanceID)); err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+// RestoreStates carrega os estados que instanceID já gravou em root e nos
+// diretórios dos tenants, como TenantRegistry.RestoreSnapshots, e devolve
+// quantos foram retomados.
+func (r *LifecycleRegistry) RestoreStates(root, instanceID string) (int, error) {
+	tenants, err := storedTenants(root)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, tenant := range tenants {
+		path := LifecycleStatePath(TenantDir(root, tenant), instanceID)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		report, err := LoadLifecycleState(path)
+		if err != nil {
+			return restored, err
+		}
+		r.Tracker(tenant).Restore(report)
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE CICLO DE VIDA
+// =============================================================================
+
+func TestLifecycleTracker_StatesAndAnomalies(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewLifecycleTracker()
+
+	tracker.Created(ctx, "alice")
+	tracker.Updated(ctx, "alice")
+	tracker.Deleted(ctx, "alice")
+	tracker.Updated(ctx, "alice")
+	tracker.Updated(ctx, "alice")
+
+	tracker.Updated(ctx, "bob")
+	tracker.Created(ctx, "bob")
+	tracker.Created(ctx, "bob")
+
+	tracker.Deleted(ctx, "carol")
+	tracker.Deleted(ctx, "carol")
+
+	tracker.Created(ctx, "dave")
+
+	for user, want := range map[string]string{"alice": UserDeleted, "bob": UserActive, "carol": UserDeleted, "dave": UserActive} {
+		if got, _ := tracker.State(user); got != want {
+			t.Errorf("Estado de %s: esperado %s, obtido %s", user, want, got)
+		}
+	}
+	if _, ok := tracker.State("erin"); ok {
+		t.Error("Usuário sem eventos não deveria ter estado")
+	}
+
+	report := tracker.Report()
+	var kinds []string
+	for _, anomaly := range report.Anomalies {
+		kinds = append(kinds, anomaly.UserID+":"+anomaly.Kind)
+	}
+	want := []string{
+		"alice:" + AnomalyUpdateAfterDelete,
+		"alice:" + AnomalyUpdateAfterDelete,
+		"bob:" + AnomalyUpdateBeforeCreate,
+		"bob:" + AnomalyDuplicateCreate,
+		"carol:" + AnomalyDeleteBeforeCreate,
+		"carol:" + AnomalyDuplicateDelete,
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("Esperadas %d anomalias, obtidas %v", len(want), kinds)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("Anomalia %d: esperado %s, obtido %s", i, want[i], kinds[i])
+		}
+	}
+
+	if report.Users[0].UserID != "alice" || report.Users[0].UpdatesAfterDelete != 2 {
+		t.Errorf("Esperadas 2 atualizações após remoção de alice, obtido %+v", report.Users[0])
+	}
+}
+
+func TestDispatcher_LifecycleReportPerTenant(t *testing.T) {
+	tenants := NewTenantRegistry(NewEventCounter(), 0)
+	lifecycle := NewLifecycleRegistry()
+	dispatcher := NewDispatcher(tenants.Counter(DefaultTenant),
+		WithTenants(tenants),
+		WithLifecycle(lifecycle),
+		WithOrderedLanes(4),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher.StartWorkers(ctx)
+
+	for _, event_type := range []string{"created", "deleted", "updated"} {
+		dispatcher.Dispatch(ctx, EventMessage{UserID: "user1", EventType: event_type, Tenant: "acme"})
+		dispatcher.Dispatch(ctx, EventMessage{UserID: "user1", EventType: "created"})
+	}
+	dispatcher.WaitForCompletion()
+
+	root := t.TempDir()
+	if err := lifecycle.SaveReports(root); err != nil {
+		t.Fatalf("Erro ao salvar relatórios: %v", err)
+	}
+
+	var acme LifecycleReport
+	data, err := os.ReadFile(filepath.Join(root, "acme", AnomaliesFile))
+	if err != nil {
+		t.Fatalf("Relatório de acme não gravado: %v", err)
+	}
+	json.Unmarshal(data, &acme)
+	if len(acme.Anomalies) != 1 || acme.Anomalies[0].Kind != AnomalyUpdateAfterDelete {
+		t.Errorf("Esperada uma atualização após remoção em acme, obtido %+v", acme.Anomalies)
+	}
+
+	var base LifecycleReport
+	data, _ = os.ReadFile(filepath.Join(root, AnomaliesFile))
+	json.Unmarshal(data, &base)
+	if len(base.Anomalies) != 2 || base.Anomalies[0].Kind != AnomalyDuplicateCreate {
+		t.Errorf("Esperados dois created duplicados no tenant padrão, obtido %+v", base.Anomalies)
+	}
+}
+
+func TestLifecycleTracker_CapsAnomalies(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewLifecycleTracker()
+	tracker.limit = 2
+
+	for i := 0; i < 5; i++ {
+		tracker.Updated(ctx, "alice")
+	}
+	tracker.Deleted(ctx, "bob")
+
+	report := tracker.Report()
+	if len(report.Anomalies) != 2 || report.Omitted != 4 {
+		t.Errorf("Esperadas 2 anomalias e 4 omitidas, obtidas %d e %d", len(report.Anomalies), report.Omitted)
+	}
+	if report.Totals[AnomalyUpdateBeforeCreate] != 5 || report.Totals[AnomalyDeleteBeforeCreate] != 1 {
+		t.Errorf("Totais por tipo incorretos: %v", report.Totals)
+	}
+}
+
+func TestLifecycleRegistry_RestoresStateAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	before := NewLifecycleRegistry()
+	before.Tracker(DefaultTenant).Created(ctx, "alice")
+	before.Tracker("acme").Created(ctx, "bob")
+	before.Tracker("acme").Deleted(ctx, "bob")
+	before.Tracker("acme").Deleted(ctx, "bob")
+	if err := before.SaveStates(dir, "a"); err != nil {
+		t.Fatalf("Erro ao salvar estados: %v", err)
+	}
+
+	after := NewLifecycleRegistry()
+	restored, err := after.RestoreStates(dir, "a")
+	if err != nil || restored != 2 {
+		t.Fatalf("Esperados 2 estados retomados, obtidos %d (%v)", restored, err)
+	}
+	if other, _ := NewLifecycleRegistry().RestoreStates(dir, "b"); other != 0 {
+		t.Errorf("Outra instância não deveria retomar estados, obtidos %d", other)
+	}
+
+	after.Tracker(DefaultTenant).Updated(ctx, "alice")
+	if report := after.Tracker(DefaultTenant).Report(); len(report.Anomalies) != 0 {
+		t.Errorf("Usuário criado antes do reinício não deveria gerar anomalia: %v", report.Anomalies)
+	}
+	if state, _ := after.Tracker("acme").State("bob"); state != UserDeleted {
+		t.Errorf("Estado de bob: esperado %s, obtido %s", UserDeleted, state)
+	}
+	if report := after.Tracker("acme").Report(); report.Totals[AnomalyDuplicateDelete] != 1 || len(report.Anomalies) != 1 {
+		t.Errorf("Anomalias anteriores ao reinício deveriam ser mantidas: %+v", report)
+	}
+}
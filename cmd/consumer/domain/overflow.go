@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy define o que Dispatch faz quando o canal do tipo de evento
+// está cheio.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock espera espaço no canal, segurando a leitura da origem.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest descarta o evento mais antigo do canal para abrir
+	// espaço; o descartado recebe OnDropped.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowReject devolve ErrDispatcherFull para a origem rejeitar a
+	// mensagem e recebê-la de novo mais tarde.
+	OverflowReject OverflowPolicy = "reject-and-nack"
+	// OverflowSpill grava o excedente em disco e o reenvia em ordem quando
+	// houver espaço.
+	OverflowSpill OverflowPolicy = "spill-to-disk"
+)
+
+var ErrDispatcherFull = errors.New("dispatcher cheio")
+
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(name); policy {
+	case OverflowBlock, OverflowDropOldest, OverflowReject, OverflowSpill:
+		return policy, nil
+	}
+	return "", fmt.Errorf("política de overflow desconhecida: %q (use block, drop-oldest, reject-and-nack ou spill-to-disk)", name)
+}
+
+// DispatcherStats acumula o efeito da política de overflow: quanto tempo e
+// quantos eventos ficaram bloqueados esperando espaço, e quantos foram
+// descartados, rejeitados ou gravados em disco.
+type DispatcherStats struct {
+	BlockedTime   time.Duration
+	BlockedEvents int64
+	Dropped       int64
+	Rejected      int64
+	Spilled       int64
+	// OverQuota conta os eventos recusados pela cota de usuários do tenant.
+	OverQuota int64
+}
+
+func (s DispatcherStats) String() string {
+	return fmt.Sprintf("bloqueado %s em %d eventos, %d descartados, %d rejeitados, %d em disco, %d acima da cota",
+		s.BlockedTime, s.BlockedEvents, s.Dropped, s.Rejected, s.Spilled, s.OverQuota)
+}
+
+// spillRecord é a parte serializável do evento. O índice (offset de cada
+// registro) e os callbacks de confirmação ficam em memória, pois a mensagem
+// continua pendente na origem até ser aplicada.
+type spillRecord struct {
+	UserID     string            `json:"user_id"`
+	EventType  string            `json:"event_type"`
+	MessageID  string            `json:"message_id"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Value      *float64          `json:"value,omitempty"`
+	Group      []string          `json:"group"`
+}
+
+type spillEntry struct {
+	offset  int64
+	length  int
+	applied func()
+	dropped func()
+}
+
+// spillQueue é uma fila FIFO em um arquivo NDJSON. O arquivo é truncado
+// sempre que esvazia, então só cresce enquanto o excedente durar.
+type spillQueue struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries []spillEntry
+	size    int64
+	pending int
+	ready   chan struct{}
+}
+
+func newSpillQueue(dir string) (*spillQueue, error) {
+	file, err := os.CreateTemp(dir, "dispatcher-spill-*.ndjson")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar arquivo de spill: %w", err)
+	}
+	return &spillQueue{file: file, ready: make(chan struct{}, 1)}, nil
+}
+
+// Pending conta os eventos gravados que ainda não chegaram a um canal.
+func (q *spillQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+func (q *spillQueue) push(msg EventMessage) error {
+	data, err := json.Marshal(spillRecord{
+		UserID:     msg.UserID,
+		EventType:  msg.EventType,
+		MessageID:  msg.MessageID,
+		Tenant:     msg.Tenant,
+		Attributes: msg.Attributes,
+		Value:      msg.Value,
+		Group:      msg.Group,
+	})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.file.WriteAt(data, q.size); err != nil {
+		return fmt.Errorf("erro ao gravar spill: %w", err)
+	}
+	q.entries = append(q.entries, spillEntry{offset: q.size, length: len(data), applied: msg.OnApplied, dropped: msg.OnDropped})
+	q.size += int64(len(data))
+	q.pending++
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// errSpillLost indica um registro que não pôde ser lido do disco. O evento
+// devolvido junto carrega apenas o OnDropped do registro perdido.
+var errSpillLost = errors.New("evento em disco perdido")
+
+// pop lê o próximo evento gravado, esperando se não houver nenhum.
+func (q *spillQueue) pop(ctx context.Context) (EventMessage, error) {
+	for {
+		q.mu.Lock()
+		if len(q.entries) > 0 {
+			entry := q.entries[0]
+			q.entries = q.entries[1:]
+			data := make([]byte, entry.length)
+			_, err := q.file.ReadAt(data, entry.offset)
+			q.mu.Unlock()
+			lost := EventMessage{OnDropped: entry.dropped}
+			if err != nil {
+				return lost, fmt.Errorf("%w: erro ao ler spill: %v", errSpillLost, err)
+			}
+
+			var record spillRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return lost, fmt.Errorf("%w: registro de spill inválido: %v", errSpillLost, err)
+			}
+			return EventMessage{
+				UserID:     record.UserID,
+				EventType:  record.EventType,
+				MessageID:  record.MessageID,
+				Tenant:     record.Tenant,
+				Attributes: record.Attributes,
+				Value:      record.Value,
+				Group:      record.Group,
+				OnApplied:  entry.applied,
+				OnDropped:  entry.dropped,
+			}, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return EventMessage{}, ctx.Err()
+		}
+	}
+}
+
+// delivered marca que um evento lido chegou ao canal; quando nada mais está
+// pendente, o arquivo é truncado.
+func (q *spillQueue) delivered() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending--
+	if q.pending == 0 && len(q.entries) == 0 {
+		q.file.Truncate(0)
+		q.size = 0
+	}
+}
+
+func (q *spillQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	name := q.file.Name()
+	q.file.Close()
+	return os.Remove(name)
+}
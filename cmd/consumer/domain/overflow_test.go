@@ -0,0 +1,242 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// overflowRun registra, em ordem, os eventos aplicados e descartados.
+type overflowRun struct {
+	mu      sync.Mutex
+	applied []string
+	dropped []string
+}
+
+func (r *overflowRun) message(i int) EventMessage {
+	id := fmt.Sprintf("msg-%d", i)
+	return EventMessage{
+		UserID:    "user1",
+		EventType: "created",
+		MessageID: id,
+		OnApplied: func() {
+			r.mu.Lock()
+			r.applied = append(r.applied, id)
+			r.mu.Unlock()
+		},
+		OnDropped: func() {
+			r.mu.Lock()
+			r.dropped = append(r.dropped, id)
+			r.mu.Unlock()
+		},
+	}
+}
+
+func (r *overflowRun) result() ([]string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.applied...), append([]string(nil), r.dropped...)
+}
+
+// Os workers só começam depois dos cinco Dispatch, simulando um consumidor
+// lento com capacidade 2.
+const overflowEvents = 5
+
+func TestDispatcher_OverflowBlock(t *testing.T) {
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithCapacity(2), WithOverflowPolicy(OverflowBlock, ""))
+	run := &overflowRun{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < overflowEvents; i++ {
+			if err := dispatcher.Dispatch(ctx, run.message(i)); err != nil {
+				t.Errorf("Dispatch não deveria falhar: %v", err)
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Dispatch deveria bloquear com o canal cheio")
+	default:
+	}
+
+	dispatcher.StartWorkers(ctx)
+	<-done
+	dispatcher.WaitForCompletion()
+
+	applied, _ := run.result()
+	if len(applied) != overflowEvents {
+		t.Errorf("Esperados %d eventos aplicados, obtidos %d", overflowEvents, len(applied))
+	}
+	stats := dispatcher.Stats()
+	if stats.BlockedEvents == 0 || stats.BlockedTime < 40*time.Millisecond {
+		t.Errorf("Tempo bloqueado deveria ser medido, obtido %s", stats)
+	}
+}
+
+func TestDispatcher_OverflowDropOldest(t *testing.T) {
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithCapacity(2), WithOverflowPolicy(OverflowDropOldest, ""))
+	run := &overflowRun{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < overflowEvents; i++ {
+		if err := dispatcher.Dispatch(ctx, run.message(i)); err != nil {
+			t.Fatalf("Dispatch não deveria falhar: %v", err)
+		}
+	}
+	dispatcher.StartWorkers(ctx)
+	dispatcher.WaitForCompletion()
+
+	applied, dropped := run.result()
+	if fmt.Sprint(dropped) != "[msg-0 msg-1 msg-2]" {
+		t.Errorf("Os mais antigos deveriam ser descartados, obtido %v", dropped)
+	}
+	if fmt.Sprint(applied) != "[msg-3 msg-4]" {
+		t.Errorf("Os mais novos deveriam ser aplicados, obtido %v", applied)
+	}
+	if got := counter.Snapshot("t").Totals()["created"]["user1"]; got != 2 {
+		t.Errorf("Esperados 2 eventos contados, obtidos %d", got)
+	}
+	if stats := dispatcher.Stats(); stats.Dropped != 3 {
+		t.Errorf("Esperados 3 descartes, obtido %s", stats)
+	}
+}
+
+func TestDispatcher_OverflowReject(t *testing.T) {
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithCapacity(2), WithOverflowPolicy(OverflowReject, ""))
+	run := &overflowRun{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rejected := 0
+	for i := 0; i < overflowEvents; i++ {
+		err := dispatcher.Dispatch(ctx, run.message(i))
+		if errors.Is(err, ErrDispatcherFull) {
+			rejected++
+		} else if err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	dispatcher.StartWorkers(ctx)
+	dispatcher.WaitForCompletion()
+
+	if rejected != 3 {
+		t.Errorf("Esperadas 3 rejeições, obtidas %d", rejected)
+	}
+	applied, dropped := run.result()
+	if len(applied) != 2 || len(dropped) != 0 {
+		t.Errorf("Rejeitados não deveriam ser aplicados nem descartados: aplicados %v, descartados %v", applied, dropped)
+	}
+	if stats := dispatcher.Stats(); stats.Rejected != 3 {
+		t.Errorf("Esperadas 3 rejeições nas métricas, obtido %s", stats)
+	}
+}
+
+func TestDispatcher_OverflowSpill(t *testing.T) {
+	dir := t.TempDir()
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithCapacity(2), WithOverflowPolicy(OverflowSpill, dir))
+	run := &overflowRun{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := 0; i < overflowEvents; i++ {
+		if err := dispatcher.Dispatch(ctx, run.message(i)); err != nil {
+			t.Fatalf("Dispatch não deveria falhar: %v", err)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "dispatcher-spill-*")); len(files) != 1 {
+		t.Fatalf("Esperado um arquivo de spill, obtidos %v", files)
+	}
+
+	dispatcher.StartWorkers(ctx)
+	dispatcher.WaitForCompletion()
+
+	applied, _ := run.result()
+	if fmt.Sprint(applied) != "[msg-0 msg-1 msg-2 msg-3 msg-4]" {
+		t.Errorf("Todos os eventos deveriam ser aplicados em ordem, obtido %v", applied)
+	}
+	if stats := dispatcher.Stats(); stats.Spilled != 3 {
+		t.Errorf("Esperados 3 eventos em disco, obtido %s", stats)
+	}
+
+	cancel()
+	dispatcher.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Arquivo de spill deveria ser removido no Close, restam %d", len(entries))
+	}
+}
+
+func TestDispatcher_OverflowSpillCorrupted(t *testing.T) {
+	counter := NewEventCounter()
+	dispatcher := NewDispatcher(counter, WithCapacity(2), WithOverflowPolicy(OverflowSpill, t.TempDir()))
+	run := &overflowRun{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		dispatcher.Close()
+	}()
+
+	for i := 0; i < overflowEvents; i++ {
+		if err := dispatcher.Dispatch(ctx, run.message(i)); err != nil {
+			t.Fatalf("Dispatch não deveria falhar: %v", err)
+		}
+	}
+	// Corrompe o primeiro registro em disco antes dos workers começarem.
+	if _, err := dispatcher.spill.file.WriteAt([]byte("{{{{"), 0); err != nil {
+		t.Fatalf("Erro ao corromper spill: %v", err)
+	}
+
+	dispatcher.StartWorkers(ctx)
+	done := make(chan struct{})
+	go func() {
+		dispatcher.WaitForCompletion()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForCompletion não retornou após registro corrompido")
+	}
+
+	applied, dropped := run.result()
+	if fmt.Sprint(applied) != "[msg-0 msg-1 msg-3 msg-4]" {
+		t.Errorf("Eventos legíveis deveriam ser aplicados, obtido %v", applied)
+	}
+	if fmt.Sprint(dropped) != "[msg-2]" {
+		t.Errorf("Registro corrompido deveria ser descartado, obtido %v", dropped)
+	}
+	if pending := dispatcher.spill.Pending(); pending != 0 {
+		t.Errorf("Nenhum evento deveria ficar pendente em disco, restam %d", pending)
+	}
+	if stats := dispatcher.Stats(); stats.Dropped != 1 {
+		t.Errorf("Esperado 1 evento descartado, obtido %s", stats)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	if policy, err := ParseOverflowPolicy("spill-to-disk"); err != nil || policy != OverflowSpill {
+		t.Errorf("Esperado %q, obtido %q (%v)", OverflowSpill, policy, err)
+	}
+	if _, err := ParseOverflowPolicy("drop-newest"); err == nil {
+		t.Error("Política desconhecida deveria falhar")
+	}
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+// =============================================================================
+// TESTES DE PADRÃO DE CHAVE DE ROTEAMENTO
+// =============================================================================
+
+func TestRoutingKeySchema_DefaultAcceptsDottedUserIDs(t *testing.T) {
+	dispatcher := NewDispatcher(NewEventCounter())
+	defer dispatcher.Close()
+
+	user_id, event_type, err := dispatcher.ParseRoutingKey("john.doe.event.created")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if user_id != "john.doe" || event_type != "created" {
+		t.Errorf("Esperado john.doe/created, obtido %s/%s", user_id, event_type)
+	}
+}
+
+func TestRoutingKeySchema_NamedCapturesIntoAttributes(t *testing.T) {
+	schema, err := routing.NewSchema("{tenant}.{user}.event.{type}")
+	if err != nil {
+		t.Fatalf("Erro ao compilar padrão: %v", err)
+	}
+	dispatcher := NewDispatcher(NewEventCounter(), WithRoutingKeySchema(schema))
+	defer dispatcher.Close()
+
+	msg, err := dispatcher.ParseRoutingKeyFields("acme.user_a.event.updated")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if msg.UserID != "user_a" || msg.EventType != "updated" || msg.Attributes["tenant"] != "acme" {
+		t.Errorf("Campos extraídos incorretamente: %+v", msg)
+	}
+
+	_, err = dispatcher.ParseRoutingKeyFields("user_a.event.updated")
+	var keyErr *routing.KeyError
+	if !errors.As(err, &keyErr) || !errors.Is(err, routing.ErrKeyMismatch) {
+		t.Errorf("Esperado routing.KeyError com routing.ErrKeyMismatch, obtido %v", err)
+	}
+}
+
+func TestRoutingKeySchema_TypedErrors(t *testing.T) {
+	dispatcher := NewDispatcher(NewEventCounter())
+	defer dispatcher.Close()
+
+	cases := map[string]error{
+		"":               routing.ErrEmptyKey,
+		"invalid.format": routing.ErrKeyMismatch,
+		".event.created": routing.ErrKeyMismatch,
+		"user_a.event.":  routing.ErrKeyMismatch,
+	}
+	for key, expected := range cases {
+		if _, _, err := dispatcher.ParseRoutingKey(key); !errors.Is(err, expected) {
+			t.Errorf("Chave %q: esperado %v, obtido %v", key, expected, err)
+		}
+	}
+}
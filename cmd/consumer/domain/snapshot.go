@@ -0,0 +1,290 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Snapshot é um G-counter por instância: cada instância só incrementa as
+// próprias entradas, e o merge pega o máximo de cada entrada, então mesclar
+// o mesmo snapshot mais de uma vez nunca conta em dobro. As estatísticas de
+// valores seguem a mesma regra, ficando com a que viu mais valores. Columns
+// são as colunas do agrupamento que as chaves representam; snapshots sem
+// elas são por usuário. Users guarda, por instância, os usuários vistos pela
+// cota do tenant, que as chaves não revelam quando o agrupamento não inclui
+// user_id.
+type Snapshot struct {
+	InstanceID   string                                       `json:"instance_id"`
+	Counters     map[string]map[string]map[string]int         `json:"counters"`
+	Values       map[string]map[string]map[string]*ValueStats `json:"values,omitempty"`
+	Columns      []string                                     `json:"columns"`
+	Users        map[string][]string                          `json:"users,omitempty"`
+	Aggregations Aggregations                                 `json:"aggregations,omitempty"`
+}
+
+func NewSnapshot(instanceID string) *Snapshot {
+	return &Snapshot{
+		InstanceID:   instanceID,
+		Counters:     make(map[string]map[string]map[string]int),
+		Values:       make(map[string]map[string]map[string]*ValueStats),
+		Users:        make(map[string][]string),
+		Aggregations: make(Aggregations),
+	}
+}
+
+func (c *EventCounter) Snapshot(instanceID string) *Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := NewSnapshot(instanceID)
+	local := make(map[string]map[string]int)
+	for event_type, users := range c.counters {
+		local[event_type] = make(map[string]int)
+		for user_id, count := range users {
+			local[event_type][user_id] = count
+		}
+	}
+	snapshot.Counters[instanceID] = local
+
+	if len(c.values) > 0 {
+		values := make(map[string]map[string]*ValueStats)
+		for event_type, users := range c.values {
+			values[event_type] = make(map[string]*ValueStats)
+			for user_id, stats := range users {
+				values[event_type][user_id] = stats.Clone()
+			}
+		}
+		snapshot.Values[instanceID] = values
+	}
+	if len(c.users) > 0 {
+		users := make([]string, 0, len(c.users))
+		for user_id := range c.users {
+			users = append(users, user_id)
+		}
+		sort.Strings(users)
+		snapshot.Users[instanceID] = users
+	}
+	snapshot.Columns = orUserColumns(c.columns)
+	snapshot.Aggregations.Merge(c.aggregations)
+
+	return snapshot
+}
+
+// Restore retoma no contador as entradas que a instância instanceID gravou
+// no snapshot, para que uma instância reiniciada continue de onde parou em
+// vez de sobrescrever o próprio snapshot a partir do zero.
+func (c *EventCounter) Restore(snapshot *Snapshot, instanceID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	columns := orUserColumns(c.columns)
+	if !equalStrings(snapshot.Columns, columns) {
+		return fmt.Errorf("snapshot com colunas %v, esperado %v", snapshot.Columns, columns)
+	}
+	// Snapshots anteriores ao campo Users só permitem recuperar os
+	// usuários pela coluna user_id, quando o agrupamento a inclui.
+	user_column := -1
+	if _, ok := snapshot.Users[instanceID]; !ok {
+		for i, column := range columns {
+			if column == DimensionUser {
+				user_column = i
+			}
+		}
+	}
+
+	for event_type, keys := range snapshot.Counters[instanceID] {
+		if c.counters[event_type] == nil {
+			c.counters[event_type] = make(map[string]int)
+		}
+		for key, count := range keys {
+			c.counters[event_type][key] = count
+			if user_column >= 0 {
+				if user_id := splitGroupKey(key, len(columns))[user_column]; user_id != "" {
+					c.users[user_id] = true
+				}
+			}
+		}
+	}
+	for _, user_id := range snapshot.Users[instanceID] {
+		c.users[user_id] = true
+	}
+	for event_type, users := range snapshot.Values[instanceID] {
+		if c.values[event_type] == nil {
+			c.values[event_type] = make(map[string]*ValueStats)
+		}
+		for user_id, stats := range users {
+			c.values[event_type][user_id] = stats.Clone()
+		}
+	}
+	return nil
+}
+
+// orUserColumns devolve as colunas, ou só user_id para contadores e
+// snapshots sem agrupamento.
+func orUserColumns(columns []string) []string {
+	if columns == nil {
+		return []string{DimensionUser}
+	}
+	return columns
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge mescla other no snapshot. Snapshots com colunas diferentes contam
+// chaves de agrupamentos diferentes e não podem ser somados, então Merge
+// falha sem alterar nada.
+func (s *Snapshot) Merge(other *Snapshot) error {
+	if s.Columns != nil && !equalStrings(orUserColumns(s.Columns), orUserColumns(other.Columns)) {
+		return fmt.Errorf("snapshot %s com colunas %v, esperado %v", other.InstanceID, orUserColumns(other.Columns), s.Columns)
+	}
+
+	for instance_id, event_types := range other.Counters {
+		if s.Counters[instance_id] == nil {
+			s.Counters[instance_id] = make(map[string]map[string]int)
+		}
+		for event_type, users := range event_types {
+			if s.Counters[instance_id][event_type] == nil {
+				s.Counters[instance_id][event_type] = make(map[string]int)
+			}
+			for user_id, count := range users {
+				if count > s.Counters[instance_id][event_type][user_id] {
+					s.Counters[instance_id][event_type][user_id] = count
+				}
+			}
+		}
+	}
+
+	for instance_id, event_types := range other.Values {
+		if s.Values[instance_id] == nil {
+			s.Values[instance_id] = make(map[string]map[string]*ValueStats)
+		}
+		for event_type, users := range event_types {
+			if s.Values[instance_id][event_type] == nil {
+				s.Values[instance_id][event_type] = make(map[string]*ValueStats)
+			}
+			for user_id, stats := range users {
+				current := s.Values[instance_id][event_type][user_id]
+				if current == nil || stats.Count > current.Count {
+					s.Values[instance_id][event_type][user_id] = stats.Clone()
+				}
+			}
+		}
+	}
+	for instance_id, users := range other.Users {
+		s.Users[instance_id] = mergeUsers(s.Users[instance_id], users)
+	}
+	if s.Columns == nil {
+		s.Columns = orUserColumns(other.Columns)
+	}
+	s.Aggregations.Merge(other.Aggregations)
+	return nil
+}
+
+// mergeUsers une duas listas ordenadas de usuários sem repetições.
+func mergeUsers(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	merged := make([]string, 0, len(a)+len(b))
+	for _, user_id := range append(append([]string(nil), a...), b...) {
+		if !seen[user_id] {
+			seen[user_id] = true
+			merged = append(merged, user_id)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func (s *Snapshot) Totals() map[string]map[string]int {
+	totals := make(map[string]map[string]int)
+	for _, event_types := range s.Counters {
+		for event_type, users := range event_types {
+			if totals[event_type] == nil {
+				totals[event_type] = make(map[string]int)
+			}
+			for user_id, count := range users {
+				totals[event_type][user_id] += count
+			}
+		}
+	}
+	return totals
+}
+
+// ValueTotals combina as estatísticas de valores de todas as instâncias.
+func (s *Snapshot) ValueTotals() map[string]map[string]*ValueStats {
+	totals := make(map[string]map[string]*ValueStats)
+	for _, event_types := range s.Values {
+		for event_type, users := range event_types {
+			if totals[event_type] == nil {
+				totals[event_type] = make(map[string]*ValueStats)
+			}
+			for user_id, stats := range users {
+				if totals[event_type][user_id] == nil {
+					totals[event_type][user_id] = &ValueStats{}
+				}
+				totals[event_type][user_id].Merge(stats)
+			}
+		}
+	}
+	return totals
+}
+
+func (s *Snapshot) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("falha ao criar diretório do snapshot: %w", err)
+	}
+
+	json_data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("falha ao usar marshal no snapshot %s: %w", s.InstanceID, err)
+	}
+
+	if err := os.WriteFile(path, json_data, 0644); err != nil {
+		return fmt.Errorf("falha ao escrever snapshot %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao ler snapshot %s: %w", path, err)
+	}
+
+	snapshot := NewSnapshot("")
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("falha ao deserializar snapshot %s: %w", path, err)
+	}
+	if snapshot.Counters == nil {
+		snapshot.Counters = make(map[string]map[string]map[string]int)
+	}
+	if snapshot.Values == nil {
+		snapshot.Values = make(map[string]map[string]map[string]*ValueStats)
+	}
+	if snapshot.Users == nil {
+		snapshot.Users = make(map[string][]string)
+	}
+	snapshot.Columns = orUserColumns(snapshot.Columns)
+	if snapshot.Aggregations == nil {
+		snapshot.Aggregations = make(Aggregations)
+	}
+
+	return snapshot, nil
+}
+
+func SnapshotPath(dir, instanceID string) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot-%s.json", instanceID))
+}
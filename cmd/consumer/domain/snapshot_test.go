@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE SNAPSHOT E MERGE
+// =============================================================================
+
+func TestSnapshot_MergeSumsInstances(t *testing.T) {
+	ctx := context.Background()
+
+	counterA := NewEventCounter()
+	counterA.Created(ctx, "user1")
+	counterA.Created(ctx, "user1")
+	counterA.Deleted(ctx, "user2")
+
+	counterB := NewEventCounter()
+	counterB.Created(ctx, "user1")
+	counterB.Updated(ctx, "user3")
+
+	merged := NewSnapshot("merged")
+	merged.Merge(counterA.Snapshot("a"))
+	merged.Merge(counterB.Snapshot("b"))
+
+	totals := merged.Totals()
+	if totals["created"]["user1"] != 3 {
+		t.Errorf("Esperado 3 eventos created para user1, obtido %d", totals["created"]["user1"])
+	}
+	if totals["deleted"]["user2"] != 1 {
+		t.Errorf("Esperado 1 evento deleted para user2, obtido %d", totals["deleted"]["user2"])
+	}
+	if totals["updated"]["user3"] != 1 {
+		t.Errorf("Esperado 1 evento updated para user3, obtido %d", totals["updated"]["user3"])
+	}
+}
+
+func TestSnapshot_MergeIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+
+	counter := NewEventCounter()
+	counter.Created(ctx, "user1")
+	counter.Created(ctx, "user1")
+	snapshot := counter.Snapshot("a")
+
+	merged := NewSnapshot("merged")
+	merged.Merge(snapshot)
+	merged.Merge(snapshot)
+	merged.Merge(merged)
+
+	if total := merged.Totals()["created"]["user1"]; total != 2 {
+		t.Errorf("Merge repetido não deveria contar em dobro: esperado 2, obtido %d", total)
+	}
+
+	counter.Created(ctx, "user1")
+	merged.Merge(counter.Snapshot("a"))
+	if total := merged.Totals()["created"]["user1"]; total != 3 {
+		t.Errorf("Snapshot mais recente deveria prevalecer: esperado 3, obtido %d", total)
+	}
+}
+
+func TestSnapshot_SaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+
+	counter := NewEventCounter()
+	counter.Updated(ctx, "user1")
+
+	path := SnapshotPath(t.TempDir(), "a")
+	if err := counter.Snapshot("a").Save(path); err != nil {
+		t.Fatalf("Erro ao salvar snapshot: %v", err)
+	}
+	if filepath.Base(path) != "snapshot-a.json" {
+		t.Errorf("Nome de arquivo inesperado: %s", path)
+	}
+
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Erro ao carregar snapshot: %v", err)
+	}
+	if loaded.InstanceID != "a" {
+		t.Errorf("Esperado instance_id 'a', obtido '%s'", loaded.InstanceID)
+	}
+	if loaded.Totals()["updated"]["user1"] != 1 {
+		t.Errorf("Esperado 1 evento updated para user1 após carregar snapshot")
+	}
+}
+
+func TestSnapshot_MergesValueStats(t *testing.T) {
+	aggregations := Aggregations{"updated": {"sum", "max"}}
+
+	counterA := NewEventCounter()
+	counterA.SetAggregations(aggregations)
+	counterA.Observe("updated", "user1", 10)
+	counterA.Observe("updated", "user1", 30)
+
+	counterB := NewEventCounter()
+	counterB.SetAggregations(aggregations)
+	counterB.Observe("updated", "user1", 50)
+
+	merged := NewSnapshot("merged")
+	merged.Merge(counterA.Snapshot("a"))
+	merged.Merge(counterA.Snapshot("a"))
+	merged.Merge(counterB.Snapshot("b"))
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := merged.Save(path); err != nil {
+		t.Fatalf("Erro ao salvar snapshot: %v", err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Erro ao carregar snapshot: %v", err)
+	}
+
+	stats := loaded.ValueTotals()["updated"]["user1"]
+	if stats == nil || stats.Count != 3 || stats.Sum != 90 || stats.Max != 50 || stats.Min != 10 {
+		t.Errorf("Estatísticas mescladas incorretas: %+v", stats)
+	}
+	if len(loaded.Aggregations["updated"]) != 2 {
+		t.Errorf("Agregações deveriam ir no snapshot, obtido %v", loaded.Aggregations)
+	}
+}
+
+func TestTenantRegistry_RestoreSnapshotsAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first := NewTenantRegistry(NewEventCounter(), 0)
+	first.Counter(DefaultTenant).Created(ctx, "user1")
+	first.Counter("acme").Created(ctx, "user1")
+	first.Counter("acme").Created(ctx, "user1")
+	if err := first.SaveSnapshots(dir, "a"); err != nil {
+		t.Fatalf("Erro ao salvar snapshots: %v", err)
+	}
+
+	// A mesma instância reiniciada continua das contagens anteriores.
+	restarted := NewTenantRegistry(NewEventCounter(), 0)
+	restored, err := restarted.RestoreSnapshots(dir, "a")
+	if err != nil || restored != 2 {
+		t.Fatalf("Esperados 2 snapshots retomados, obtido %d (erro: %v)", restored, err)
+	}
+	restarted.Counter("acme").Created(ctx, "user1")
+	if err := restarted.SaveSnapshots(dir, "a"); err != nil {
+		t.Fatalf("Erro ao salvar snapshots: %v", err)
+	}
+
+	snapshot, err := LoadSnapshot(SnapshotPath(filepath.Join(dir, "acme"), "a"))
+	if err != nil {
+		t.Fatalf("Erro ao carregar snapshot: %v", err)
+	}
+	if total := snapshot.Totals()["created"]["user1"]; total != 3 {
+		t.Errorf("Reinício não deveria perder contagens: esperado 3, obtido %d", total)
+	}
+	if got := restarted.Counter(DefaultTenant).TrackedUsers(); got != 1 {
+		t.Errorf("Usuários do snapshot deveriam contar na cota, obtido %d", got)
+	}
+
+	if restored, err := NewTenantRegistry(NewEventCounter(), 0).RestoreSnapshots(dir, "b"); err != nil || restored != 0 {
+		t.Errorf("Instância sem snapshot deveria começar do zero, obtido %d (erro: %v)", restored, err)
+	}
+
+	regrouped := NewTenantRegistry(NewEventCounter(), 0)
+	regrouped.SetColumns([]string{"region"})
+	if _, err := regrouped.RestoreSnapshots(dir, "a"); err == nil {
+		t.Error("Snapshot com outras colunas não deveria ser retomado")
+	}
+}
+
+func TestSnapshot_MergeRejectsDifferentColumns(t *testing.T) {
+	ctx := context.Background()
+
+	per_user := NewEventCounter()
+	per_user.Created(ctx, "user1")
+
+	per_type := NewEventCounter()
+	per_type.SetColumns([]string{})
+	per_type.Count(ctx, "created", "user2", GroupKey(nil))
+
+	merged := NewSnapshot("merged")
+	if err := merged.Merge(per_user.Snapshot("a")); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := merged.Merge(per_type.Snapshot("b")); err == nil {
+		t.Error("Merge de snapshots com colunas diferentes deveria falhar")
+	}
+	if _, ok := merged.Counters["b"]; ok {
+		t.Error("Merge recusado não deveria alterar o snapshot")
+	}
+	if total := merged.Totals()["created"]["user1"]; total != 1 {
+		t.Errorf("Esperado 1 evento created para user1, obtido %d", total)
+	}
+}
+
+func TestEventCounter_RestoreKeepsQuotaUsersWhenGrouped(t *testing.T) {
+	ctx := context.Background()
+
+	grouped := NewEventCounter()
+	grouped.SetColumns([]string{"region"})
+	grouped.Count(ctx, "created", "user1", GroupKey([]string{"eu"}))
+	grouped.Count(ctx, "created", "user2", GroupKey([]string{"eu"}))
+	grouped.Count(ctx, "created", "user3", GroupKey([]string{"us"}))
+
+	restarted := NewEventCounter()
+	restarted.SetColumns([]string{"region"})
+	if err := restarted.Restore(grouped.Snapshot("a"), "a"); err != nil {
+		t.Fatalf("Erro ao retomar snapshot: %v", err)
+	}
+	if got := restarted.TrackedUsers(); got != 3 {
+		t.Errorf("Usuários do snapshot agrupado deveriam contar na cota, obtido %d", got)
+	}
+
+	// Snapshots sem Users recuperam os usuários pela coluna user_id.
+	legacy := NewSnapshot("a")
+	legacy.Columns = []string{"region", DimensionUser}
+	legacy.Counters["a"] = map[string]map[string]int{"created": {
+		GroupKey([]string{"eu", "user1"}): 2,
+		GroupKey([]string{"us", "user2"}): 1,
+	}}
+	from_legacy := NewEventCounter()
+	from_legacy.SetColumns([]string{"region", DimensionUser})
+	if err := from_legacy.Restore(legacy, "a"); err != nil {
+		t.Fatalf("Erro ao retomar snapshot: %v", err)
+	}
+	if got := from_legacy.TrackedUsers(); got != 2 {
+		t.Errorf("Usuários deveriam vir da coluna user_id, obtido %d", got)
+	}
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	tdigestCompression = 100
+	tdigestBuffer      = 500
+)
+
+type centroid struct {
+	Mean   float64
+	Weight float64
+}
+
+// tdigest estima quantis com memória limitada (t-digest com merge, de
+// Dunning). Os valores entram num buffer que, cheio, é fundido aos
+// centróides ordenados; o tamanho de cada centróide é limitado pela função
+// de escala k1, que mantém os centróides das caudas pequenos e, com eles,
+// o erro dos percentis altos e baixos.
+type tdigest struct {
+	centroids []centroid
+	buffer    []centroid
+	count     float64
+}
+
+func (t *tdigest) add(mean, weight float64) {
+	t.buffer = append(t.buffer, centroid{mean, weight})
+	t.count += weight
+	if len(t.buffer) >= tdigestBuffer {
+		t.compress()
+	}
+}
+
+func (t *tdigest) merge(other *tdigest) {
+	for _, c := range other.all() {
+		t.add(c.Mean, c.Weight)
+	}
+}
+
+// all devolve os centróides já comprimidos, incluindo o buffer.
+func (t *tdigest) all() []centroid {
+	t.compress()
+	return t.centroids
+}
+
+func (t *tdigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+
+	merged := []centroid{all[0]}
+	before := 0.0
+	limit := t.count * tdigestQ(tdigestK(0)+1)
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		if before+last.Weight+c.Weight <= limit {
+			last.Weight += c.Weight
+			last.Mean += (c.Mean - last.Mean) * c.Weight / last.Weight
+			continue
+		}
+		before += last.Weight
+		limit = t.count * tdigestQ(tdigestK(before/t.count)+1)
+		merged = append(merged, c)
+	}
+
+	t.centroids = merged
+	t.buffer = nil
+}
+
+// tdigestK é a função de escala k1 e tdigestQ a sua inversa.
+func tdigestK(q float64) float64 {
+	return tdigestCompression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func tdigestQ(k float64) float64 {
+	if k >= tdigestCompression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/tdigestCompression) + 1) / 2
+}
+
+// quantile interpola entre os centros dos centróides; min e max, exatos,
+// fecham as pontas.
+func (t *tdigest) quantile(q, min, max float64) float64 {
+	centroids := t.all()
+	if len(centroids) == 0 {
+		return math.NaN()
+	}
+
+	index := q * t.count
+	first := centroids[0]
+	if index <= first.Weight/2 {
+		return min + (first.Mean-min)*index/(first.Weight/2)
+	}
+
+	cumulative := 0.0
+	for i := 0; i < len(centroids)-1; i++ {
+		left := cumulative + centroids[i].Weight/2
+		right := cumulative + centroids[i].Weight + centroids[i+1].Weight/2
+		if index <= right {
+			fraction := (index - left) / (right - left)
+			return centroids[i].Mean + fraction*(centroids[i+1].Mean-centroids[i].Mean)
+		}
+		cumulative += centroids[i].Weight
+	}
+
+	last := centroids[len(centroids)-1]
+	fraction := (index - (t.count - last.Weight/2)) / (last.Weight / 2)
+	return math.Min(max, last.Mean+fraction*(max-last.Mean))
+}
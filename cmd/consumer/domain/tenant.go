@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+// DefaultTenant é o tenant das mensagens que não informam nenhum; seus
+// resultados continuam na raiz do diretório de resultados.
+const DefaultTenant = ""
+
+// TenantRegistry mantém um EventCounter isolado por tenant: contagens,
+// deduplicação e limite de usuários nunca são compartilhados entre tenants.
+type TenantRegistry struct {
+	mu           sync.Mutex
+	counters     map[string]*EventCounter
+	maxUsers     int
+	columns      []string
+	aggregations Aggregations
+}
+
+// NewTenantRegistry usa base como contador do tenant padrão. maxUsers limita
+// quantos usuários cada tenant pode rastrear (0 = sem limite).
+func NewTenantRegistry(base *EventCounter, maxUsers int) *TenantRegistry {
+	base.mu.Lock()
+	base.maxUsers = maxUsers
+	base.mu.Unlock()
+
+	return &TenantRegistry{
+		counters: map[string]*EventCounter{DefaultTenant: base},
+		maxUsers: maxUsers,
+	}
+}
+
+func (r *TenantRegistry) Counter(tenant string) *EventCounter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counter, ok := r.counters[tenant]
+	if !ok {
+		counter = NewEventCounter()
+		counter.maxUsers = r.maxUsers
+		counter.columns = r.columns
+		counter.aggregations = r.aggregations
+		r.counters[tenant] = counter
+	}
+	return counter
+}
+
+// SetAggregations aplica as agregações aos contadores de todos os
+// tenants, inclusive os criados depois.
+func (r *TenantRegistry) SetAggregations(aggregations Aggregations) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.aggregations = aggregations
+	for _, counter := range r.counters {
+		counter.SetAggregations(aggregations)
+	}
+}
+
+// SetColumns aplica as colunas do agrupamento aos contadores de todos os
+// tenants, inclusive os criados depois.
+func (r *TenantRegistry) SetColumns(columns []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.columns = columns
+	for _, counter := range r.counters {
+		counter.SetColumns(columns)
+	}
+}
+
+func (r *TenantRegistry) Tenants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenants := make([]string, 0, len(r.counters))
+	for tenant := range r.counters {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// TenantDir devolve o diretório de resultados do tenant dentro de root.
+func TenantDir(root, tenant string) string {
+	if tenant == DefaultTenant {
+		return root
+	}
+	return filepath.Join(root, tenant)
+}
+
+func (r *TenantRegistry) SaveResults(root string) error {
+	for _, tenant := range r.Tenants() {
+		counter := r.Counter(tenant)
+		counter.mu.Lock()
+		err := WriteResults(TenantDir(root, tenant), counter.counters, counter.values, counter.columns, counter.aggregations)
+		counter.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+func (r *TenantRegistry) SaveSnapshots(root, instanceID string) error {
+	for _, tenant := range r.Tenants() {
+		path := SnapshotPath(TenantDir(root, tenant), instanceID)
+		if err := r.Counter(tenant).Snapshot(instanceID).Save(path); err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+// RestoreSnapshots carrega os snapshots que instanceID já gravou em root
+// (tenant padrão) e nos diretórios dos tenants, e devolve quantos foram
+// retomados. Tenants sem snapshot começam do zero.
+func (r *TenantRegistry) RestoreSnapshots(root, instanceID string) (int, error) {
+	tenants, err := storedTenants(root)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, tenant := range tenants {
+		path := SnapshotPath(TenantDir(root, tenant), instanceID)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		snapshot, err := LoadSnapshot(path)
+		if err != nil {
+			return restored, err
+		}
+		if err := r.Counter(tenant).Restore(snapshot, instanceID); err != nil {
+			return restored, fmt.Errorf("%s: %w", path, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// storedTenants lista o tenant padrão e os tenants com diretório em root.
+func storedTenants(root string) ([]string, error) {
+	tenants := []string{DefaultTenant}
+	entries, err := os.ReadDir(root)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("falha ao listar %s: %w", root, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && routing.ValidTenant(entry.Name()) == nil {
+			tenants = append(tenants, entry.Name())
+		}
+	}
+	return tenants, nil
+}
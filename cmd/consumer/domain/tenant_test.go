@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE ISOLAMENTO POR TENANT
+// =============================================================================
+
+func TestTenantRegistry_IsolatesCountersAndDedup(t *testing.T) {
+	ctx := context.Background()
+	registry := NewTenantRegistry(NewEventCounter(), 0)
+
+	acme := registry.Counter("acme")
+	globex := registry.Counter("globex")
+	if registry.Counter("acme") != acme {
+		t.Fatal("O mesmo tenant deveria devolver o mesmo contador")
+	}
+
+	acme.Created(ctx, "user1")
+	acme.Created(ctx, "user1")
+	globex.Created(ctx, "user1")
+	acme.MarkProcessed("msg-1")
+
+	if got := acme.Snapshot("i").Totals()["created"]["user1"]; got != 2 {
+		t.Errorf("Esperado 2 eventos em acme, obtido %d", got)
+	}
+	if got := globex.Snapshot("i").Totals()["created"]["user1"]; got != 1 {
+		t.Errorf("Esperado 1 evento em globex, obtido %d", got)
+	}
+	if globex.IsProcessed("msg-1") {
+		t.Error("Deduplicação não deveria vazar entre tenants")
+	}
+}
+
+func TestTenantRegistry_QuotaPerTenant(t *testing.T) {
+	ctx := context.Background()
+	registry := NewTenantRegistry(NewEventCounter(), 2)
+	acme := registry.Counter("acme")
+
+	if err := acme.Created(ctx, "user1"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := acme.Updated(ctx, "user2"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := acme.Deleted(ctx, "user3"); !errors.Is(err, ErrUserQuotaExceeded) {
+		t.Errorf("Esperado ErrUserQuotaExceeded, obtido %v", err)
+	}
+	if err := acme.Deleted(ctx, "user1"); err != nil {
+		t.Errorf("Usuário já rastreado não deveria ser recusado: %v", err)
+	}
+	if err := registry.Counter("globex").Created(ctx, "user3"); err != nil {
+		t.Errorf("Limite de acme não deveria afetar globex: %v", err)
+	}
+	if acme.TrackedUsers() != 2 {
+		t.Errorf("Esperado 2 usuários rastreados em acme, obtido %d", acme.TrackedUsers())
+	}
+}
+
+func TestDispatcher_QuotaExceededIsDropped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewTenantRegistry(NewEventCounter(), 1)
+	dispatcher := NewDispatcher(registry.Counter(DefaultTenant), WithTenants(registry))
+	defer dispatcher.Close()
+	dispatcher.StartWorkers(ctx)
+
+	var applied, dropped []string
+	for i, user_id := range []string{"user1", "user2"} {
+		id := fmt.Sprintf("m-%d", i)
+		dispatcher.Dispatch(ctx, EventMessage{
+			UserID:    user_id,
+			EventType: "created",
+			MessageID: id,
+			Tenant:    "acme",
+			OnApplied: func() { applied = append(applied, id) },
+			OnDropped: func() { dropped = append(dropped, id) },
+		})
+		dispatcher.WaitForCompletion()
+	}
+
+	// O evento acima da cota é rejeitado na origem, não confirmado.
+	if len(applied) != 1 || applied[0] != "m-0" || len(dropped) != 1 || dropped[0] != "m-1" {
+		t.Errorf("Esperado m-0 aplicado e m-1 descartado, obtido aplicados %v e descartados %v", applied, dropped)
+	}
+	if stats := dispatcher.Stats(); stats.OverQuota != 1 {
+		t.Errorf("Esperado 1 evento acima da cota nas estatísticas, obtido %d", stats.OverQuota)
+	}
+}
+
+func TestTenantRegistry_SaveResultsPerTenantDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	registry := NewTenantRegistry(NewEventCounter(), 0)
+
+	registry.Counter(DefaultTenant).Created(ctx, "user0")
+	registry.Counter("acme").Created(ctx, "user1")
+
+	if err := registry.SaveResults(dir); err != nil {
+		t.Fatalf("Erro ao salvar resultados: %v", err)
+	}
+
+	read := func(path string) []UserCount {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Erro ao ler %s: %v", path, err)
+		}
+		var counts []UserCount
+		if err := json.Unmarshal(data, &counts); err != nil {
+			t.Fatalf("Erro ao decodificar %s: %v", path, err)
+		}
+		return counts
+	}
+
+	root := read(filepath.Join(dir, "created.json"))
+	if len(root) != 1 || root[0].UserID != "user0" {
+		t.Errorf("Resultado do tenant padrão incorreto: %v", root)
+	}
+	acme := read(filepath.Join(dir, "acme", "created.json"))
+	if len(acme) != 1 || acme[0].UserID != "user1" {
+		t.Errorf("Resultado de acme incorreto: %v", acme)
+	}
+}
@@ -0,0 +1,322 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+	"github.com/google/uuid"
+)
+
+// Motivos de rejeição de um payload, usados no header de quarentena e no
+// RejectionCounter.
+const (
+	RejectTooLarge     = "too_large"
+	RejectMalformed    = "malformed"
+	RejectUnknownField = "unknown_field"
+	RejectMissingField = "missing_field"
+	RejectInvalidID    = "invalid_id"
+	RejectContentType  = "unsupported_content_type"
+	RejectEncoding     = "unsupported_encoding"
+	RejectKeyMismatch  = "routing_key_mismatch"
+)
+
+// Formatos aceitos para o campo id.
+const (
+	IDFormatAny  = "any"
+	IDFormatUUID = "uuid"
+)
+
+// payloadFields são os campos conhecidos de Event; qualquer outro é
+// desconhecido.
+var payloadFields = map[string]bool{"id": true, "user_id": true, "event_type": true, "value": true}
+
+var defaultDecoders = codec.NewRegistry()
+
+// KnownPayloadField diz se o campo existe no payload de Event.
+func KnownPayloadField(name string) bool {
+	return payloadFields[name]
+}
+
+// ValidationError descreve por que um payload foi rejeitado.
+type ValidationError struct {
+	Reason string
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("payload inválido (%s): %s", e.Reason, e.Detail)
+}
+
+// AsValidationError devolve o ValidationError contido em err; outros erros
+// viram uma rejeição malformed.
+func AsValidationError(err error) *ValidationError {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr
+	}
+	return &ValidationError{Reason: RejectMalformed, Detail: err.Error()}
+}
+
+// MatchRoutingKey confere o usuário e o tipo que o payload declara (como o
+// subject e o type do CloudEvents) com os da chave de roteamento, que
+// continua sendo a fonte; uma divergência é rejeitada em vez de ignorada.
+func (e Event) MatchRoutingKey(msg EventMessage) error {
+	if e.UserID != "" && e.UserID != msg.UserID {
+		return &ValidationError{RejectKeyMismatch, fmt.Sprintf("usuário %q no payload, %q na chave", e.UserID, msg.UserID)}
+	}
+	if e.EventType != "" && !strings.EqualFold(e.EventType, msg.EventType) {
+		return &ValidationError{RejectKeyMismatch, fmt.Sprintf("tipo %q no payload, %q na chave", e.EventType, msg.EventType)}
+	}
+	return nil
+}
+
+// PayloadRules declara o que um payload precisa ter para ser aceito.
+// MaxSize limita o corpo recebido e MaxDecompressedSize o corpo depois de
+// descomprimido (gzip ou zstd). Extra são campos além dos de Event que
+// também são aceitos e vão, como texto, em Event.Attributes.
+type PayloadRules struct {
+	Required            []string
+	IDFormat            string
+	MaxSize             int
+	MaxDecompressedSize int
+	AllowUnknown        bool
+	Extra               []string
+}
+
+func DefaultPayloadRules() PayloadRules {
+	return PayloadRules{
+		Required:            []string{"id"},
+		IDFormat:            IDFormatAny,
+		MaxSize:             64 * 1024,
+		MaxDecompressedSize: 1024 * 1024,
+	}
+}
+
+// Validate aplica as regras a um payload JSON; a falha é sempre um
+// *ValidationError.
+func (r PayloadRules) Validate(body []byte) (Event, error) {
+	return r.Decode(defaultDecoders, broker.Message{Body: body, ContentType: codec.ContentTypeJSON})
+}
+
+// Decode descomprime a mensagem conforme o ContentEncoding, decodifica com o
+// decoder do seu ContentType e aplica as regras aos campos resultantes,
+// qualquer que seja o formato.
+func (r PayloadRules) Decode(decoders *codec.Registry, msg broker.Message) (Event, error) {
+	msg, err := r.decompress(msg)
+	if err != nil {
+		return Event{}, err
+	}
+
+	fields, err := decoders.Decode(msg)
+	if errors.Is(err, codec.ErrUnsupportedContentType) {
+		return Event{}, &ValidationError{RejectContentType, err.Error()}
+	}
+	if err != nil {
+		return Event{}, &ValidationError{RejectMalformed, err.Error()}
+	}
+	return r.validateFields(fields)
+}
+
+// BatchEntry é um evento de um envelope em lote: o Event validado ou o
+// *ValidationError que o rejeitou.
+type BatchEntry struct {
+	Event Event
+	Err   error
+}
+
+// DecodeBatch valida um envelope em lote. Os limites de tamanho valem para
+// o envelope inteiro e uma falha nele devolve um *ValidationError; cada
+// evento é validado à parte e precisa trazer user_id e event_type, que a
+// chave de roteamento de um lote não carrega.
+func (r PayloadRules) DecodeBatch(msg broker.Message) ([]BatchEntry, error) {
+	msg, err := r.decompress(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := codec.DecodeBatch(msg)
+	if err != nil {
+		return nil, &ValidationError{RejectMalformed, err.Error()}
+	}
+
+	entries := make([]BatchEntry, len(batch))
+	for i, fields := range batch {
+		event, err := r.validateFields(fields)
+		switch {
+		case err != nil:
+			entries[i].Err = err
+		case event.UserID == "":
+			entries[i].Err = &ValidationError{RejectMissingField, "user_id"}
+		case event.EventType == "":
+			entries[i].Err = &ValidationError{RejectMissingField, "event_type"}
+		default:
+			entries[i].Event = event
+		}
+	}
+	return entries, nil
+}
+
+// decompress aplica os limites de tamanho e descomprime o corpo conforme o
+// ContentEncoding.
+func (r PayloadRules) decompress(msg broker.Message) (broker.Message, error) {
+	if r.MaxSize > 0 && len(msg.Body) > r.MaxSize {
+		return msg, &ValidationError{RejectTooLarge, fmt.Sprintf("%d bytes, máximo %d", len(msg.Body), r.MaxSize)}
+	}
+
+	msg, err := codec.Decompress(msg, r.MaxDecompressedSize)
+	switch {
+	case errors.Is(err, codec.ErrDecompressedTooLarge):
+		return msg, &ValidationError{RejectTooLarge, err.Error()}
+	case errors.Is(err, codec.ErrUnsupportedEncoding):
+		return msg, &ValidationError{RejectEncoding, err.Error()}
+	case err != nil:
+		return msg, &ValidationError{RejectMalformed, err.Error()}
+	}
+	return msg, nil
+}
+
+func (r PayloadRules) validateFields(fields codec.Fields) (Event, error) {
+	if !r.AllowUnknown {
+		var unknown []string
+		for name := range fields {
+			if !payloadFields[name] && !containsString(r.Extra, name) {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return Event{}, &ValidationError{RejectUnknownField, strings.Join(unknown, ", ")}
+		}
+	}
+
+	values := make(map[string]string, len(payloadFields))
+	for name := range payloadFields {
+		value, ok := fields[name]
+		if !ok || value == nil || name == "value" {
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			return Event{}, &ValidationError{RejectMalformed, fmt.Sprintf("campo %s deve ser texto, obtido %T", name, value)}
+		}
+		values[name] = s
+	}
+
+	for _, name := range r.Required {
+		if name == "value" {
+			if fields[name] == nil {
+				return Event{}, &ValidationError{RejectMissingField, name}
+			}
+			continue
+		}
+		if values[name] == "" {
+			return Event{}, &ValidationError{RejectMissingField, name}
+		}
+	}
+
+	event := Event{ID: values["id"], UserID: values["user_id"], EventType: values["event_type"]}
+	if raw, ok := fields["value"]; ok && raw != nil {
+		value, ok := numericValue(raw)
+		if !ok {
+			return Event{}, &ValidationError{RejectMalformed, fmt.Sprintf("campo value deve ser um número finito, obtido %v", raw)}
+		}
+		event.Value = &value
+	}
+	for _, name := range r.Extra {
+		raw, ok := fields[name]
+		if !ok || raw == nil {
+			continue
+		}
+		switch raw.(type) {
+		case map[string]interface{}, []interface{}:
+			return Event{}, &ValidationError{RejectMalformed, fmt.Sprintf("campo %s deve ser texto ou número, obtido %T", name, raw)}
+		}
+		if event.Attributes == nil {
+			event.Attributes = make(map[string]string)
+		}
+		event.Attributes[name] = fmt.Sprint(raw)
+	}
+	if r.IDFormat == IDFormatUUID && event.ID != "" {
+		if _, err := uuid.Parse(event.ID); err != nil {
+			return Event{}, &ValidationError{RejectInvalidID, fmt.Sprintf("%q não é um UUID", event.ID)}
+		}
+	}
+	return event, nil
+}
+
+// numericValue converte os tipos numéricos que os decoders produzem
+// (json.Number, floats e inteiros do MessagePack).
+func numericValue(raw interface{}) (float64, bool) {
+	var value float64
+	switch v := raw.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		value = f
+	case float64:
+		value = v
+	case float32:
+		value = float64(v)
+	case int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, uint:
+		f, _ := json.Number(fmt.Sprint(v)).Float64()
+		value = f
+	default:
+		return 0, false
+	}
+	return value, !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// RejectionCounter conta os payloads rejeitados por motivo.
+type RejectionCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func NewRejectionCounter() *RejectionCounter {
+	return &RejectionCounter{counts: make(map[string]int64)}
+}
+
+func (c *RejectionCounter) Add(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[reason]++
+}
+
+func (c *RejectionCounter) Counts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int64, len(c.counts))
+	for reason, n := range c.counts {
+		counts[reason] = n
+	}
+	return counts
+}
+
+func (c *RejectionCounter) String() string {
+	counts := c.Counts()
+	if len(counts) == 0 {
+		return "nenhuma"
+	}
+
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%s=%d", reason, counts[reason])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+)
+
+func TestPayloadRules_Validate(t *testing.T) {
+	rules := DefaultPayloadRules()
+	rules.IDFormat = IDFormatUUID
+	rules.MaxSize = 64
+
+	tests := []struct {
+		name   string
+		body   string
+		reason string
+	}{
+		{"válido", `{"id":"0b6f1c55-8a4d-4c3e-9f4e-2b1d6a7c9e10"}`, ""},
+		{"grande demais", `{"id":"` + strings.Repeat("a", 64) + `"}`, RejectTooLarge},
+		{"JSON inválido", `{"id":`, RejectMalformed},
+		{"não é objeto", `["id"]`, RejectMalformed},
+		{"id com tipo errado", `{"id":42}`, RejectMalformed},
+		{"campo desconhecido", `{"id":"x","extra":1}`, RejectUnknownField},
+		{"id ausente", `{}`, RejectMissingField},
+		{"id vazio", `{"id":""}`, RejectMissingField},
+		{"id nulo", `{"id":null}`, RejectMissingField},
+		{"id fora do formato", `{"id":"msg-1"}`, RejectInvalidID},
+		{"valor numérico", `{"id":"0b6f1c55-8a4d-4c3e-9f4e-2b1d6a7c9e10","value":12.5}`, ""},
+		{"valor em texto", `{"id":"0b6f1c55-8a4d-4c3e-9f4e-2b1d6a7c9e10","value":"12"}`, RejectMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := rules.Validate([]byte(tt.body))
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("Payload válido rejeitado: %v", err)
+				}
+				if event.ID == "" {
+					t.Error("ID deveria ser decodificado")
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Esperado ValidationError, obtido %v", err)
+			}
+			if verr.Reason != tt.reason {
+				t.Errorf("Esperado motivo %s, obtido %s (%s)", tt.reason, verr.Reason, verr.Detail)
+			}
+		})
+	}
+}
+
+func TestPayloadRules_AllowUnknown(t *testing.T) {
+	rules := DefaultPayloadRules()
+	rules.AllowUnknown = true
+
+	if _, err := rules.Validate([]byte(`{"id":"msg-1","extra":true}`)); err != nil {
+		t.Errorf("Campo desconhecido deveria ser aceito: %v", err)
+	}
+}
+
+func TestRejectionCounter(t *testing.T) {
+	counter := NewRejectionCounter()
+	if counter.String() != "nenhuma" {
+		t.Errorf("Contador vazio inesperado: %s", counter)
+	}
+
+	counter.Add(RejectMissingField)
+	counter.Add(RejectMalformed)
+	counter.Add(RejectMissingField)
+
+	if got := counter.Counts()[RejectMissingField]; got != 2 {
+		t.Errorf("Esperadas 2 rejeições por campo ausente, obtidas %d", got)
+	}
+	if got := counter.String(); got != "malformed=1, missing_field=2" {
+		t.Errorf("Resumo inesperado: %s", got)
+	}
+}
+
+func TestAsValidationError(t *testing.T) {
+	wrapped := fmt.Errorf("lote: %w", &ValidationError{Reason: RejectInvalidID, Detail: "x"})
+	if verr := AsValidationError(wrapped); verr.Reason != RejectInvalidID {
+		t.Errorf("ValidationError embrulhado deveria ser preservado, obtido %v", verr)
+	}
+	if verr := AsValidationError(errors.New("falha do decoder")); verr.Reason != RejectMalformed || verr.Detail != "falha do decoder" {
+		t.Errorf("Outros erros deveriam virar malformed, obtido %v", verr)
+	}
+}
+
+func TestPayloadRules_DecompressesBeforeDecoding(t *testing.T) {
+	rules := DefaultPayloadRules()
+	rules.MaxDecompressedSize = 256
+
+	msg, _ := codec.Compress(broker.Message{Body: []byte(`{"id":"m-1"}`), ContentType: codec.ContentTypeJSON}, codec.EncodingZstd)
+	if event, err := rules.Decode(codec.NewRegistry(), msg); err != nil || event.ID != "m-1" {
+		t.Errorf("Payload zstd deveria ser aceito, obtido %+v (%v)", event, err)
+	}
+
+	padded := `{"id":"m-2","pad":"` + strings.Repeat(" ", 512) + `"}`
+	msg, _ = codec.Compress(broker.Message{Body: []byte(padded)}, codec.EncodingGzip)
+	var verr *ValidationError
+	if _, err := rules.Decode(codec.NewRegistry(), msg); !errors.As(err, &verr) || verr.Reason != RejectTooLarge {
+		t.Errorf("Payload acima do limite descomprimido deveria ser rejeitado por tamanho, obtido %v", err)
+	}
+
+	msg.ContentEncoding = "br"
+	if _, err := rules.Decode(codec.NewRegistry(), msg); !errors.As(err, &verr) || verr.Reason != RejectEncoding {
+		t.Errorf("Encoding desconhecido deveria ser rejeitado, obtido %v", err)
+	}
+}
+
+func TestPayloadRules_DecodeBatch(t *testing.T) {
+	rules := DefaultPayloadRules()
+	body := `[{"uid":"m-1","event_type":"created","user_id":"user_a"},{"uid":"m-2","event_type":"created"},{"uid":"","event_type":"updated","user_id":"user_a"}]`
+
+	entries, err := rules.DecodeBatch(broker.Message{Body: []byte(body), ContentType: codec.ContentTypeBatch})
+	if err != nil {
+		t.Fatalf("Erro ao decodificar lote: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Esperados 3 eventos, obtidos %d", len(entries))
+	}
+	if entries[0].Err != nil || entries[0].Event.ID != "m-1" || entries[0].Event.UserID != "user_a" || entries[0].Event.EventType != "created" {
+		t.Errorf("Primeiro evento inesperado: %+v", entries[0])
+	}
+	for i, detail := range map[int]string{1: "user_id", 2: "id"} {
+		var verr *ValidationError
+		if !errors.As(entries[i].Err, &verr) || verr.Reason != RejectMissingField || verr.Detail != detail {
+			t.Errorf("Evento %d deveria faltar %s, obtido %v", i, detail, entries[i].Err)
+		}
+	}
+
+	var verr *ValidationError
+	if _, err := rules.DecodeBatch(broker.Message{Body: []byte(`{"uid":"m-1"}`)}); !errors.As(err, &verr) || verr.Reason != RejectMalformed {
+		t.Errorf("Envelope que não é array deveria ser malformado, obtido %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+)
+
+// resultsFlusher grava os resultados parciais a cada interval (0 desliga) e
+// no encerramento. O intervalo pode mudar em execução; o diretório não, pois
+// os snapshots e o estado do ciclo de vida são retomados dele.
+type resultsFlusher struct {
+	tenants    *domain.TenantRegistry
+	lifecycle  *domain.LifecycleRegistry
+	instanceID string
+	dir        string
+
+	mu       sync.Mutex
+	interval time.Duration
+	changed  chan struct{}
+}
+
+func newResultsFlusher(tenants *domain.TenantRegistry, instanceID, dir string, interval time.Duration) *resultsFlusher {
+	return &resultsFlusher{
+		tenants:    tenants,
+		instanceID: instanceID,
+		dir:        dir,
+		interval:   interval,
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+func (f *resultsFlusher) Update(interval time.Duration) {
+	f.mu.Lock()
+	f.interval = interval
+	f.mu.Unlock()
+
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (f *resultsFlusher) currentInterval() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.interval
+}
+
+func (f *resultsFlusher) Run(ctx context.Context) {
+	for {
+		interval := f.currentInterval()
+
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if interval > 0 {
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+
+		select {
+		case <-tick:
+			if err := f.Flush(); err != nil {
+				logger.Error("Erro ao gravar resultados parciais: %v", err)
+			}
+		case <-f.changed:
+		case <-ctx.Done():
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (f *resultsFlusher) Flush() error {
+	dir := f.dir
+	if err := f.tenants.SaveResults(dir); err != nil {
+		return err
+	}
+	if f.lifecycle != nil {
+		if err := f.lifecycle.SaveReports(dir); err != nil {
+			return err
+		}
+		if err := f.lifecycle.SaveStates(dir, f.instanceID); err != nil {
+			return err
+		}
+	}
+	return f.tenants.SaveSnapshots(dir, f.instanceID)
+}
@@ -2,115 +2,397 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/Julia-Marcal/eventcounter/cmd/consumer/config"
 	rabbitmq "github.com/Julia-Marcal/eventcounter/cmd/consumer/connection"
 	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
 	"github.com/Julia-Marcal/eventcounter/pkg/logger"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
 )
 
-func startConsumer(ctx context.Context, messages <-chan amqp.Delivery, dispatcher *domain.Dispatcher, counter *domain.EventCounter) {
-	timeout_ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+// consumer reúne o que o laço de consumo usa além do dispatcher: validação
+// e decodificação dos payloads, quarentena, filtro, agrupamento e a
+// política dos lotes. newConsumer preenche os valores padrão.
+type consumer struct {
+	dispatcher *domain.Dispatcher
+	tenants    *domain.TenantRegistry
+
+	idleTimeout  time.Duration
+	tenantHeader string
+	payloadRules domain.PayloadRules
+	decoders     *codec.Registry
+	quarantine   *rabbitmq.Quarantine
+	rejections   *domain.RejectionCounter
+	groupBy      domain.GroupBy
+	filter       *domain.Filter
+	batchPolicy  domain.BatchFailurePolicy
+}
+
+func newConsumer(dispatcher *domain.Dispatcher, tenants *domain.TenantRegistry) *consumer {
+	filter, _ := domain.ParseFilter(nil)
+	return &consumer{
+		dispatcher:   dispatcher,
+		tenants:      tenants,
+		idleTimeout:  5 * time.Second,
+		tenantHeader: "x-tenant",
+		payloadRules: domain.DefaultPayloadRules(),
+		decoders:     codec.NewRegistry(),
+		rejections:   domain.NewRejectionCounter(),
+		groupBy:      domain.GroupBy{{Source: domain.DimensionUser, Name: domain.DimensionUser}},
+		filter:       filter,
+		batchPolicy:  domain.BatchRequeue,
+	}
+}
+
+// rejectPayload conta a rejeição e manda a mensagem para a quarentena, se
+// houver uma; sem quarentena (ou se a publicação falhar) ela é rejeitada
+// sem reenfileirar.
+func (c *consumer) rejectPayload(ctx context.Context, msg broker.Delivery, verr *domain.ValidationError) {
+	c.rejections.Add(verr.Reason)
+	logger.Error("Mensagem rejeitada: %v", verr)
+
+	if c.quarantine != nil {
+		err := c.quarantine.Send(ctx, msg.Message, verr.Reason, verr.Detail)
+		if err == nil {
+			msg.Ack()
+			return
+		}
+		logger.Error("Falha ao enviar para a quarentena: %v", err)
+	}
+	msg.Nack(false)
+}
 
+// messageTenant prefere o tenant capturado na chave de roteamento e, sem ele,
+// usa o header tenantHeader.
+func (c *consumer) messageTenant(msg broker.Delivery, event_msg domain.EventMessage) string {
+	if tenant := event_msg.Attributes["tenant"]; tenant != "" {
+		return tenant
+	}
+	tenant, _ := msg.Headers[c.tenantHeader].(string)
+	return tenant
+}
+
+func startConsumer(ctx context.Context, messages <-chan broker.Delivery, c *consumer) {
 	for {
+		timeout_ctx, cancel := context.WithTimeout(ctx, c.idleTimeout)
+
 		select {
 		case msg, ok := <-messages:
+			cancel()
 			if !ok {
 				logger.System("Canal de mensagens fechado")
 				return
 			}
 
+			c.consume(ctx, msg)
+
+		case <-timeout_ctx.Done():
 			cancel()
-			timeout_ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+			if timeout_ctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				logger.System("Nenhuma mensagem recebida por %s, encerrando...", c.idleTimeout)
+			} else {
+				logger.System("Contexto cancelado, encerrando consumer...")
+			}
+			return
+		}
+	}
+}
 
-			logger.Info("Corpo da mensagem bruta: %s", string(msg.Body))
-			logger.Info("Chave de roteamento: %s", msg.RoutingKey)
+func (c *consumer) consume(ctx context.Context, msg broker.Delivery) {
+	logger.Info("Corpo da mensagem bruta: %s", string(msg.Body))
+	logger.Info("Chave de roteamento: %s", msg.RoutingKey)
 
-			var event domain.Event
-			err := json.Unmarshal(msg.Body, &event)
-			if err != nil {
-				logger.Error("Falha ao deserializar mensagem: %v", err)
-				msg.Nack(false, false)
-				continue
-			}
+	if codec.IsBatch(msg.Message) {
+		c.consumeBatch(ctx, msg)
+		return
+	}
 
-			if counter.IsProcessed(event.ID) {
-				logger.Warning("Evento %s já processado, ignorando", event.ID)
-				msg.Ack(false)
-				continue
-			}
+	event, err := c.payloadRules.Decode(c.decoders, msg.Message)
+	if err != nil {
+		c.rejectPayload(ctx, msg, domain.AsValidationError(err))
+		return
+	}
 
-			user_id, event_type, err := dispatcher.ParseRoutingKey(msg.RoutingKey)
-			if err != nil || user_id == "" || event_type == "" {
-				logger.Error("Falha ao analisar chave de roteamento: %s", msg.RoutingKey)
-				msg.Nack(false, false)
-				continue
-			}
+	event_msg, err := c.dispatcher.ParseRoutingKeyFields(msg.RoutingKey)
+	if err != nil {
+		logger.Error("Falha ao analisar chave de roteamento: %v", err)
+		msg.Nack(false)
+		return
+	}
+	if err := event.MatchRoutingKey(event_msg); err != nil {
+		c.rejectPayload(ctx, msg, domain.AsValidationError(err))
+		return
+	}
 
-			logger.Process("Processando evento: ID=%s, UserID=%s, Type=%s", event.ID, user_id, event_type)
-			counter.MarkProcessed(event.ID)
+	event_msg.Tenant = c.messageTenant(msg, event_msg)
+	if err := routing.ValidTenant(event_msg.Tenant); err != nil {
+		logger.Error("Mensagem %s descartada: %v", event.ID, err)
+		msg.Nack(false)
+		return
+	}
 
-			event_msg := domain.EventMessage{
-				UserID:    user_id,
-				EventType: strings.ToLower(event_type),
-				MessageID: event.ID,
-			}
-			dispatcher.Dispatch(ctx, event_msg)
+	event_msg.EventType = strings.ToLower(event_msg.EventType)
+	if allowed, rule := c.filter.Allow(event_msg, msg.Headers, event.Attributes); !allowed {
+		logger.Info("Evento %s ignorado pelo filtro: %s", event.ID, rule)
+		msg.Ack()
+		return
+	}
 
-			msg.Ack(false)
+	counter := c.tenants.Counter(event_msg.Tenant)
+	if counter.IsProcessed(event.ID) {
+		logger.Warning("Evento %s já processado, ignorando", event.ID)
+		msg.Ack()
+		return
+	}
 
-		case <-timeout_ctx.Done():
-			if timeout_ctx.Err() == context.DeadlineExceeded {
-				logger.System("Nenhuma mensagem recebida por 5 segundos, encerrando...")
+	logger.Process("Processando evento: ID=%s, Tenant=%s, UserID=%s, Type=%s", event.ID, event_msg.Tenant, event_msg.UserID, event_msg.EventType)
+	counter.MarkProcessed(event.ID)
+
+	event_msg.MessageID = event.ID
+	event_msg.Value = event.Value
+	event_msg.Group = c.groupBy.Values(event_msg, msg.Headers, event.Attributes)
+	event_msg.OnApplied = func() { msg.Ack() }
+	event_msg.OnDropped = func() {
+		counter.UnmarkProcessed(event.ID)
+		msg.Nack(false)
+	}
+	if err := c.dispatcher.Dispatch(ctx, event_msg); err != nil {
+		counter.UnmarkProcessed(event.ID)
+		if errors.Is(err, domain.ErrDispatcherFull) {
+			logger.Warning("Dispatcher cheio, devolvendo evento %s para a fila", event.ID)
+		} else {
+			logger.Error("Falha ao despachar evento %s: %v", event.ID, err)
+		}
+		msg.Nack(true)
+	}
+}
+
+// openSource abre a origem configurada; o broker só é devolvido para AMQP,
+// onde também serve para publicar na quarentena. Origens sem chave de
+// roteamento própria a montam com schema.
+func openSource(cfg *config.Config, schema *routing.Schema) (broker.Source, broker.Broker, func(), error) {
+	switch {
+	case cfg.Source == "amqp":
+		opts, err := cfg.AMQP.DialOptions()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		queue_args, err := cfg.AMQP.QueueArguments()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		b, source, err := rabbitmq.ConsumeMessages(rabbitmq.AMQPConfig{
+			URL:                cfg.AMQP.ConnString(),
+			Queue:              cfg.AMQP.Queue,
+			QueueArgs:          queue_args,
+			Exchange:           cfg.AMQP.Exchange,
+			ExchangeType:       cfg.AMQP.ExchangeType,
+			Bindings:           cfg.AMQP.Bindings,
+			DeadLetterExchange: cfg.AMQP.DeadLetterExchange,
+			DeadLetterQueue:    cfg.AMQP.DeadLetterQueue,
+			QuarantineQueue:    cfg.AMQP.QuarantineQueue,
+			Passive:            cfg.AMQP.Passive,
+			Prefetch:           cfg.AMQP.Prefetch,
+			Options:            opts,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return source, b, func() {
+			source.Close()
+			b.Close()
+		}, nil
+	case cfg.Source == "kafka":
+		source, err := rabbitmq.ConsumeKafka(rabbitmq.KafkaConfig{
+			Brokers: cfg.Kafka.Brokers,
+			Topic:   cfg.Kafka.Topic,
+			Group:   cfg.Kafka.Group,
+			Schema:  schema,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return source, nil, func() {
+			if err := source.Close(); err != nil {
+				logger.Error("Erro ao fechar origem Kafka: %v", err)
 			}
-			return
+		}, nil
+	case strings.HasPrefix(cfg.Source, "file:"):
+		source, err := rabbitmq.ConsumeFile(strings.TrimPrefix(cfg.Source, "file:"), cfg.SourceOffset, schema)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return source, nil, closeReplay(source), nil
+	case cfg.Source == "stdin":
+		source, err := rabbitmq.ConsumeReader("stdin", os.Stdin, cfg.SourceOffset, schema)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return source, nil, closeReplay(source), nil
+	default:
+		return nil, nil, nil, fmt.Errorf("origem desconhecida: %s", cfg.Source)
+	}
+}
 
-		case <-ctx.Done():
-			logger.System("Contexto cancelado, encerrando consumer...")
-			return
+func closeReplay(source broker.Source) func() {
+	return func() {
+		if err := source.Close(); err != nil {
+			logger.Error("Erro ao fechar replay: %v", err)
 		}
 	}
 }
 
+func setLogLevel(name string) {
+	level, err := logger.ParseLevel(name)
+	if err != nil {
+		logger.Error("%v", err)
+		return
+	}
+	logger.SetLevel(level)
+}
+
 func main() {
-	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "merge" {
+		runMerge(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if cfg != nil && cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			logger.Error("Erro ao imprimir configuração: %v", err)
+		}
+	}
 	if err != nil {
-		logger.Fatalf("Falha ao carregar configuração: %v", err)
+		logger.Fatalf("Configuração inválida:\n%v", err)
+	}
+	if cfg.PrintConfig {
+		return
+	}
+	if cfg.File != "" {
+		logger.Info("Configuração carregada de %s", cfg.File)
 	}
+	setLogLevel(cfg.LogLevel)
 
-	messages, conn, ch, err := rabbitmq.ConsumeMessages(cfg.RabbitMQConnString, cfg.QueueName)
+	schema, err := routing.NewSchema(cfg.RoutingKeyPattern)
+	if err != nil {
+		logger.Fatalf("Padrão de chave de roteamento inválido: %v", err)
+	}
+
+	source, source_broker, closeSource, err := openSource(cfg, schema)
 	if err != nil {
 		logger.Fatal("Falha ao consumir mensagens:", err)
 	}
-	defer conn.Close()
-	defer ch.Close()
+	defer closeSource()
+
+	group_by, err := cfg.GroupBy.GroupBy()
+	if err != nil {
+		logger.Fatalf("Agrupamento inválido: %v", err)
+	}
+	filter, err := cfg.Filter.Filter()
+	if err != nil {
+		logger.Fatalf("Filtro inválido: %v", err)
+	}
+
+	tenants := domain.NewTenantRegistry(domain.NewEventCounter(), cfg.Tenant.MaxUsers)
+	tenants.SetAggregations(cfg.Aggregations.Aggregations())
+	tenants.SetColumns(group_by.Columns())
+	if cfg.ResumesCounts() {
+		restored, err := tenants.RestoreSnapshots(cfg.ResultsDir, cfg.InstanceID)
+		if err != nil {
+			logger.Fatalf("Falha ao retomar snapshots da instância %s: %v", cfg.InstanceID, err)
+		}
+		if restored > 0 {
+			logger.Info("Contagens da instância %s retomadas de %d snapshots em %s", cfg.InstanceID, restored, cfg.ResultsDir)
+		}
+	}
+
+	var lifecycle *domain.LifecycleRegistry
+	if cfg.Lifecycle {
+		lifecycle = domain.NewLifecycleRegistry()
+		if cfg.ResumesCounts() {
+			restored, err := lifecycle.RestoreStates(cfg.ResultsDir, cfg.InstanceID)
+			if err != nil {
+				logger.Fatalf("Falha ao retomar o ciclo de vida da instância %s: %v", cfg.InstanceID, err)
+			}
+			if restored > 0 {
+				logger.Info("Ciclo de vida da instância %s retomado de %d estados em %s", cfg.InstanceID, restored, cfg.ResultsDir)
+			}
+		}
+		if cfg.Dispatcher.Lanes == 0 {
+			logger.Warning("Ciclo de vida sem dispatcher.lanes: eventos do mesmo usuário podem chegar fora de ordem e gerar falsas anomalias")
+		}
+	}
 
-	counter := domain.NewEventCounter()
-	dispatcher := domain.NewDispatcher(counter)
+	dispatcher := domain.NewDispatcher(tenants.Counter(domain.DefaultTenant),
+		domain.WithRoutingKeySchema(schema),
+		domain.WithTenants(tenants),
+		domain.WithLifecycle(lifecycle),
+		domain.WithWorkers(cfg.Workers),
+		domain.WithOrderedLanes(cfg.Dispatcher.Lanes),
+		domain.WithCapacity(cfg.Dispatcher.Capacity),
+		domain.WithOverflowPolicy(domain.OverflowPolicy(cfg.Dispatcher.Overflow), cfg.Dispatcher.SpillDir),
+	)
 	defer dispatcher.Close()
 
+	c := newConsumer(dispatcher, tenants)
+	c.idleTimeout = cfg.IdleTimeout
+	c.tenantHeader = cfg.Tenant.Header
+	c.payloadRules = cfg.Validation.PayloadRules()
+	c.payloadRules.Extra = append(group_by.PayloadFields(), filter.PayloadFields()...)
+	c.groupBy = group_by
+	c.filter = filter
+	c.batchPolicy = domain.BatchFailurePolicy(cfg.Batch.FailurePolicy)
+	if cfg.AMQP.QuarantineQueue != "" {
+		if source_broker != nil {
+			c.quarantine = rabbitmq.NewQuarantine(source_broker, cfg.AMQP.QuarantineQueue)
+		} else {
+			logger.Warning("amqp.quarantine_queue ignorada: a origem %s não é AMQP", cfg.Source)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	dispatcher.StartWorkers(ctx)
 
-	logger.System(" [*] Aguardando mensagens. Serviço será encerrado após 5s sem mensagens")
+	flusher := newResultsFlusher(tenants, cfg.InstanceID, cfg.ResultsDir, cfg.FlushInterval)
+	flusher.lifecycle = lifecycle
+	go flusher.Run(ctx)
+
+	watcher := config.NewWatcher(os.Args[1:], cfg, func(next *config.Config) {
+		setLogLevel(next.LogLevel)
+		dispatcher.SetWorkers(next.Workers)
+		flusher.Update(next.FlushInterval)
+	})
+	go watcher.Run(ctx)
+
+	logger.System(" [*] Aguardando mensagens. Serviço será encerrado após %s sem mensagens", c.idleTimeout)
 
-	startConsumer(ctx, messages, dispatcher, counter)
+	startConsumer(ctx, source.Deliveries(), c)
 
 	logger.System("Aguardando processamento de todas as mensagens...")
 	dispatcher.WaitForCompletion()
+	logger.Info("Dispatcher: %s", dispatcher.Stats())
+	logger.Info("Payloads rejeitados: %s", c.rejections)
+	logger.Info("Eventos filtrados: %s", c.filter)
 
 	logger.System("Salvando resultados...")
-	if err := counter.SaveResults(); err != nil {
+	if err := flusher.Flush(); err != nil {
 		logger.Error("Erro ao salvar resultados: %v", err)
 	} else {
-		logger.Success("Resultados salvos com sucesso!")
+		logger.Success("Resultados e snapshots da instância %s salvos em %s", cfg.InstanceID, cfg.ResultsDir)
 	}
 
 	logger.System("Serviço parado")
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rabbitmq "github.com/Julia-Marcal/eventcounter/cmd/consumer/connection"
+	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+	"github.com/Julia-Marcal/eventcounter/cmd/generator/workload"
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+func publish(t *testing.T, b broker.Broker, routing_key, body string) {
+	t.Helper()
+	publishWithHeaders(t, b, routing_key, body, nil)
+}
+
+func publishWithHeaders(t *testing.T, b broker.Broker, routing_key, body string, headers map[string]interface{}) {
+	t.Helper()
+
+	if _, err := b.Publish(context.Background(), "eventcountertest", broker.Message{
+		RoutingKey: routing_key,
+		Body:       []byte(body),
+		Headers:    headers,
+	}, false); err != nil {
+		t.Fatalf("Erro ao publicar mensagem: %v", err)
+	}
+}
+
+func publishWithContentType(t *testing.T, b broker.Broker, routing_key, body, content_type string) {
+	t.Helper()
+
+	if _, err := b.Publish(context.Background(), "eventcountertest", broker.Message{
+		RoutingKey:  routing_key,
+		Body:        []byte(body),
+		ContentType: content_type,
+	}, false); err != nil {
+		t.Fatalf("Erro ao publicar mensagem: %v", err)
+	}
+}
+
+// newTestPipeline liga uma fila em memória aos bindings e monta um
+// consumidor sobre um tenant registry novo (com limite max_users). run
+// consome a fila até ela ficar ociosa e espera o dispatcher.
+func newTestPipeline(t *testing.T, bindings []string, max_users int, opts ...domain.DispatcherOption) (*broker.Memory, *consumer, func()) {
+	t.Helper()
+
+	b := broker.NewMemory()
+	b.DeclareExchange("eventcountertest", "topic")
+	source, err := rabbitmq.Consume(b, rabbitmq.AMQPConfig{
+		Queue:           "eventcountertest",
+		Exchange:        "eventcountertest",
+		Bindings:        bindings,
+		QuarantineQueue: "eventcountertest.quarantine",
+	})
+	if err != nil {
+		t.Fatalf("Erro ao consumir fila em memória: %v", err)
+	}
+	t.Cleanup(func() { source.Close() })
+
+	tenants := domain.NewTenantRegistry(domain.NewEventCounter(), max_users)
+	dispatcher := domain.NewDispatcher(tenants.Counter(domain.DefaultTenant), append([]domain.DispatcherOption{domain.WithTenants(tenants)}, opts...)...)
+	t.Cleanup(dispatcher.Close)
+
+	c := newConsumer(dispatcher, tenants)
+	c.idleTimeout = 100 * time.Millisecond
+
+	run := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		dispatcher.StartWorkers(ctx)
+
+		startConsumer(ctx, source.Deliveries(), c)
+		dispatcher.WaitForCompletion()
+	}
+	return b, c, run
+}
+
+func TestStartConsumer_InMemoryPipeline(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+
+	for i := 0; i < 5; i++ {
+		publish(t, b, "user_a.event.created", fmt.Sprintf(`{"id":"c-%d"}`, i))
+	}
+	publish(t, b, "user_b.event.updated", `{"id":"u-1"}`)
+	publish(t, b, "user_b.event.deleted", `{"id":"d-1"}`)
+	publish(t, b, "user_a.event.created", `{"id":"c-0"}`)
+	publish(t, b, "user_a.event.created", `{"id":`)
+	publish(t, b, ".event.created", `{"id":"bad-key"}`)
+	publish(t, b, "user_a.event.archived", `{"id":"unknown"}`)
+
+	run()
+
+	totals := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()
+	if totals["created"]["user_a"] != 5 {
+		t.Errorf("Esperado 5 eventos created para user_a, obtido %d", totals["created"]["user_a"])
+	}
+	if totals["updated"]["user_b"] != 1 || totals["deleted"]["user_b"] != 1 {
+		t.Errorf("Esperado 1 evento updated e 1 deleted para user_b, obtido %v", totals)
+	}
+	if depth := b.Depth("eventcountertest"); depth != 0 {
+		t.Errorf("Todas as mensagens deveriam ter sido confirmadas ou descartadas, restam %d", depth)
+	}
+}
+
+// TestStartConsumer_MatchesGeneratorSummary publica a carga do gerador,
+// com falhas injetadas, no broker em memória e confere as contagens do
+// consumidor com o resumo esperado do gerador.
+func TestStartConsumer_MatchesGeneratorSummary(t *testing.T) {
+	cases := []struct {
+		name      string
+		format    string
+		compress  string
+		batchSize int
+	}{
+		{"json", codec.FormatJSON, "none", 1},
+		{"msgpack+gzip", codec.FormatMsgPack, codec.EncodingGzip, 1},
+		{"protobuf", codec.FormatProtobuf, "none", 1},
+		{"cloudevents", codec.FormatCloudEventsBinary, "none", 1},
+		{"lotes", codec.FormatJSON, codec.EncodingZstd, 7},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+			publisher := &workload.Publisher{
+				Broker:         b,
+				Exchange:       "eventcountertest",
+				Format:         tc.format,
+				Compress:       tc.compress,
+				BatchSize:      tc.batchSize,
+				MaxRetries:     3,
+				ConfirmTimeout: time.Second,
+			}
+
+			generator := workload.NewWorkload(workload.DefaultProfile(), 42, workload.FaultRates{Duplicate: 5, CorruptBody: 5, UnknownType: 5, BadRoutingKey: 5})
+			msgs := make([]*workload.Outgoing, 200)
+			for i := range msgs {
+				msgs[i] = generator.Next()
+			}
+			if err := publisher.Publish(context.Background(), msgs, nil); err != nil {
+				t.Fatalf("Erro ao publicar: %v", err)
+			}
+
+			run()
+
+			expected := make(map[string]map[string]int)
+			for event_type, users := range workload.CountMessages(msgs) {
+				expected[string(event_type)] = users
+			}
+			totals := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()
+			for event_type, users := range expected {
+				for user_id, n := range users {
+					if got := totals[event_type][user_id]; got != n {
+						t.Errorf("%s %s: resumo esperava %d, consumidor contou %d", event_type, user_id, n, got)
+					}
+				}
+			}
+			for event_type, users := range totals {
+				for user_id, n := range users {
+					if _, ok := expected[event_type][user_id]; !ok {
+						t.Errorf("%s %s: contado %d vezes, mas fora do resumo", event_type, user_id, n)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStartConsumer_GeneratorKeysFollowSchema(t *testing.T) {
+	cases := []struct {
+		name      string
+		pattern   string
+		batchSize int
+	}{
+		{"tenant na chave", "{tenant}.{user}.event.{type}", 1},
+		{"tenant na chave, lotes", "{tenant}.{user}.event.{type}", 5},
+		{"tenant no header, lotes", routing.DefaultPattern, 5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := routing.NewSchema(tc.pattern)
+			if err != nil {
+				t.Fatalf("Erro ao compilar padrão: %v", err)
+			}
+			b, c, run := newTestPipeline(t, []string{schema.Binding()}, 0, domain.WithRoutingKeySchema(schema))
+			publisher := &workload.Publisher{
+				Broker:         b,
+				Exchange:       "eventcountertest",
+				KeySchema:      schema,
+				Tenant:         "acme",
+				Format:         codec.FormatJSON,
+				Compress:       "none",
+				BatchSize:      tc.batchSize,
+				MaxRetries:     3,
+				ConfirmTimeout: time.Second,
+			}
+
+			generator := workload.NewWorkload(workload.DefaultProfile(), 7, workload.FaultRates{BadRoutingKey: 5})
+			msgs := make([]*workload.Outgoing, 100)
+			for i := range msgs {
+				msgs[i] = generator.Next()
+			}
+			if err := publisher.Publish(context.Background(), msgs, nil); err != nil {
+				t.Fatalf("Erro ao publicar: %v", err)
+			}
+
+			run()
+
+			totals := c.tenants.Counter("acme").Snapshot("test").Totals()
+			for event_type, users := range workload.CountMessages(msgs) {
+				for user_id, n := range users {
+					if got := totals[string(event_type)][user_id]; got != n {
+						t.Errorf("%s %s: resumo esperava %d em acme, consumidor contou %d", event_type, user_id, n, got)
+					}
+				}
+			}
+			if len(c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()) != 0 {
+				t.Error("Nenhum evento deveria cair no tenant padrão")
+			}
+		})
+	}
+}
+
+func TestStartConsumer_TenantIsolation(t *testing.T) {
+	schema, err := routing.NewSchema("{tenant}.{user}.event.{type}")
+	if err != nil {
+		t.Fatalf("Erro ao compilar padrão: %v", err)
+	}
+	b, c, run := newTestPipeline(t, []string{"#"}, 1, domain.WithRoutingKeySchema(schema))
+
+	// O mesmo usuário e o mesmo ID de mensagem em tenants diferentes não
+	// podem ser deduplicados nem somados entre si.
+	publish(t, b, "acme.user_a.event.created", `{"id":"m-1"}`)
+	publish(t, b, "acme.user_a.event.created", `{"id":"m-2"}`)
+	publish(t, b, "globex.user_a.event.created", `{"id":"m-1"}`)
+	publish(t, b, "acme.user_b.event.created", `{"id":"m-3"}`)
+	publish(t, b, "ac/me.user_a.event.created", `{"id":"m-4"}`)
+
+	run()
+
+	acme := c.tenants.Counter("acme").Snapshot("test").Totals()
+	globex := c.tenants.Counter("globex").Snapshot("test").Totals()
+	if acme["created"]["user_a"] != 2 {
+		t.Errorf("Esperado 2 eventos para user_a em acme, obtido %d", acme["created"]["user_a"])
+	}
+	if _, ok := acme["created"]["user_b"]; ok {
+		t.Errorf("user_b deveria ter sido recusado pelo limite de usuários de acme")
+	}
+	if over := c.dispatcher.Stats().OverQuota; over != 1 {
+		t.Errorf("Esperado 1 evento recusado pela cota, obtido %d", over)
+	}
+	if globex["created"]["user_a"] != 1 {
+		t.Errorf("Esperado 1 evento para user_a em globex, obtido %d", globex["created"]["user_a"])
+	}
+	if len(c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()["created"]) != 0 {
+		t.Errorf("Nenhum evento deveria cair no tenant padrão")
+	}
+	if depth := b.Depth("eventcountertest"); depth != 0 {
+		t.Errorf("Todas as mensagens deveriam ter sido confirmadas ou descartadas, restam %d", depth)
+	}
+}
+
+func TestStartConsumer_TenantFromHeader(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+
+	publishWithHeaders(t, b, "user_a.event.updated", `{"id":"h-1"}`, map[string]interface{}{"x-tenant": "acme"})
+	publish(t, b, "user_a.event.updated", `{"id":"h-1"}`)
+
+	run()
+
+	if got := c.tenants.Counter("acme").Snapshot("test").Totals()["updated"]["user_a"]; got != 1 {
+		t.Errorf("Esperado 1 evento em acme, obtido %d", got)
+	}
+	if got := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()["updated"]["user_a"]; got != 1 {
+		t.Errorf("Esperado 1 evento no tenant padrão, obtido %d", got)
+	}
+}
+
+func TestStartConsumer_QuarantinesInvalidPayloads(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+	c.payloadRules.IDFormat = domain.IDFormatUUID
+	c.quarantine = rabbitmq.NewQuarantine(b, "eventcountertest.quarantine")
+
+	publish(t, b, "user_a.event.created", `{"id":"0b6f1c55-8a4d-4c3e-9f4e-2b1d6a7c9e10"}`)
+	publish(t, b, "user_a.event.created", `{"id":""}`)
+	publish(t, b, "user_a.event.created", `{}`)
+	publish(t, b, "user_a.event.created", `{"id":"msg-1"}`)
+	publish(t, b, "user_b.event.updated", `{"id":"0b6f1c55-8a4d-4c3e-9f4e-2b1d6a7c9e11","extra":1}`)
+
+	run()
+
+	if got := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()["created"]["user_a"]; got != 1 {
+		t.Errorf("Só o payload válido deveria ser contado, obtido %d", got)
+	}
+	if depth := b.Depth("eventcountertest"); depth != 0 {
+		t.Errorf("Payloads inválidos deveriam sair da fila, restam %d", depth)
+	}
+	if got := c.rejections.String(); got != "invalid_id=1, missing_field=2, unknown_field=1" {
+		t.Errorf("Contagem de rejeições inesperada: %s", got)
+	}
+
+	quarantined, err := b.Consume("eventcountertest.quarantine", 10)
+	if err != nil {
+		t.Fatalf("Erro ao consumir quarentena: %v", err)
+	}
+	defer quarantined.Close()
+
+	var reasons []string
+	for i := 0; i < 4; i++ {
+		select {
+		case d := <-quarantined.Deliveries():
+			reasons = append(reasons, d.Headers[rabbitmq.HeaderQuarantineReason].(string))
+			if d.Headers[rabbitmq.HeaderOriginalKey] == "" {
+				t.Error("Chave original deveria estar nos headers")
+			}
+			d.Ack()
+		case <-time.After(time.Second):
+			t.Fatalf("Esperadas 4 mensagens na quarentena, obtidas %v", reasons)
+		}
+	}
+	if fmt.Sprint(reasons) != "[missing_field missing_field invalid_id unknown_field]" {
+		t.Errorf("Motivos inesperados na quarentena: %v", reasons)
+	}
+}
+
+func TestStartConsumer_RejectsCloudEventsKeyMismatch(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+
+	for i, key := range []string{"user_a.event.created", "user_b.event.created", "user_a.event.deleted"} {
+		msg, err := codec.Encode(codec.FormatCloudEventsStructured, eventcounter.Message{UID: fmt.Sprintf("ce-%d", i), EventType: eventcounter.EventCreated, UserID: "user_a"})
+		if err != nil {
+			t.Fatalf("Erro ao codificar: %v", err)
+		}
+		msg.RoutingKey = key
+		if _, err := b.Publish(context.Background(), "eventcountertest", msg, false); err != nil {
+			t.Fatalf("Erro ao publicar: %v", err)
+		}
+	}
+
+	run()
+
+	totals := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()
+	if totals["created"]["user_a"] != 1 || totals["created"]["user_b"] != 0 || totals["deleted"]["user_a"] != 0 {
+		t.Errorf("Só o evento coerente com a chave deveria ser contado, obtido %v", totals)
+	}
+	if got := c.rejections.Counts()[domain.RejectKeyMismatch]; got != 2 {
+		t.Errorf("Esperadas 2 rejeições %s, obtidas %d", domain.RejectKeyMismatch, got)
+	}
+}
+
+func TestStartConsumer_DecodesEveryFormat(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+
+	for i, format := range codec.Formats {
+		msg, err := codec.Encode(format, eventcounter.Message{UID: fmt.Sprintf("f-%d", i), EventType: eventcounter.EventCreated, UserID: "user_a"})
+		if err != nil {
+			t.Fatalf("Erro ao codificar %s: %v", format, err)
+		}
+		msg.RoutingKey = "user_a.event.created"
+		if _, err := b.Publish(context.Background(), "eventcountertest", msg, false); err != nil {
+			t.Fatalf("Erro ao publicar: %v", err)
+		}
+	}
+	publishWithContentType(t, b, "user_a.event.created", "id: f-x", "text/yaml")
+
+	run()
+
+	if got := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()["created"]["user_a"]; got != len(codec.Formats) {
+		t.Errorf("Esperado um evento por formato (%d), obtido %d", len(codec.Formats), got)
+	}
+	if got := c.rejections.Counts()[domain.RejectContentType]; got != 1 {
+		t.Errorf("ContentType desconhecido deveria ser rejeitado, obtido %d", got)
+	}
+}
+
+func TestStartConsumer_Batches(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+
+	msg, err := codec.EncodeBatch([]eventcounter.Message{
+		{UID: "b-1", EventType: eventcounter.EventCreated, UserID: "user_a"},
+		{UID: "b-2", EventType: eventcounter.EventUpdated, UserID: "user_a"},
+		{UID: "b-1", EventType: eventcounter.EventCreated, UserID: "user_a"},
+		{UID: "b-3", EventType: eventcounter.EventCreated, UserID: "user_b"},
+	})
+	if err != nil {
+		t.Fatalf("Erro ao codificar lote: %v", err)
+	}
+	msg.RoutingKey = "batch.event.batch"
+	if _, err := b.Publish(context.Background(), "eventcountertest", msg, false); err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	publishWithContentType(t, b, "batch.event.batch", `[{"uid":"b-4","event_type":"created","user_id":"user_b"},{"uid":"b-5","event_type":"created"}]`, codec.ContentTypeBatch)
+	publishWithContentType(t, b, "batch.event.batch", `[]`, codec.ContentTypeBatch)
+
+	run()
+
+	totals := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()
+	if totals["created"]["user_a"] != 1 || totals["updated"]["user_a"] != 1 {
+		t.Errorf("UID repetido no lote deveria ser deduplicado, obtido %v", totals)
+	}
+	if totals["created"]["user_b"] != 2 {
+		t.Errorf("Eventos válidos de um lote com falha deveriam ser aplicados, obtido %v", totals)
+	}
+	if got := c.rejections.String(); got != "malformed=1, missing_field=1" {
+		t.Errorf("Contagem de rejeições inesperada: %s", got)
+	}
+	if depth := b.Depth("eventcountertest"); depth != 0 {
+		t.Errorf("Lotes deveriam ter sido confirmados ou rejeitados, restam %d", depth)
+	}
+}
+
+func TestStartConsumer_GroupByDimensions(t *testing.T) {
+	schema := routing.MustSchema("{region}.{user}.event.{type}")
+	b, c, run := newTestPipeline(t, []string{"*.*.event.*"}, 0, domain.WithRoutingKeySchema(schema))
+	c.groupBy, _ = domain.ParseGroupBy("", []string{"routing.region", "header.x-plan", "payload.source"})
+	c.payloadRules.Extra = c.groupBy.PayloadFields()
+
+	pro := map[string]interface{}{"x-plan": "pro"}
+	publishWithHeaders(t, b, "eu.user_a.event.created", `{"id":"g-1","source":"web"}`, pro)
+	publishWithHeaders(t, b, "eu.user_b.event.created", `{"id":"g-2","source":"web"}`, pro)
+	publishWithHeaders(t, b, "us.user_a.event.created", `{"id":"g-3","source":"web"}`, pro)
+	publish(t, b, "eu.user_a.event.created", `{"id":"g-4"}`)
+
+	run()
+
+	created := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()["created"]
+	for key, want := range map[string]int{
+		domain.GroupKey([]string{"eu", "pro", "web"}): 2,
+		domain.GroupKey([]string{"us", "pro", "web"}): 1,
+		domain.GroupKey([]string{"eu", "", ""}):       1,
+	} {
+		if created[key] != want {
+			t.Errorf("Chave %q: esperado %d, obtido %d (%v)", key, want, created[key], created)
+		}
+	}
+}
+
+func TestStartConsumer_BatchGroupByRouting(t *testing.T) {
+	schema := routing.MustSchema("{region}.{user}.event.{type}")
+	b, c, run := newTestPipeline(t, []string{"*.*.event.*"}, 0, domain.WithRoutingKeySchema(schema))
+	c.groupBy, _ = domain.ParseGroupBy("", []string{"routing.region"})
+
+	publishWithContentType(t, b, "eu.batch.event.batch", `[{"uid":"r-1","event_type":"created","user_id":"user_a"},{"uid":"r-2","event_type":"created","user_id":"user_b"}]`, codec.ContentTypeBatch)
+	publishWithContentType(t, b, "us.batch.event.batch", `[{"uid":"r-3","event_type":"created","user_id":"user_a"}]`, codec.ContentTypeBatch)
+
+	run()
+
+	created := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()["created"]
+	if created["eu"] != 2 || created["us"] != 1 {
+		t.Errorf("Lotes deveriam ser agrupados pela região da chave, obtido %v", created)
+	}
+}
+
+func TestStartConsumer_FilterRules(t *testing.T) {
+	b, c, run := newTestPipeline(t, []string{"*.event.*"}, 0)
+	c.filter, _ = domain.ParseFilter([]string{
+		"exclude user_id ~ test-*",
+		"exclude header.x-env == staging",
+		"exclude payload.source == internal",
+		"include event_type in created|updated",
+	})
+	c.payloadRules.Extra = c.filter.PayloadFields()
+
+	publish(t, b, "user_a.event.created", `{"id":"f-1"}`)
+	publish(t, b, "test-1.event.created", `{"id":"f-2"}`)
+	publishWithHeaders(t, b, "user_a.event.updated", `{"id":"f-3"}`, map[string]interface{}{"x-env": "staging"})
+	publish(t, b, "user_a.event.updated", `{"id":"f-4","source":"internal"}`)
+	publish(t, b, "user_a.event.deleted", `{"id":"f-5"}`)
+	publishWithContentType(t, b, "batch.event.batch", `[{"uid":"f-6","event_type":"created","user_id":"test-2"},{"uid":"f-7","event_type":"updated","user_id":"user_b","source":"web"}]`, codec.ContentTypeBatch)
+
+	run()
+
+	totals := c.tenants.Counter(domain.DefaultTenant).Snapshot("test").Totals()
+	if len(totals["created"]) != 1 || totals["created"]["user_a"] != 1 || len(totals["updated"]) != 1 || totals["updated"]["user_b"] != 1 || len(totals["deleted"]) != 0 {
+		t.Errorf("Só eventos aceitos pelo filtro deveriam ser contados, obtido %v", totals)
+	}
+	want := "exclude user_id ~ test-*=2, exclude header.x-env == staging=1, exclude payload.source == internal=1, default=1"
+	if got := c.filter.String(); got != want {
+		t.Errorf("Descartes inesperados: %s", got)
+	}
+	if depth := b.Depth("eventcountertest"); depth != 0 {
+		t.Errorf("Eventos filtrados deveriam ser confirmados, restam %d", depth)
+	}
+}
+
+// TestStartConsumer_ResumedReplayKeepsCounts retoma o replay de um arquivo
+// que cresceu entre duas execuções: a segunda parte do checkpoint e do
+// snapshot da primeira, sem zerar nem recontar as linhas já aplicadas.
+func TestStartConsumer_ResumedReplayKeepsCounts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	results := filepath.Join(dir, "results")
+
+	replay := func(restore bool) *domain.TenantRegistry {
+		tenants := domain.NewTenantRegistry(domain.NewEventCounter(), 0)
+		if restore {
+			if _, err := tenants.RestoreSnapshots(results, "test"); err != nil {
+				t.Fatalf("Erro ao restaurar snapshot: %v", err)
+			}
+		}
+		dispatcher := domain.NewDispatcher(tenants.Counter(domain.DefaultTenant), domain.WithTenants(tenants))
+		defer dispatcher.Close()
+
+		source, err := rabbitmq.ConsumeFile(path, -1, nil)
+		if err != nil {
+			t.Fatalf("Erro ao abrir replay: %v", err)
+		}
+		c := newConsumer(dispatcher, tenants)
+		c.idleTimeout = 100 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		dispatcher.StartWorkers(ctx)
+		startConsumer(ctx, source.Deliveries(), c)
+		dispatcher.WaitForCompletion()
+
+		if err := source.Close(); err != nil {
+			t.Fatalf("Erro ao fechar replay: %v", err)
+		}
+		if err := tenants.SaveSnapshots(results, "test"); err != nil {
+			t.Fatalf("Erro ao salvar snapshot: %v", err)
+		}
+		return tenants
+	}
+
+	lines := `{"id":"1","user_id":"user_a","event_type":"created"}
+{"id":"2","user_id":"user_a","event_type":"created"}
+{"id":"3","user_id":"user_b","event_type":"deleted"}
+`
+	if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatalf("Erro ao escrever arquivo: %v", err)
+	}
+	replay(false)
+
+	more := `{"id":"4","user_id":"user_a","event_type":"created"}
+{"id":"5","user_id":"user_b","event_type":"updated"}
+`
+	if err := os.WriteFile(path, []byte(lines+more), 0644); err != nil {
+		t.Fatalf("Erro ao escrever arquivo: %v", err)
+	}
+	totals := replay(true).Counter(domain.DefaultTenant).Snapshot("test").Totals()
+
+	if totals["created"]["user_a"] != 3 || totals["deleted"]["user_b"] != 1 || totals["updated"]["user_b"] != 1 {
+		t.Errorf("Replay retomado deveria somar às contagens anteriores, obtido %v", totals)
+	}
+}
+
+func TestResultsFlusher_PeriodicAndUpdate(t *testing.T) {
+	counter := domain.NewEventCounter()
+	tenants := domain.NewTenantRegistry(counter, 0)
+	counter.Created(context.Background(), "user_a")
+
+	dir := t.TempDir()
+	flusher := newResultsFlusher(tenants, "test", dir, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go flusher.Run(ctx)
+
+	waitFile := func(path string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Arquivo %s não foi gravado", path)
+	}
+
+	// Com intervalo 0 nada é gravado até a recarga ligar a gravação parcial.
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(dir, "created.json")); err == nil {
+		t.Fatal("Intervalo 0 não deveria gravar resultados parciais")
+	}
+	flusher.Update(10 * time.Millisecond)
+	waitFile(filepath.Join(dir, "created.json"))
+	waitFile(filepath.Join(dir, "snapshot-test.json"))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+)
+
+func runMerge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	outputDir := flags.String("out", "results", "Diretório de saída dos totais globais")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		logger.Fatalf("Uso: consumer merge [-out dir] snapshot.json [snapshot.json ...]")
+	}
+
+	merged := domain.NewSnapshot("merged")
+	for _, path := range flags.Args() {
+		snapshot, err := domain.LoadSnapshot(path)
+		if err != nil {
+			logger.Fatalf("Falha ao carregar snapshot: %v", err)
+		}
+		if err := merged.Merge(snapshot); err != nil {
+			logger.Fatalf("Falha ao mesclar %s: %v", path, err)
+		}
+		logger.Info("Snapshot %s (instância %s) mesclado", path, snapshot.InstanceID)
+	}
+
+	if err := merged.Save(domain.SnapshotPath(*outputDir, merged.InstanceID)); err != nil {
+		logger.Fatalf("Falha ao salvar snapshot mesclado: %v", err)
+	}
+
+	if err := domain.WriteResults(*outputDir, merged.Totals(), merged.ValueTotals(), merged.Columns, merged.Aggregations); err != nil {
+		logger.Error("Erro ao salvar totais globais: %v", err)
+		os.Exit(1)
+	}
+
+	logger.Success("%d instâncias mescladas em %s", len(merged.Counters), *outputDir)
+}
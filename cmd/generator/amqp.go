@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Julia-Marcal/eventcounter/cmd/generator/workload"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+// newPublisher conecta ao RabbitMQ e monta o publicador a partir das flags.
+func newPublisher() (*workload.Publisher, error) {
+	opts, err := amqpOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	queueArgs, err := broker.ParseQueueArgs(amqpQueueArgs)
+	if err != nil {
+		return nil, fmt.Errorf("-amqp-queue-arg: %w", err)
+	}
+	schema, err := routing.NewSchema(keyPattern)
+	if err != nil {
+		return nil, fmt.Errorf("-routing-key-pattern: %w", err)
+	}
+	if err := routing.ValidTenant(tenant); err != nil {
+		return nil, fmt.Errorf("-tenant: %w", err)
+	}
+
+	b, err := broker.DialAMQPWithOptions(amqpUrl, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workload.Publisher{
+		Broker:         b,
+		Exchange:       amqpExchange,
+		QueueArgs:      queueArgs,
+		KeySchema:      schema,
+		Tenant:         tenant,
+		Format:         format,
+		Compress:       compress,
+		BatchSize:      batchSize,
+		MaxRetries:     maxRetries,
+		ConfirmTimeout: confirmTimeout,
+	}, nil
+}
+
+// amqpOptions monta TLS e autenticação a partir das flags -amqp-tls-* e
+// -amqp-auth; os arquivos TLS só são usados com URLs amqps://.
+func amqpOptions() (broker.AMQPOptions, error) {
+	var opts broker.AMQPOptions
+	switch amqpAuth {
+	case "plain":
+	case "external":
+		if amqpTLS.CertFile == "" {
+			return opts, fmt.Errorf("-amqp-auth external exige -amqp-tls-cert e -amqp-tls-key")
+		}
+		opts.External = true
+	default:
+		return opts, fmt.Errorf("-amqp-auth desconhecido: %q (use plain ou external)", amqpAuth)
+	}
+
+	if !strings.HasPrefix(amqpUrl, "amqps://") {
+		if amqpTLS != (broker.TLSFiles{}) {
+			return opts, fmt.Errorf("opções -amqp-tls-* exigem uma URL amqps://")
+		}
+		return opts, nil
+	}
+
+	tls_config, err := amqpTLS.Config()
+	if err != nil {
+		return opts, err
+	}
+	opts.TLS = tls_config
+	return opts, nil
+}
@@ -0,0 +1,233 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+)
+
+var errMessagesLost = errors.New("mensagens não confirmadas pelo broker")
+
+// ConfirmStats conta mensagens. Published são as publicações originais e
+// Retried as republicações feitas por Finish, então uma mensagem
+// republicada aparece uma vez em cada.
+type ConfirmStats struct {
+	Published     int
+	Acked         int
+	Nacked        int
+	Returned      int
+	PublishErrors int
+	Unconfirmed   int
+	Retried       int
+	Lost          int
+}
+
+func (s ConfirmStats) String() string {
+	return fmt.Sprintf("publicadas: %d, confirmadas: %d, rejeitadas (nack): %d, devolvidas: %d, erros de publicação: %d, sem confirmação: %d, retentativas: %d, perdidas: %d",
+		s.Published, s.Acked, s.Nacked, s.Returned, s.PublishErrors, s.Unconfirmed, s.Retried, s.Lost)
+}
+
+type pendingConfirm struct {
+	msgs         []*Outgoing
+	confirmation *broker.Confirmation
+}
+
+// ConfirmTracker associa cada publicação à sua confirmação para que nacks,
+// devoluções (mandatory) e mensagens sem confirmação possam ser
+// republicadas.
+type ConfirmTracker struct {
+	mu        sync.Mutex
+	publisher *Publisher
+	pending   []pendingConfirm
+	failed    []*Outgoing
+	stats     ConfirmStats
+
+	// OnAcked, quando definido, recebe cada mensagem confirmada pelo broker,
+	// inclusive as republicadas por Finish.
+	OnAcked func(*Outgoing)
+}
+
+func NewConfirmTracker(publisher *Publisher) *ConfirmTracker {
+	return &ConfirmTracker{publisher: publisher}
+}
+
+// Publish publica uma mensagem avulsa ou, com mais de uma, um envelope em
+// lote. As estatísticas contam mensagens, e um lote que falha volta
+// inteiro para republicação.
+func (t *ConfirmTracker) Publish(ctx context.Context, vs ...*Outgoing) error {
+	return t.publish(ctx, false, vs)
+}
+
+func (t *ConfirmTracker) publish(ctx context.Context, retry bool, vs []*Outgoing) error {
+	msg, err := t.publisher.encodeOutgoing(vs)
+	if err != nil {
+		return err
+	}
+	if msg, err = codec.Compress(msg, t.publisher.Compress); err != nil {
+		return err
+	}
+
+	confirmation, err := t.publisher.Broker.Publish(ctx, t.publisher.Exchange, msg, true)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if retry {
+		t.stats.Retried += len(vs)
+	} else {
+		t.stats.Published += len(vs)
+	}
+	if err != nil {
+		t.stats.PublishErrors += len(vs)
+		t.failed = append(t.failed, vs...)
+		return err
+	}
+
+	t.pending = append(t.pending, pendingConfirm{msgs: vs, confirmation: confirmation})
+	return nil
+}
+
+func (p *Publisher) encodeOutgoing(vs []*Outgoing) (broker.Message, error) {
+	switch len(vs) {
+	case 0:
+		return broker.Message{}, errors.New("nenhuma mensagem para publicar")
+	case 1:
+		msg, err := vs[0].Encode(p.Format)
+		p.route(&msg, vs[0].keyFields())
+		msg.MessageID = vs[0].UID
+		return msg, err
+	}
+
+	msg, err := EncodeBatch(vs)
+	p.route(&msg, batchKeyFields)
+	msg.MessageID = "batch-" + vs[0].UID
+	return msg, err
+}
+
+// Settle aguarda a confirmação de todas as mensagens pendentes e devolve as
+// que falharam; mensagens sem confirmação até o timeout contam como falha.
+func (t *ConfirmTracker) Settle(ctx context.Context, timeout time.Duration) []*Outgoing {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	expired := false
+
+	for _, p := range pending {
+		if !expired {
+			select {
+			case <-p.confirmation.Done():
+			case <-deadline.C:
+				expired = true
+			case <-ctx.Done():
+				expired = true
+			}
+		}
+
+		t.mu.Lock()
+		t.classify(p, expired)
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failed := t.failed
+	t.failed = nil
+	return failed
+}
+
+// Reap contabiliza as confirmações já recebidas sem bloquear, para que a
+// publicação contínua não acumule pendências nem reporte progresso defasado.
+func (t *ConfirmTracker) Reap() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	remaining := t.pending[:0]
+	for _, p := range t.pending {
+		select {
+		case <-p.confirmation.Done():
+			t.classify(p, false)
+		default:
+			remaining = append(remaining, p)
+		}
+	}
+	t.pending = remaining
+}
+
+func (t *ConfirmTracker) classify(p pendingConfirm, expired bool) {
+	n := len(p.msgs)
+	select {
+	case <-p.confirmation.Done():
+	default:
+		if expired {
+			t.stats.Unconfirmed += n
+			t.failed = append(t.failed, p.msgs...)
+			return
+		}
+	}
+
+	switch {
+	case p.confirmation.Lost():
+		t.stats.Unconfirmed += n
+		t.failed = append(t.failed, p.msgs...)
+	case !p.confirmation.Acked():
+		t.stats.Nacked += n
+		t.failed = append(t.failed, p.msgs...)
+	case p.confirmation.Returned():
+		t.stats.Returned += n
+		t.failed = append(t.failed, p.msgs...)
+	default:
+		t.stats.Acked += n
+		if t.OnAcked != nil {
+			for _, v := range p.msgs {
+				t.OnAcked(v)
+			}
+		}
+	}
+}
+
+// Finish republica as mensagens que falharam até maxRetries vezes e
+// retorna errMessagesLost se alguma ainda assim não foi confirmada.
+func (t *ConfirmTracker) Finish(ctx context.Context, maxRetries int, timeout time.Duration) error {
+	failed := t.Settle(ctx, timeout)
+
+	for attempt := 1; attempt <= maxRetries && len(failed) > 0 && ctx.Err() == nil; attempt++ {
+		log.Printf("republicando %d mensagens (tentativa %d de %d)", len(failed), attempt, maxRetries)
+
+		size := t.publisher.batchSize()
+		for start := 0; start < len(failed); start += size {
+			chunk := failed[start:min(start+size, len(failed))]
+			if err := t.publish(ctx, true, chunk); err != nil {
+				log.Printf("não foi possível republicar %s, erro: %s", describe(chunk), err)
+			}
+		}
+		failed = t.Settle(ctx, timeout)
+	}
+
+	t.mu.Lock()
+	t.stats.Lost = len(failed)
+	stats := t.stats
+	t.mu.Unlock()
+
+	log.Printf("resumo da publicação: %s", stats)
+	if stats.Lost > 0 {
+		return fmt.Errorf("%w: %d", errMessagesLost, stats.Lost)
+	}
+	return nil
+}
+
+func (t *ConfirmTracker) Stats() ConfirmStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
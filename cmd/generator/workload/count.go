@@ -0,0 +1,86 @@
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	eventcounter "github.com/reb-felipe/eventcounter/pkg"
+)
+
+// Summary guarda as contagens esperadas após a filtragem do consumidor:
+// mensagens com falha injetada ficam de fora de Counts e são contadas em Faults.
+type Summary struct {
+	Counts map[eventcounter.EventType]map[string]int
+	Faults map[string]int
+}
+
+func NewSummary() *Summary {
+	return &Summary{
+		Counts: make(map[eventcounter.EventType]map[string]int),
+		Faults: make(map[string]int),
+	}
+}
+
+func (s *Summary) Add(v *Outgoing) {
+	if v.Fault != "" {
+		s.Faults[string(v.Fault)]++
+		return
+	}
+
+	if _, ok := s.Counts[v.EventType]; !ok {
+		s.Counts[v.EventType] = make(map[string]int)
+	}
+	s.Counts[v.EventType][v.UserID] += 1
+}
+
+func CountMessages(msgs []*Outgoing) map[eventcounter.EventType]map[string]int {
+	summary := NewSummary()
+	for _, v := range msgs {
+		summary.Add(v)
+	}
+	return summary.Counts
+}
+
+func Write(path string, msgs []*Outgoing) {
+	summary := NewSummary()
+	for _, v := range msgs {
+		summary.Add(v)
+	}
+	summary.Write(path)
+}
+
+func (s *Summary) Write(path string) {
+	for i, v := range s.Counts {
+		if err := createAndWriteFile(path, string(i), v); err != nil {
+			continue
+		}
+	}
+
+	if len(s.Faults) > 0 {
+		createAndWriteFile(path, "faults", s.Faults)
+	}
+}
+
+func createAndWriteFile(path, name string, content map[string]int) error {
+	file, err := os.Create(fmt.Sprintf("%s/%s.json", path, name))
+	if err != nil {
+		log.Printf("Não foi possível escrever arquivo %s.json, erro: %s", name, err)
+		return err
+	}
+	defer file.Close()
+
+	b, err := json.MarshalIndent(content, "", "\t")
+	if err != nil {
+		log.Printf("Não foi possível serializar dados para arquivo %s.json, erro: %s", name, err)
+		return err
+	}
+
+	if _, err := file.Write(b); err != nil {
+		log.Printf("Não foi possível escrever dados para arquivo %s.json, erro: %s", name, err)
+		return err
+	}
+
+	return nil
+}
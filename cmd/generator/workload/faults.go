@@ -0,0 +1,167 @@
+package workload
+
+import (
+	"fmt"
+	"math"
+
+	payload "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+	eventcounter "github.com/reb-felipe/eventcounter/pkg"
+)
+
+type Fault string
+
+const (
+	FaultDuplicate     Fault = "duplicate"
+	FaultCorruptBody   Fault = "corrupt_body"
+	FaultUnknownType   Fault = "unknown_type"
+	FaultBadRoutingKey Fault = "bad_routing_key"
+)
+
+const (
+	unknownEventType = eventcounter.EventType("archived")
+	duplicateHistory = 1000
+)
+
+// FaultRates são percentuais (0-100) de mensagens geradas com cada falha.
+type FaultRates struct {
+	Duplicate     float64
+	CorruptBody   float64
+	UnknownType   float64
+	BadRoutingKey float64
+}
+
+func (r FaultRates) Validate() error {
+	rates := map[string]float64{
+		"dup-pct":          r.Duplicate,
+		"corrupt-pct":      r.CorruptBody,
+		"unknown-type-pct": r.UnknownType,
+		"bad-key-pct":      r.BadRoutingKey,
+	}
+	total := 0.0
+	for name, v := range rates {
+		if v < 0 || v > 100 {
+			return fmt.Errorf("-%s deve estar entre 0 e 100, obtido %v", name, v)
+		}
+		total += v
+	}
+	if total > 100 {
+		return fmt.Errorf("a soma dos percentuais de falha não pode passar de 100, obtido %v", total)
+	}
+	return nil
+}
+
+// Outgoing é uma mensagem pronta para publicação. Mensagens com Fault são
+// descartadas pelo consumidor e não entram no resumo esperado.
+type Outgoing struct {
+	*eventcounter.Message
+	Fault Fault
+}
+
+// RoutingKey monta a chave no padrão padrão do consumidor.
+func (o *Outgoing) RoutingKey() string {
+	return defaultKeySchema.Format(o.keyFields())
+}
+
+// keyFields são os campos da chave de roteamento da mensagem. Em
+// bad_routing_key o usuário fica vazio: a chave ainda casa com o binding do
+// padrão e chega ao consumidor, mas é recusada por ParseRoutingKey.
+func (o *Outgoing) keyFields() map[string]string {
+	fields := map[string]string{"user": o.UserID, "type": string(o.EventType)}
+	if o.Fault == FaultBadRoutingKey {
+		fields["user"] = ""
+	}
+	return fields
+}
+
+func (o *Outgoing) Body() []byte {
+	if o.Fault == FaultCorruptBody {
+		return []byte(fmt.Sprintf(`{"id":"%s"`, o.UID))
+	}
+	return []byte(fmt.Sprintf(`{"id":"%s"}`, o.UID))
+}
+
+// Encode monta corpo, ContentType e headers no formato de -format. Fora do
+// JSON, a falha corrupt_body trunca o payload já codificado.
+func (o *Outgoing) Encode(format string) (broker.Message, error) {
+	if format == codec.FormatJSON {
+		return broker.Message{Body: o.Body(), ContentType: codec.ContentTypeJSON}, nil
+	}
+
+	msg, err := codec.Encode(format, payload.Message{
+		UID:       o.UID,
+		EventType: payload.EventType(o.EventType),
+		UserID:    o.UserID,
+	})
+	if err != nil {
+		return msg, err
+	}
+	if o.Fault == FaultCorruptBody {
+		msg.Body = msg.Body[:len(msg.Body)-1]
+	}
+	return msg, nil
+}
+
+var defaultKeySchema = routing.MustSchema(routing.DefaultPattern)
+
+// batchKeyFields preenchem usuário e tipo da chave de um lote, montada no
+// mesmo padrão das mensagens avulsas para casar com os mesmos bindings; o
+// consumidor usa o tenant e as demais dimensões dessa chave e lê usuário e
+// tipo de cada evento.
+var batchKeyFields = map[string]string{"user": "batch", "type": "batch"}
+
+// EncodeBatch monta o envelope em lote. Como um evento interno não pode
+// ter JSON inválido nem chave própria, corrupt_body publica o evento sem
+// uid e bad_routing_key sem user_id; o consumidor rejeita os dois.
+func EncodeBatch(vs []*Outgoing) (broker.Message, error) {
+	msgs := make([]payload.Message, len(vs))
+	for i, v := range vs {
+		msgs[i] = payload.Message{UID: v.UID, EventType: payload.EventType(v.EventType), UserID: v.UserID}
+		switch v.Fault {
+		case FaultCorruptBody:
+			msgs[i].UID = ""
+		case FaultBadRoutingKey:
+			msgs[i].UserID = ""
+		}
+	}
+	return codec.EncodeBatch(msgs)
+}
+
+func (w *Workload) Next() *Outgoing {
+	r := w.rng.Float64() * 100
+
+	if w.rollFault(&r, w.faults.Duplicate) {
+		if len(w.history) > 0 {
+			original := w.history[w.rng.Intn(len(w.history))]
+			duplicate := *original
+			return &Outgoing{Message: &duplicate, Fault: FaultDuplicate}
+		}
+		// Ainda não há mensagem para duplicar: gera uma mensagem limpa.
+		r = math.Inf(1)
+	}
+
+	msg := w.NewMessage()
+	switch {
+	case w.rollFault(&r, w.faults.CorruptBody):
+		return &Outgoing{Message: msg, Fault: FaultCorruptBody}
+	case w.rollFault(&r, w.faults.UnknownType):
+		msg.EventType = unknownEventType
+		return &Outgoing{Message: msg, Fault: FaultUnknownType}
+	case w.rollFault(&r, w.faults.BadRoutingKey):
+		return &Outgoing{Message: msg, Fault: FaultBadRoutingKey}
+	}
+
+	if len(w.history) < duplicateHistory {
+		w.history = append(w.history, msg)
+	} else {
+		w.history[w.rng.Intn(duplicateHistory)] = msg
+	}
+	return &Outgoing{Message: msg}
+}
+
+func (w *Workload) rollFault(r *float64, pct float64) bool {
+	*r -= pct
+	return *r < 0 && pct > 0
+}
@@ -0,0 +1,94 @@
+package workload
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+)
+
+func TestWorkload_InjectsFaults(t *testing.T) {
+	rates := FaultRates{Duplicate: 10, CorruptBody: 10, UnknownType: 10, BadRoutingKey: 10}
+	workload := NewWorkload(DefaultProfile(), 3, rates)
+
+	seen := make(map[string]bool)
+	summary := NewSummary()
+	for i := 0; i < 2000; i++ {
+		v := workload.Next()
+		summary.Add(v)
+
+		switch v.Fault {
+		case FaultDuplicate:
+			if !seen[v.UID] {
+				t.Fatalf("Duplicata %s deveria repetir o UID de uma mensagem anterior", v.UID)
+			}
+		case FaultCorruptBody:
+			if json.Valid(v.Body()) {
+				t.Fatalf("Corpo corrompido deveria ser JSON inválido: %s", v.Body())
+			}
+		case FaultUnknownType:
+			if isKnownEventType(v.EventType) {
+				t.Fatalf("Tipo de evento deveria ser desconhecido, obtido %s", v.EventType)
+			}
+		case FaultBadRoutingKey:
+			if parts := strings.Split(v.RoutingKey(), "."); len(parts) == 3 && parts[0] != "" {
+				t.Fatalf("Chave de roteamento deveria estar sem usuário: %s", v.RoutingKey())
+			}
+		case "":
+			seen[v.UID] = true
+		}
+	}
+
+	for _, fault := range []Fault{FaultDuplicate, FaultCorruptBody, FaultUnknownType, FaultBadRoutingKey} {
+		if n := summary.Faults[string(fault)]; n < 100 || n > 300 {
+			t.Errorf("Esperado em torno de 200 mensagens com %s, obtido %d", fault, n)
+		}
+	}
+
+	total := 0
+	for _, users := range summary.Counts {
+		for _, count := range users {
+			total += count
+		}
+	}
+	if total != len(seen) {
+		t.Errorf("Resumo esperado deveria conter apenas as %d mensagens limpas, obtido %d", len(seen), total)
+	}
+}
+
+func TestFaultRates_Validate(t *testing.T) {
+	if err := (FaultRates{Duplicate: 60, CorruptBody: 50}).Validate(); err == nil {
+		t.Error("Esperado erro quando a soma dos percentuais passa de 100")
+	}
+	if err := (FaultRates{BadRoutingKey: -1}).Validate(); err == nil {
+		t.Error("Esperado erro para percentual negativo")
+	}
+}
+
+func TestOutgoing_EncodeFormats(t *testing.T) {
+	workload := NewWorkload(DefaultProfile(), 5, FaultRates{})
+	registry := codec.NewRegistry()
+
+	for _, format := range codec.Formats {
+		v := workload.Next()
+		msg, err := v.Encode(format)
+		if err != nil {
+			t.Fatalf("Erro ao codificar %s: %v", format, err)
+		}
+		fields, err := registry.Decode(msg)
+		if err != nil || fields["id"] != v.UID {
+			t.Errorf("%s: esperado id %s, obtido %v (%v)", format, v.UID, fields, err)
+		}
+
+		v.Fault = FaultCorruptBody
+		msg, _ = v.Encode(format)
+		if _, err := registry.Decode(msg); err == nil {
+			t.Errorf("%s: corpo corrompido deveria falhar na decodificação", format)
+		}
+	}
+
+	if _, err := workload.Next().Encode("xml"); err == nil {
+		t.Error("Formato desconhecido deveria falhar")
+	}
+}
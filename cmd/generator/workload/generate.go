@@ -0,0 +1,97 @@
+package workload
+
+import (
+	"math/rand"
+
+	"github.com/google/uuid"
+	eventcounter "github.com/reb-felipe/eventcounter/pkg"
+)
+
+var users = []string{
+	"user_a",
+	"user_b",
+	"user_c",
+	"user_d",
+	"user_e",
+}
+
+var events = []eventcounter.EventType{
+	eventcounter.EventCreated,
+	eventcounter.EventDeleted,
+	eventcounter.EventUpdated,
+}
+
+type Workload struct {
+	rng     *rand.Rand
+	users   []string
+	zipf    *rand.Zipf
+	events  []eventcounter.EventType
+	weights []float64
+	total   float64
+	faults  FaultRates
+	history []*eventcounter.Message
+}
+
+func NewWorkload(profile *Profile, seed int64, faults FaultRates) *Workload {
+	rng := rand.New(rand.NewSource(seed))
+
+	w := &Workload{
+		rng:    rng,
+		users:  profile.userIDs(),
+		faults: faults,
+	}
+
+	if profile.Zipf != nil {
+		v := profile.Zipf.V
+		if v == 0 {
+			v = 1
+		}
+		w.zipf = rand.NewZipf(rng, profile.Zipf.S, v, uint64(len(w.users)-1))
+	}
+
+	// Itera sobre a lista fixa de eventos para que a mesma seed gere sempre
+	// a mesma sequência, independente da ordem do mapa de pesos.
+	for _, event_type := range events {
+		if weight := profile.Weights[event_type]; weight > 0 {
+			w.events = append(w.events, event_type)
+			w.weights = append(w.weights, weight)
+			w.total += weight
+		}
+	}
+
+	return w
+}
+
+func (w *Workload) NewMessage() *eventcounter.Message {
+	return &eventcounter.Message{
+		UID:       w.newUID(),
+		EventType: w.nextEvent(),
+		UserID:    w.nextUser(),
+	}
+}
+
+func (w *Workload) newUID() string {
+	id, err := uuid.NewRandomFromReader(w.rng)
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+func (w *Workload) nextUser() string {
+	if w.zipf != nil {
+		return w.users[w.zipf.Uint64()]
+	}
+	return w.users[w.rng.Intn(len(w.users))]
+}
+
+func (w *Workload) nextEvent() eventcounter.EventType {
+	r := w.rng.Float64() * w.total
+	for i, weight := range w.weights {
+		if r < weight {
+			return w.events[i]
+		}
+		r -= weight
+	}
+	return w.events[len(w.events)-1]
+}
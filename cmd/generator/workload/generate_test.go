@@ -0,0 +1,83 @@
+package workload
+
+import (
+	"reflect"
+	"testing"
+
+	eventcounter "github.com/reb-felipe/eventcounter/pkg"
+)
+
+func TestWorkload_SameSeedIsReproducible(t *testing.T) {
+	profile, err := LoadProfile("../profiles/skewed.yaml")
+	if err != nil {
+		t.Fatalf("Erro ao carregar perfil: %v", err)
+	}
+
+	a := NewWorkload(profile, 42, FaultRates{})
+	b := NewWorkload(profile, 42, FaultRates{})
+	for i := 0; i < 100; i++ {
+		msgA, msgB := a.NewMessage(), b.NewMessage()
+		if *msgA != *msgB {
+			t.Fatalf("Mensagem %d diferente com a mesma seed: %+v != %+v", i, msgA, msgB)
+		}
+	}
+}
+
+func TestWorkload_RespectsWeights(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Weights = map[eventcounter.EventType]float64{eventcounter.EventUpdated: 1}
+
+	workload := NewWorkload(profile, 1, FaultRates{})
+	for i := 0; i < 50; i++ {
+		if msg := workload.NewMessage(); msg.EventType != eventcounter.EventUpdated {
+			t.Fatalf("Esperado apenas eventos updated, obtido %s", msg.EventType)
+		}
+	}
+}
+
+func TestCountMessages_FixedSeed(t *testing.T) {
+	workload := NewWorkload(DefaultProfile(), 7, FaultRates{})
+	msgs := make([]*Outgoing, 20)
+	for i := range msgs {
+		msgs[i] = workload.Next()
+	}
+
+	expected := map[eventcounter.EventType]map[string]int{
+		eventcounter.EventCreated: {"user_a": 3, "user_d": 2},
+		eventcounter.EventDeleted: {"user_b": 2, "user_c": 2, "user_d": 1},
+		eventcounter.EventUpdated: {"user_a": 4, "user_b": 2, "user_c": 2, "user_d": 2},
+	}
+	if got := CountMessages(msgs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Contagens inesperadas para a seed 7:\n esperado %v\n obtido   %v", expected, got)
+	}
+}
+
+func TestCountMessages_SkipsFaults(t *testing.T) {
+	msgs := []*Outgoing{
+		{Message: &eventcounter.Message{UID: "1", EventType: eventcounter.EventCreated, UserID: "user_a"}},
+		{Message: &eventcounter.Message{UID: "1", EventType: eventcounter.EventCreated, UserID: "user_a"}, Fault: FaultDuplicate},
+		{Message: &eventcounter.Message{UID: "2", EventType: eventcounter.EventDeleted, UserID: "user_b"}, Fault: FaultBadRoutingKey},
+		{Message: &eventcounter.Message{UID: "3", EventType: eventcounter.EventCreated, UserID: "user_a"}},
+	}
+
+	expected := map[eventcounter.EventType]map[string]int{
+		eventcounter.EventCreated: {"user_a": 2},
+	}
+	if got := CountMessages(msgs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Mensagens com falha não deveriam ser contadas, obtido %v", got)
+	}
+}
+
+func TestProfile_Validate(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Zipf = &ZipfProfile{S: 0.5}
+	if err := profile.Validate(); err == nil {
+		t.Error("Esperado erro para zipf.s menor que 1")
+	}
+
+	profile = DefaultProfile()
+	profile.Weights = map[eventcounter.EventType]float64{"archived": 1}
+	if err := profile.Validate(); err == nil {
+		t.Error("Esperado erro para tipo de evento desconhecido")
+	}
+}
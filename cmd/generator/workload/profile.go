@@ -0,0 +1,123 @@
+package workload
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	eventcounter "github.com/reb-felipe/eventcounter/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile descreve a carga gerada. Arquivos JSON também são aceitos, já que
+// todo JSON é YAML válido.
+type Profile struct {
+	Users      []string                           `yaml:"users"`
+	UserPool   int                                `yaml:"user_pool"`
+	UserPrefix string                             `yaml:"user_prefix"`
+	Zipf       *ZipfProfile                       `yaml:"zipf"`
+	Weights    map[eventcounter.EventType]float64 `yaml:"weights"`
+	Bursts     []Burst                            `yaml:"bursts"`
+}
+
+type ZipfProfile struct {
+	S float64 `yaml:"s"`
+	V float64 `yaml:"v"`
+}
+
+type Burst struct {
+	Size  int           `yaml:"size"`
+	Pause time.Duration `yaml:"pause"`
+}
+
+func DefaultProfile() *Profile {
+	return &Profile{
+		Users: users,
+		Weights: map[eventcounter.EventType]float64{
+			eventcounter.EventCreated: 1,
+			eventcounter.EventDeleted: 1,
+			eventcounter.EventUpdated: 1,
+		},
+	}
+}
+
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível ler perfil %s: %w", path, err)
+	}
+
+	profile := &Profile{}
+	if err := yaml.Unmarshal(data, profile); err != nil {
+		return nil, fmt.Errorf("não foi possível interpretar perfil %s: %w", path, err)
+	}
+
+	if len(profile.Users) == 0 && profile.UserPool == 0 {
+		profile.Users = users
+	}
+	if len(profile.Weights) == 0 {
+		profile.Weights = DefaultProfile().Weights
+	}
+
+	return profile, profile.Validate()
+}
+
+func (p *Profile) Validate() error {
+	if p.UserPool < 0 {
+		return fmt.Errorf("user_pool não pode ser negativo: %d", p.UserPool)
+	}
+	if p.Zipf != nil && p.Zipf.S <= 1 {
+		return fmt.Errorf("zipf.s deve ser maior que 1, obtido %v", p.Zipf.S)
+	}
+	if p.Zipf != nil && p.Zipf.V != 0 && p.Zipf.V < 1 {
+		return fmt.Errorf("zipf.v deve ser maior ou igual a 1, obtido %v", p.Zipf.V)
+	}
+
+	total := 0.0
+	for event_type, weight := range p.Weights {
+		if !isKnownEventType(event_type) {
+			return fmt.Errorf("tipo de evento desconhecido no perfil: %s", event_type)
+		}
+		if weight < 0 {
+			return fmt.Errorf("peso negativo para %s: %v", event_type, weight)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("a soma dos pesos dos eventos deve ser maior que zero")
+	}
+
+	for i, burst := range p.Bursts {
+		if burst.Size <= 0 {
+			return fmt.Errorf("burst %d deve ter size maior que zero", i)
+		}
+	}
+
+	return nil
+}
+
+func (p *Profile) userIDs() []string {
+	if len(p.Users) > 0 {
+		return p.Users
+	}
+
+	prefix := p.UserPrefix
+	if prefix == "" {
+		prefix = "user_"
+	}
+
+	ids := make([]string, p.UserPool)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return ids
+}
+
+func isKnownEventType(event_type eventcounter.EventType) bool {
+	for _, v := range events {
+		if v == event_type {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/routing"
+)
+
+const progressInterval = time.Second
+
+// TenantHeader é o header do tenant quando o padrão da chave não tem
+// {tenant}; é o padrão de TENANT_HEADER no consumidor.
+const TenantHeader = "x-tenant"
+
+// maxPublishFailures é o número de publicações seguidas com erro após o
+// qual a publicação contínua desiste, em vez de insistir com o broker fora.
+const maxPublishFailures = 10
+
+// Publisher publica a carga gerada no exchange com publisher confirms. Os
+// campos espelham as flags do gerador. QueueArgs são os argumentos usados
+// por Declare e precisam ser os mesmos da fila do consumidor, já que
+// redeclarar uma fila com argumentos diferentes falha. KeySchema é o padrão
+// das chaves de roteamento (nil usa o padrão do consumidor) e Tenant vai no
+// campo {tenant} da chave ou, se o padrão não o tiver, no header x-tenant.
+type Publisher struct {
+	Broker         broker.Broker
+	Exchange       string
+	QueueArgs      map[string]interface{}
+	KeySchema      *routing.Schema
+	Tenant         string
+	Format         string
+	Compress       string
+	BatchSize      int
+	MaxRetries     int
+	ConfirmTimeout time.Duration
+}
+
+func (p *Publisher) Declare() error {
+	if err := p.Broker.DeclareExchange(p.Exchange, "topic"); err != nil {
+		return err
+	}
+
+	if err := p.Broker.DeclareQueue("eventcountertest", p.QueueArgs); err != nil {
+		return err
+	}
+
+	if err := p.Broker.BindQueue("eventcountertest", p.keySchema().Binding(), p.Exchange); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Publisher) keySchema() *routing.Schema {
+	if p.KeySchema == nil {
+		return defaultKeySchema
+	}
+	return p.KeySchema
+}
+
+// batchSize devolve quantas mensagens vão em cada publicação; valores
+// menores que 1 publicam as mensagens avulsas.
+func (p *Publisher) batchSize() int {
+	return max(p.BatchSize, 1)
+}
+
+// route define a chave de roteamento a partir de fields e leva o tenant na
+// chave ou no header.
+func (p *Publisher) route(msg *broker.Message, fields map[string]string) {
+	schema := p.keySchema()
+	if p.Tenant == "" {
+		msg.RoutingKey = schema.Format(fields)
+		return
+	}
+
+	with_tenant := map[string]string{"tenant": p.Tenant}
+	for name, value := range fields {
+		with_tenant[name] = value
+	}
+	msg.RoutingKey = schema.Format(with_tenant)
+	if !slices.Contains(schema.Fields(), "tenant") {
+		if msg.Headers == nil {
+			msg.Headers = make(map[string]interface{})
+		}
+		msg.Headers[TenantHeader] = p.Tenant
+	}
+}
+
+func (p *Publisher) Publish(ctx context.Context, msgs []*Outgoing, bursts []Burst) error {
+	tracker := NewConfirmTracker(p)
+	pacer := newBurstPacer(bursts)
+	batch := &batcher{tracker: tracker, size: p.batchSize()}
+	for _, v := range msgs {
+		pacer.wait(ctx)
+		batch.Add(ctx, v)
+	}
+	batch.Flush(ctx)
+
+	return tracker.Finish(ctx, p.MaxRetries, p.ConfirmTimeout)
+}
+
+// PublishStream publica mensagens continuamente na taxa definida pelo
+// schedule até o fim da duração, o cancelamento do contexto ou
+// maxPublishFailures erros de publicação seguidos, e retorna o resumo das
+// mensagens confirmadas pelo broker.
+func (p *Publisher) PublishStream(ctx context.Context, workload *Workload, schedule RateSchedule) (*Summary, error) {
+	tracker := NewConfirmTracker(p)
+	summary := NewSummary()
+	tracker.OnAcked = summary.Add
+	published := 0
+	bucket := NewTokenBucket(schedule)
+	batch := &batcher{tracker: tracker, size: p.batchSize()}
+
+	progress := time.NewTicker(progressInterval)
+	defer progress.Stop()
+	lastPublished := 0
+	var stream_err error
+
+	for {
+		if err := bucket.Wait(ctx); err != nil {
+			break
+		}
+
+		select {
+		case <-progress.C:
+			tracker.Reap()
+			stats := tracker.Stats()
+			log.Printf("progresso: %s decorridos, %d publicadas (%.1f msg/s, alvo %.1f msg/s), %d confirmadas, %d com falha",
+				bucket.Elapsed().Truncate(time.Second), published,
+				float64(published-lastPublished)/progressInterval.Seconds(), bucket.CurrentRate(),
+				stats.Acked, stats.Nacked+stats.Returned+stats.PublishErrors)
+			lastPublished = published
+		default:
+		}
+
+		batch.Add(context.Background(), workload.Next())
+		published++
+
+		if batch.failures >= maxPublishFailures {
+			stream_err = fmt.Errorf("%d publicações seguidas falharam, último erro: %w", batch.failures, batch.err)
+			break
+		}
+	}
+
+	// O contexto pode já estar cancelado (Ctrl+C); o último lote, as
+	// confirmações e as republicações finais usam um contexto próprio.
+	batch.Flush(context.Background())
+	err := tracker.Finish(context.Background(), p.MaxRetries, p.ConfirmTimeout)
+	if stream_err != nil {
+		return summary, stream_err
+	}
+	return summary, err
+}
+
+// batcher junta as mensagens em lotes de size antes de publicar; com size
+// 1 cada mensagem é publicada avulsa, como antes dos lotes. failures conta
+// as publicações seguidas com erro e err guarda o último.
+type batcher struct {
+	tracker  *ConfirmTracker
+	size     int
+	pending  []*Outgoing
+	failures int
+	err      error
+}
+
+func (b *batcher) Add(ctx context.Context, v *Outgoing) {
+	b.pending = append(b.pending, v)
+	if len(b.pending) >= b.size {
+		b.Flush(ctx)
+	}
+}
+
+func (b *batcher) Flush(ctx context.Context) {
+	if len(b.pending) == 0 {
+		return
+	}
+	if err := b.tracker.Publish(ctx, b.pending...); err != nil {
+		log.Printf("não foi possível publicar %s, erro: %s", describe(b.pending), err)
+		b.failures++
+		b.err = err
+	} else {
+		b.failures = 0
+	}
+	b.pending = nil
+}
+
+func describe(vs []*Outgoing) string {
+	if len(vs) == 1 {
+		return "mensagem " + vs[0].UID
+	}
+	return fmt.Sprintf("lote de %d mensagens a partir de %s", len(vs), vs[0].UID)
+}
+
+type burstPacer struct {
+	bursts    []Burst
+	current   int
+	remaining int
+}
+
+func newBurstPacer(bursts []Burst) *burstPacer {
+	p := &burstPacer{bursts: bursts}
+	if len(bursts) > 0 {
+		p.remaining = bursts[0].Size
+	}
+	return p
+}
+
+func (p *burstPacer) wait(ctx context.Context) {
+	if len(p.bursts) == 0 {
+		return
+	}
+
+	if p.remaining == 0 {
+		pause := p.bursts[p.current].Pause
+		p.current = (p.current + 1) % len(p.bursts)
+		p.remaining = p.bursts[p.current].Size
+
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+		}
+	}
+	p.remaining--
+}
@@ -0,0 +1,282 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/Julia-Marcal/eventcounter/pkg/codec"
+	eventcounter "github.com/reb-felipe/eventcounter/pkg"
+)
+
+func newMemoryPublisher(t *testing.T) (*broker.Memory, *Publisher) {
+	t.Helper()
+
+	memory := broker.NewMemory()
+	t.Cleanup(func() { memory.Close() })
+	return memory, &Publisher{
+		Broker:         memory,
+		Exchange:       "eventcountertest",
+		Format:         codec.FormatJSON,
+		Compress:       "none",
+		BatchSize:      1,
+		MaxRetries:     3,
+		ConfirmTimeout: time.Second,
+	}
+}
+
+func TestPublish_InMemoryBrokerMatchesSummary(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	if err := publisher.Declare(); err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+
+	workload := NewWorkload(DefaultProfile(), 11, FaultRates{Duplicate: 5, CorruptBody: 5, UnknownType: 5, BadRoutingKey: 5})
+	msgs := make([]*Outgoing, 300)
+	for i := range msgs {
+		msgs[i] = workload.Next()
+	}
+
+	if err := publisher.Publish(context.Background(), msgs, nil); err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	if depth := memory.Depth("eventcountertest"); depth != len(msgs) {
+		t.Fatalf("Esperado %d mensagens na fila, obtido %d", len(msgs), depth)
+	}
+
+	source, err := memory.Consume("eventcountertest", 0)
+	if err != nil {
+		t.Fatalf("Erro ao consumir: %v", err)
+	}
+	defer source.Close()
+
+	// Aplica as mesmas regras de descarte do consumidor.
+	seen := make(map[string]bool)
+	counted := make(map[string]map[string]int)
+	for i := 0; i < len(msgs); i++ {
+		var d broker.Delivery
+		select {
+		case d = <-source.Deliveries():
+		case <-time.After(time.Second):
+			t.Fatalf("Apenas %d de %d mensagens entregues", i, len(msgs))
+		}
+		d.Ack()
+
+		var body struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(d.Body, &body) != nil || seen[body.ID] {
+			continue
+		}
+		parts := strings.Split(d.RoutingKey, ".")
+		if parts[0] == "" {
+			continue
+		}
+		seen[body.ID] = true
+		if !isKnownEventType(eventcounter.EventType(parts[2])) {
+			continue
+		}
+		if counted[parts[2]] == nil {
+			counted[parts[2]] = make(map[string]int)
+		}
+		counted[parts[2]][parts[0]]++
+	}
+
+	for event_type, users := range CountMessages(msgs) {
+		for user_id, expected := range users {
+			if got := counted[string(event_type)][user_id]; got != expected {
+				t.Errorf("%s %s: resumo esperava %d, consumidas %d", event_type, user_id, expected, got)
+			}
+		}
+	}
+}
+
+func TestDeclare_UsesQueueArgs(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	args, err := broker.ParseQueueArgs([]string{"x-queue-type=quorum", "x-dead-letter-exchange=user-events.dlx"})
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := memory.DeclareQueue("eventcountertest", args); err != nil {
+		t.Fatalf("Erro ao declarar a fila do consumidor: %v", err)
+	}
+
+	if err := publisher.Declare(); err == nil {
+		t.Error("Esperado erro ao redeclarar a fila sem os argumentos do consumidor")
+	}
+
+	publisher.QueueArgs = args
+	if err := publisher.Declare(); err != nil {
+		t.Errorf("Esperado Declare com os mesmos argumentos do consumidor, obtido %v", err)
+	}
+}
+
+func TestPublish_UnroutableMessagesAreLost(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	memory.DeclareExchange(publisher.Exchange, "topic")
+
+	msgs := []*Outgoing{NewWorkload(DefaultProfile(), 1, FaultRates{}).Next()}
+	err := publisher.Publish(context.Background(), msgs, nil)
+	if !errors.Is(err, errMessagesLost) {
+		t.Errorf("Esperado errMessagesLost para mensagem sem rota, obtido %v", err)
+	}
+}
+
+func TestConfirmTracker_RetriesNotCountedAsPublished(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	memory.DeclareExchange(publisher.Exchange, "topic")
+
+	tracker := NewConfirmTracker(publisher)
+	if err := tracker.Publish(context.Background(), NewWorkload(DefaultProfile(), 1, FaultRates{}).Next()); err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	if err := tracker.Finish(context.Background(), publisher.MaxRetries, publisher.ConfirmTimeout); !errors.Is(err, errMessagesLost) {
+		t.Fatalf("Esperado errMessagesLost para mensagem sem rota, obtido %v", err)
+	}
+
+	stats := tracker.Stats()
+	if stats.Published != 1 || stats.Retried != publisher.MaxRetries || stats.Lost != 1 {
+		t.Errorf("Esperada 1 publicação e %d retentativas, obtido %s", publisher.MaxRetries, stats)
+	}
+}
+
+func TestPublish_ZeroBatchSizePublishesSingly(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	publisher.BatchSize = 0
+	if err := publisher.Declare(); err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+
+	workload := NewWorkload(DefaultProfile(), 1, FaultRates{})
+	msgs := []*Outgoing{workload.Next(), workload.Next(), workload.Next()}
+	if err := publisher.Publish(context.Background(), msgs, nil); err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	if depth := memory.Depth("eventcountertest"); depth != len(msgs) {
+		t.Errorf("Esperado %d mensagens avulsas na fila, obtido %d", len(msgs), depth)
+	}
+
+	// As republicações de Finish também usam lotes de pelo menos uma mensagem.
+	unbound, publisher := newMemoryPublisher(t)
+	publisher.BatchSize = 0
+	unbound.DeclareExchange(publisher.Exchange, "topic")
+	if err := publisher.Publish(context.Background(), msgs[:1], nil); !errors.Is(err, errMessagesLost) {
+		t.Errorf("Esperado errMessagesLost para mensagem sem rota, obtido %v", err)
+	}
+}
+
+func TestPublish_BatchesMatchSummary(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	if err := publisher.Declare(); err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+	publisher.BatchSize = 7
+
+	workload := NewWorkload(DefaultProfile(), 11, FaultRates{Duplicate: 5, CorruptBody: 5, UnknownType: 5, BadRoutingKey: 5})
+	msgs := make([]*Outgoing, 100)
+	for i := range msgs {
+		msgs[i] = workload.Next()
+	}
+
+	if err := publisher.Publish(context.Background(), msgs, nil); err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	if depth := memory.Depth("eventcountertest"); depth != 15 {
+		t.Fatalf("Esperados 15 lotes na fila, obtidos %d", depth)
+	}
+
+	source, err := memory.Consume("eventcountertest", 0)
+	if err != nil {
+		t.Fatalf("Erro ao consumir: %v", err)
+	}
+	defer source.Close()
+
+	seen := make(map[string]bool)
+	counted := make(map[string]map[string]int)
+	for i := 0; i < 15; i++ {
+		var d broker.Delivery
+		select {
+		case d = <-source.Deliveries():
+		case <-time.After(time.Second):
+			t.Fatalf("Apenas %d de 15 lotes entregues", i)
+		}
+		d.Ack()
+
+		entries, err := codec.DecodeBatch(d.Message)
+		if err != nil {
+			t.Fatalf("Lote inválido: %v", err)
+		}
+		for _, fields := range entries {
+			id, user_id, event_type := fields["id"].(string), fields["user_id"].(string), fields["event_type"].(string)
+			if id == "" || user_id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			if !isKnownEventType(eventcounter.EventType(event_type)) {
+				continue
+			}
+			if counted[event_type] == nil {
+				counted[event_type] = make(map[string]int)
+			}
+			counted[event_type][user_id]++
+		}
+	}
+
+	for event_type, users := range CountMessages(msgs) {
+		for user_id, expected := range users {
+			if got := counted[string(event_type)][user_id]; got != expected {
+				t.Errorf("%s %s: resumo esperava %d, consumidas %d", event_type, user_id, expected, got)
+			}
+		}
+	}
+}
+
+func TestPublishStream_SummaryOnlyCountsConfirmed(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	if err := publisher.Declare(); err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+
+	workload := NewWorkload(DefaultProfile(), 5, FaultRates{})
+	summary, err := publisher.PublishStream(context.Background(), workload, RateSchedule{Target: 500, Duration: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+
+	total := 0
+	for _, users := range summary.Counts {
+		for _, n := range users {
+			total += n
+		}
+	}
+	if depth := memory.Depth("eventcountertest"); total == 0 || total != depth {
+		t.Errorf("Resumo com %d mensagens, fila com %d", total, depth)
+	}
+}
+
+func TestPublishStream_StopsWhenBrokerIsDown(t *testing.T) {
+	memory, publisher := newMemoryPublisher(t)
+	if err := publisher.Declare(); err != nil {
+		t.Fatalf("Erro ao declarar topologia: %v", err)
+	}
+	memory.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	workload := NewWorkload(DefaultProfile(), 5, FaultRates{})
+	summary, err := publisher.PublishStream(ctx, workload, RateSchedule{Target: 1000})
+	if !errors.Is(err, broker.ErrClosed) {
+		t.Fatalf("Esperado erro de publicação com broker fechado, obtido %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("PublishStream deveria desistir antes do fim do contexto")
+	}
+	if len(summary.Counts) != 0 {
+		t.Errorf("Resumo não deveria conter mensagens não publicadas: %v", summary.Counts)
+	}
+}
@@ -0,0 +1,100 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+var errScheduleDone = errors.New("duração da publicação encerrada")
+
+// RateSchedule define a taxa alvo (mensagens/s) ao longo do tempo, com
+// rampas lineares de subida no início e de descida no final.
+type RateSchedule struct {
+	Target   float64
+	Duration time.Duration
+	RampUp   time.Duration
+	RampDown time.Duration
+}
+
+func (s RateSchedule) RateAt(elapsed time.Duration) float64 {
+	if s.RampUp > 0 && elapsed < s.RampUp {
+		return s.Target * float64(elapsed) / float64(s.RampUp)
+	}
+
+	if s.Duration > 0 && s.RampDown > 0 {
+		remaining := s.Duration - elapsed
+		if remaining < s.RampDown {
+			return math.Max(0, s.Target*float64(remaining)/float64(s.RampDown))
+		}
+	}
+
+	return s.Target
+}
+
+func (s RateSchedule) Done(elapsed time.Duration) bool {
+	return s.Duration > 0 && elapsed >= s.Duration
+}
+
+// TokenBucket libera tokens na taxa atual do schedule. A capacidade
+// acompanha a taxa (100ms de tokens) para suportar taxas altas sem
+// depender da resolução dos timers.
+type TokenBucket struct {
+	schedule RateSchedule
+	start    time.Time
+	last     time.Time
+	tokens   float64
+}
+
+func NewTokenBucket(schedule RateSchedule) *TokenBucket {
+	now := time.Now()
+	return &TokenBucket{
+		schedule: schedule,
+		start:    now,
+		last:     now,
+	}
+}
+
+func (b *TokenBucket) Elapsed() time.Duration {
+	return time.Since(b.start)
+}
+
+func (b *TokenBucket) CurrentRate() float64 {
+	return b.schedule.RateAt(b.Elapsed())
+}
+
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+		elapsed := now.Sub(b.start)
+		if b.schedule.Done(elapsed) {
+			return errScheduleDone
+		}
+
+		rate := b.schedule.RateAt(elapsed)
+		b.tokens = math.Min(b.tokens+rate*now.Sub(b.last).Seconds(), math.Max(1, rate/10))
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			return nil
+		}
+
+		wait := 50 * time.Millisecond
+		if rate > 0 {
+			needed := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+			if needed < wait {
+				wait = needed
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
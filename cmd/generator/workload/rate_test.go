@@ -0,0 +1,59 @@
+package workload
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateSchedule_Ramps(t *testing.T) {
+	schedule := RateSchedule{
+		Target:   100,
+		Duration: 10 * time.Second,
+		RampUp:   2 * time.Second,
+		RampDown: 2 * time.Second,
+	}
+
+	cases := map[time.Duration]float64{
+		0:                 0,
+		time.Second:       50,
+		5 * time.Second:   100,
+		9 * time.Second:   50,
+		10 * time.Second:  0,
+		2*time.Second + 1: 100,
+		8*time.Second - 1: 100,
+	}
+	for elapsed, expected := range cases {
+		if got := schedule.RateAt(elapsed); got < expected-0.01 || got > expected+0.01 {
+			t.Errorf("Em %s: esperado %.2f msg/s, obtido %.2f", elapsed, expected, got)
+		}
+	}
+
+	if schedule.Done(9*time.Second) || !schedule.Done(10*time.Second) {
+		t.Error("Done deveria ser verdadeiro apenas após a duração")
+	}
+}
+
+func TestTokenBucket_LimitsRate(t *testing.T) {
+	bucket := NewTokenBucket(RateSchedule{Target: 200, Duration: 250 * time.Millisecond})
+
+	acquired := 0
+	for bucket.Wait(context.Background()) == nil {
+		acquired++
+	}
+
+	// 250ms a 200 msg/s são 50 tokens; a margem cobre a imprecisão dos timers.
+	if acquired < 30 || acquired > 75 {
+		t.Errorf("Esperado em torno de 50 tokens, obtido %d", acquired)
+	}
+}
+
+func TestTokenBucket_StopsOnCancel(t *testing.T) {
+	bucket := NewTokenBucket(RateSchedule{Target: 0.001})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := bucket.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Esperado context.DeadlineExceeded, obtido %v", err)
+	}
+}
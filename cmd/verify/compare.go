@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	domain "github.com/Julia-Marcal/eventcounter/cmd/consumer/domain"
+)
+
+type Counts map[string]map[string]int
+
+type Discrepancy struct {
+	EventType string
+	UserID    string
+	Expected  int
+	Actual    int
+}
+
+func (d Discrepancy) String() string {
+	if d.UserID == "" {
+		return fmt.Sprintf("%s (total): esperado %d, obtido %d (%+d)", d.EventType, d.Expected, d.Actual, d.Actual-d.Expected)
+	}
+	return fmt.Sprintf("%s %s: esperado %d, obtido %d (%+d)", d.EventType, d.UserID, d.Expected, d.Actual, d.Actual-d.Expected)
+}
+
+// LoadCounts lê um diretório de resultados em qualquer um dos dois formatos:
+// o resumo do gerador (objeto user_id -> contagem) ou a saída do consumidor
+// (lista de UserCount). Tipos sem arquivo são tratados como vazios.
+func LoadCounts(dir string) (Counts, error) {
+	counts := make(Counts)
+
+	for _, event_type := range domain.EventTypes {
+		path := filepath.Join(dir, fmt.Sprintf("%s.json", event_type))
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			counts[event_type] = make(map[string]int)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler %s: %w", path, err)
+		}
+
+		users, err := decodeCounts(data)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao interpretar %s: %w", path, err)
+		}
+		counts[event_type] = users
+	}
+
+	return counts, nil
+}
+
+func decodeCounts(data []byte) (map[string]int, error) {
+	users := make(map[string]int)
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return users, nil
+	}
+
+	if trimmed[0] == '[' {
+		var userCounts []domain.UserCount
+		if err := json.Unmarshal(trimmed, &userCounts); err != nil {
+			return nil, err
+		}
+		for _, v := range userCounts {
+			users[v.UserID] += v.Count
+		}
+		return users, nil
+	}
+
+	if err := json.Unmarshal(trimmed, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Compare devolve as divergências por tipo (total) e por usuário, em ordem
+// determinística.
+func Compare(expected, actual Counts) []Discrepancy {
+	var discrepancies []Discrepancy
+
+	for _, event_type := range domain.EventTypes {
+		expectedTotal, actualTotal := 0, 0
+		var users []Discrepancy
+
+		for _, user_id := range userIDs(expected[event_type], actual[event_type]) {
+			e, a := expected[event_type][user_id], actual[event_type][user_id]
+			expectedTotal += e
+			actualTotal += a
+			if e != a {
+				users = append(users, Discrepancy{EventType: event_type, UserID: user_id, Expected: e, Actual: a})
+			}
+		}
+
+		if expectedTotal != actualTotal {
+			discrepancies = append(discrepancies, Discrepancy{EventType: event_type, Expected: expectedTotal, Actual: actualTotal})
+		}
+		discrepancies = append(discrepancies, users...)
+	}
+
+	return discrepancies
+}
+
+func userIDs(maps ...map[string]int) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, m := range maps {
+		for user_id := range m {
+			if !seen[user_id] {
+				seen[user_id] = true
+				ids = append(ids, user_id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
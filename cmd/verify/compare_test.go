@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCounts_NormalisesBothFormats(t *testing.T) {
+	expectedDir := t.TempDir()
+	actualDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(expectedDir, "created.json"), []byte(`{"user_a": 2, "user_b": 1}`), 0644)
+	os.WriteFile(filepath.Join(expectedDir, "faults.json"), []byte(`{"duplicate": 3}`), 0644)
+	os.WriteFile(filepath.Join(actualDir, "created.json"), []byte(`[{"user_id": "user_a", "count": 2}, {"user_id": "user_b", "count": 1}]`), 0644)
+	os.WriteFile(filepath.Join(actualDir, "updated.json"), []byte(`null`), 0644)
+	os.WriteFile(filepath.Join(actualDir, "deleted.json"), []byte(`[]`), 0644)
+
+	expected, err := LoadCounts(expectedDir)
+	if err != nil {
+		t.Fatalf("Erro ao carregar resumo esperado: %v", err)
+	}
+	actual, err := LoadCounts(actualDir)
+	if err != nil {
+		t.Fatalf("Erro ao carregar resultados: %v", err)
+	}
+
+	if discrepancies := Compare(expected, actual); len(discrepancies) != 0 {
+		t.Errorf("Não eram esperadas divergências, obtido %v", discrepancies)
+	}
+}
+
+func TestCompare_ReportsUserAndTypeDiscrepancies(t *testing.T) {
+	expected := Counts{"created": {"user_a": 2, "user_b": 1}}
+	actual := Counts{"created": {"user_a": 1, "user_b": 1, "user_c": 1}, "deleted": {"user_a": 1}}
+
+	discrepancies := Compare(expected, actual)
+
+	want := []Discrepancy{
+		{EventType: "created", UserID: "user_a", Expected: 2, Actual: 1},
+		{EventType: "created", UserID: "user_c", Expected: 0, Actual: 1},
+		{EventType: "deleted", Expected: 0, Actual: 1},
+		{EventType: "deleted", UserID: "user_a", Expected: 0, Actual: 1},
+	}
+	if len(discrepancies) != len(want) {
+		t.Fatalf("Esperado %d divergências, obtido %d: %v", len(want), len(discrepancies), discrepancies)
+	}
+	for i := range want {
+		if discrepancies[i] != want[i] {
+			t.Errorf("Divergência %d: esperado %v, obtido %v", i, want[i], discrepancies[i])
+		}
+	}
+}
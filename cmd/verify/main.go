@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/logger"
+)
+
+func main() {
+	expectedDir := flag.String("expected", "data", "Diretório com o resumo do gerador (-count-out)")
+	actualDir := flag.String("actual", "results", "Diretório com os resultados do consumidor")
+	flag.Parse()
+
+	expected, err := LoadCounts(*expectedDir)
+	if err != nil {
+		logger.Fatalf("Falha ao carregar resumo esperado: %v", err)
+	}
+
+	actual, err := LoadCounts(*actualDir)
+	if err != nil {
+		logger.Fatalf("Falha ao carregar resultados do consumidor: %v", err)
+	}
+
+	discrepancies := Compare(expected, actual)
+	if len(discrepancies) == 0 {
+		logger.Success("Resultados conferem com o resumo do gerador")
+		return
+	}
+
+	for _, d := range discrepancies {
+		logger.Error("%s", d)
+	}
+	logger.Error("%d divergências encontradas entre %s e %s", len(discrepancies), *expectedDir, *actualDir)
+	os.Exit(1)
+}
@@ -0,0 +1,323 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// publishSeqHeader associa o basic.return à publicação. É de uso interno:
+// Publish o sobrescreve e o consumo o remove, para que não vaze para
+// consumidores nem seja reaproveitado ao encaminhar uma entrega.
+const publishSeqHeader = "x-publish-seq"
+
+// AMQP implementa Broker sobre um único canal do RabbitMQ, reaberto sob
+// demanda quando o broker o fecha. Publicações usam publisher confirms; as
+// devoluções (basic.return) são associadas à delivery tag por um header.
+type AMQP struct {
+	url    string
+	config amqp.Config
+
+	mu         sync.Mutex
+	conn       *amqp.Connection
+	ch         *amqp.Channel
+	confirming bool
+	pending    map[uint64]*Confirmation
+}
+
+// AMQPOptions configura a conexão além da URL. Com TLS, a URL precisa usar
+// amqps://; External autentica pelo certificado do cliente (SASL EXTERNAL)
+// em vez de usuário e senha.
+type AMQPOptions struct {
+	TLS      *tls.Config
+	External bool
+}
+
+func DialAMQP(url string) (*AMQP, error) {
+	return DialAMQPWithOptions(url, AMQPOptions{})
+}
+
+func DialAMQPWithOptions(url string, opts AMQPOptions) (*AMQP, error) {
+	if opts.TLS != nil && !strings.HasPrefix(url, "amqps://") {
+		return nil, fmt.Errorf("TLS configurado, mas a URL não usa amqps://")
+	}
+
+	config := amqp.Config{
+		Heartbeat:       10 * time.Second,
+		Locale:          "en_US",
+		TLSClientConfig: opts.TLS,
+	}
+	if opts.External {
+		config.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	}
+
+	b := &AMQP{url: url, config: config}
+	if _, err := b.channel(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *AMQP) channel() (*amqp.Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.channelLocked()
+}
+
+func (b *AMQP) channelLocked() (*amqp.Channel, error) {
+	if b.ch != nil && !b.ch.IsClosed() {
+		return b.ch, nil
+	}
+
+	if b.conn == nil || b.conn.IsClosed() {
+		conn, err := amqp.DialConfig(b.url, b.config)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao conectar com o RabbitMQ: %w", err)
+		}
+		b.conn = conn
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir um canal: %w", err)
+	}
+
+	b.ch = ch
+	b.confirming = false
+	return ch, nil
+}
+
+func (b *AMQP) DeclareExchange(name, kind string) error {
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.ExchangeDeclare(name, kind, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("erro ao declarar exchange %s: %w", name, err)
+	}
+	return nil
+}
+
+func (b *AMQP) DeclareQueue(name string, args map[string]interface{}) error {
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table(args)); err != nil {
+		return fmt.Errorf("erro ao declarar uma queue: %w", err)
+	}
+	return nil
+}
+
+func (b *AMQP) CheckExchange(name, kind string) error {
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.ExchangeDeclarePassive(name, kind, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("exchange %s não encontrado: %w", name, err)
+	}
+	return nil
+}
+
+func (b *AMQP) CheckQueue(name string) error {
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclarePassive(name, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("fila %s não encontrada: %w", name, err)
+	}
+	return nil
+}
+
+func (b *AMQP) BindQueue(queue, key, exchange string) error {
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.QueueBind(queue, key, exchange, false, nil); err != nil {
+		return fmt.Errorf("erro ao ligar fila %s ao exchange %s: %w", queue, exchange, err)
+	}
+	return nil
+}
+
+func (b *AMQP) Publish(ctx context.Context, exchange string, msg Message, mandatory bool) (*Confirmation, error) {
+	b.mu.Lock()
+	ch, err := b.channelLocked()
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+
+	if !b.confirming {
+		if err := ch.Confirm(false); err != nil {
+			b.mu.Unlock()
+			return nil, fmt.Errorf("erro ao ativar publisher confirms: %w", err)
+		}
+		b.pending = make(map[uint64]*Confirmation)
+		confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1024))
+		returns := ch.NotifyReturn(make(chan amqp.Return, 1024))
+		go b.listen(b.pending, confirms, returns)
+		b.confirming = true
+	}
+
+	// O número de sequência só vale para a próxima publicação no canal, então
+	// o lock cobre a leitura e a publicação.
+	seq := ch.GetNextPublishSeqNo()
+	confirmation := NewConfirmation()
+	b.pending[seq] = confirmation
+	defer b.mu.Unlock()
+
+	headers := make(amqp.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[publishSeqHeader] = int64(seq)
+
+	err = ch.PublishWithContext(ctx, exchange, msg.RoutingKey, mandatory, false, amqp.Publishing{
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		MessageId:       msg.MessageID,
+		Headers:         headers,
+		Body:            msg.Body,
+	})
+	if err != nil {
+		delete(b.pending, seq)
+		return nil, err
+	}
+
+	return confirmation, nil
+}
+
+func (b *AMQP) listen(pending map[uint64]*Confirmation, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	returned := make(map[uint64]bool)
+	recordReturn := func(r amqp.Return) {
+		if seq, ok := r.Headers[publishSeqHeader].(int64); ok {
+			returned[uint64(seq)] = true
+		}
+	}
+
+	for {
+		select {
+		case r, ok := <-returns:
+			if ok {
+				recordReturn(r)
+			}
+		case c, ok := <-confirms:
+			if !ok {
+				b.mu.Lock()
+				for seq, confirmation := range pending {
+					confirmation.resolve(false, false, true)
+					delete(pending, seq)
+				}
+				b.mu.Unlock()
+				return
+			}
+
+			// O broker envia o basic.return antes do ack da mesma mensagem,
+			// então qualquer devolução dela já está no buffer.
+		drain:
+			for {
+				select {
+				case r := <-returns:
+					recordReturn(r)
+				default:
+					break drain
+				}
+			}
+
+			b.mu.Lock()
+			confirmation, found := pending[c.DeliveryTag]
+			delete(pending, c.DeliveryTag)
+			b.mu.Unlock()
+
+			if found {
+				confirmation.resolve(c.Ack, returned[c.DeliveryTag], false)
+			}
+			delete(returned, c.DeliveryTag)
+		}
+	}
+}
+
+func (b *AMQP) Consume(queue string, prefetch int) (Source, error) {
+	ch, err := b.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return nil, fmt.Errorf("erro ao definir QoS: %w", err)
+	}
+
+	messages, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consumir mensagens: %w", err)
+	}
+
+	s := &amqpSource{
+		deliveries: make(chan Delivery),
+		done:       make(chan struct{}),
+	}
+	go s.run(messages)
+	return s, nil
+}
+
+func (b *AMQP) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ch != nil {
+		b.ch.Close()
+	}
+	if b.conn != nil {
+		return b.conn.Close()
+	}
+	return nil
+}
+
+type amqpSource struct {
+	deliveries chan Delivery
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func (s *amqpSource) Deliveries() <-chan Delivery {
+	return s.deliveries
+}
+
+func (s *amqpSource) run(messages <-chan amqp.Delivery) {
+	defer close(s.deliveries)
+
+	for msg := range messages {
+		msg := msg
+		headers := map[string]interface{}(msg.Headers)
+		delete(headers, publishSeqHeader)
+		delivery := NewDelivery(Message{
+			RoutingKey:      msg.RoutingKey,
+			Body:            msg.Body,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			MessageID:       msg.MessageId,
+			Headers:         headers,
+		}, msg.DeliveryTag, msg.Redelivered,
+			func() error { return msg.Ack(false) },
+			func(requeue bool) error { return msg.Nack(false, requeue) })
+
+		select {
+		case s.deliveries <- delivery:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *amqpSource) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
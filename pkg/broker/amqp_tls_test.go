@@ -0,0 +1,270 @@
+package broker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, server bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Erro ao gerar chave: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	switch {
+	case parent == nil:
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	case server:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		template.DNSNames = []string{"localhost"}
+	default:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Erro ao criar certificado %s: %v", cn, err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write grava o certificado e a chave em PEM e devolve os caminhos.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key_der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Erro ao serializar chave: %v", err)
+	}
+	cert_path := filepath.Join(dir, name+".pem")
+	key_path := filepath.Join(dir, name+"-key.pem")
+	os.WriteFile(cert_path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	os.WriteFile(key_path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der}), 0600)
+	return cert_path, key_path
+}
+
+type handshake struct {
+	clientCN  string
+	mechanism string
+	err       error
+}
+
+// serveAMQP aceita uma conexão TLS e responde o mínimo do protocolo AMQP
+// 0-9-1 para que o cliente conecte, abra um canal e feche.
+func serveAMQP(listener net.Listener, result chan<- handshake) {
+	conn, err := listener.Accept()
+	if err != nil {
+		result <- handshake{err: err}
+		return
+	}
+	defer conn.Close()
+
+	tls_conn := conn.(*tls.Conn)
+	if err := tls_conn.Handshake(); err != nil {
+		result <- handshake{err: err}
+		return
+	}
+
+	var got handshake
+	if peers := tls_conn.ConnectionState().PeerCertificates; len(peers) > 0 {
+		got.clientCN = peers[0].Subject.CommonName
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		result <- handshake{err: err}
+		return
+	}
+
+	start := []byte{0, 9, 0, 0, 0, 0}
+	start = appendLongString(start, "EXTERNAL PLAIN")
+	start = appendLongString(start, "en_US")
+	writeMethod(conn, 0, 10, 10, start)
+
+	for {
+		frame_type, channel, payload, err := readFrame(conn)
+		if err != nil {
+			result <- handshake{err: err}
+			return
+		}
+		if frame_type != 1 {
+			continue
+		}
+
+		class, method := binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])
+		switch {
+		case class == 10 && method == 11:
+			args := payload[4:]
+			table := binary.BigEndian.Uint32(args)
+			args = args[4+table:]
+			got.mechanism = string(args[1 : 1+args[0]])
+			writeMethod(conn, 0, 10, 30, []byte{0, 0, 0, 2, 0, 0, 0, 0})
+		case class == 10 && method == 40:
+			writeMethod(conn, 0, 10, 41, []byte{0})
+		case class == 20 && method == 10:
+			writeMethod(conn, channel, 20, 11, []byte{0, 0, 0, 0})
+		case class == 20 && method == 40:
+			writeMethod(conn, channel, 20, 41, nil)
+		case class == 10 && method == 50:
+			writeMethod(conn, 0, 10, 51, nil)
+			result <- got
+			return
+		}
+	}
+}
+
+func appendLongString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func writeMethod(w io.Writer, channel, class, method uint16, args []byte) {
+	payload := binary.BigEndian.AppendUint16(nil, class)
+	payload = binary.BigEndian.AppendUint16(payload, method)
+	payload = append(payload, args...)
+
+	frame := []byte{1}
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	w.Write(append(frame, 0xCE))
+}
+
+func readFrame(r io.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), body[:len(body)-1], nil
+}
+
+// startTLSServer sobe um listener que exige certificado de cliente assinado
+// pela CA de teste e devolve a URL amqps:// e os arquivos do cliente.
+func startTLSServer(t *testing.T) (string, TLSFiles, chan handshake) {
+	t.Helper()
+
+	dir := t.TempDir()
+	ca := newTestCert(t, "eventcounter-test-ca", nil, false)
+	server := newTestCert(t, "localhost", ca, true)
+	client := newTestCert(t, "eventcounter-client", ca, false)
+
+	ca_path, _ := ca.write(t, dir, "ca")
+	cert_path, key_path := client.write(t, dir, "client")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("Erro ao abrir listener TLS: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	result := make(chan handshake, 1)
+	go serveAMQP(listener, result)
+
+	url := fmt.Sprintf("amqps://%s/", listener.Addr().String())
+	return url, TLSFiles{CAFile: ca_path, CertFile: cert_path, KeyFile: key_path}, result
+}
+
+func TestDialAMQPWithOptions_TLSExternal(t *testing.T) {
+	url, files, result := startTLSServer(t)
+
+	tls_config, err := files.Config()
+	if err != nil {
+		t.Fatalf("Erro ao carregar TLS: %v", err)
+	}
+
+	b, err := DialAMQPWithOptions(url, AMQPOptions{TLS: tls_config, External: true})
+	if err != nil {
+		t.Fatalf("Erro ao conectar via TLS: %v", err)
+	}
+	b.Close()
+
+	select {
+	case got := <-result:
+		if got.err != nil {
+			t.Fatalf("Erro no servidor: %v", got.err)
+		}
+		if got.clientCN != "eventcounter-client" {
+			t.Errorf("Servidor deveria ver o certificado do cliente, obtido CN %q", got.clientCN)
+		}
+		if got.mechanism != "EXTERNAL" {
+			t.Errorf("Esperado mecanismo EXTERNAL, obtido %q", got.mechanism)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Servidor não concluiu o handshake")
+	}
+}
+
+func TestDialAMQPWithOptions_RejectsUnknownCA(t *testing.T) {
+	url, files, _ := startTLSServer(t)
+
+	files.CAFile = ""
+	tls_config, err := files.Config()
+	if err != nil {
+		t.Fatalf("Erro ao carregar TLS: %v", err)
+	}
+
+	if _, err := DialAMQPWithOptions(url, AMQPOptions{TLS: tls_config, External: true}); err == nil {
+		t.Error("Conexão deveria falhar sem a CA do servidor")
+	}
+}
+
+func TestDialAMQPWithOptions_TLSRequiresAMQPS(t *testing.T) {
+	if _, err := DialAMQPWithOptions("amqp://localhost:5672/", AMQPOptions{TLS: &tls.Config{}}); err == nil {
+		t.Error("TLS com amqp:// deveria ser recusado")
+	}
+}
+
+func TestTLSFiles_InvalidCA(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(path, []byte("não é PEM"), 0600)
+
+	if _, err := (TLSFiles{CAFile: path}).Config(); err == nil {
+		t.Error("CA inválida deveria falhar")
+	}
+}
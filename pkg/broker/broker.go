@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrClosed = errors.New("broker fechado")
+
+type Message struct {
+	RoutingKey      string
+	Body            []byte
+	ContentType     string
+	ContentEncoding string
+	MessageID       string
+	Headers         map[string]interface{}
+}
+
+type Delivery struct {
+	Message
+	DeliveryTag uint64
+	Redelivered bool
+
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+func NewDelivery(msg Message, tag uint64, redelivered bool, ack func() error, nack func(requeue bool) error) Delivery {
+	return Delivery{
+		Message:     msg,
+		DeliveryTag: tag,
+		Redelivered: redelivered,
+		ack:         ack,
+		nack:        nack,
+	}
+}
+
+func (d Delivery) Ack() error {
+	if d.ack == nil {
+		return nil
+	}
+	return d.ack()
+}
+
+func (d Delivery) Nack(requeue bool) error {
+	if d.nack == nil {
+		return nil
+	}
+	return d.nack(requeue)
+}
+
+// Source entrega mensagens de uma fila até ser fechada; o canal de
+// Deliveries é fechado junto com ela.
+type Source interface {
+	Deliveries() <-chan Delivery
+	Close() error
+}
+
+// Argumentos de fila reconhecidos pelo broker em memória, com a mesma
+// semântica do RabbitMQ.
+const (
+	ArgQueueType            = "x-queue-type"
+	ArgMaxLength            = "x-max-length"
+	ArgDeadLetterExchange   = "x-dead-letter-exchange"
+	ArgDeadLetterRoutingKey = "x-dead-letter-routing-key"
+)
+
+// ParseQueueArgs converte pares chave=valor em argumentos de fila, com
+// inteiros e booleanos convertidos para os tipos que o RabbitMQ espera.
+func ParseQueueArgs(pairs []string) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("esperado chave=valor, obtido %q", pair)
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			args[key] = n
+		} else if b, err := strconv.ParseBool(value); err == nil {
+			args[key] = b
+		} else {
+			args[key] = value
+		}
+	}
+	return args, nil
+}
+
+// Broker declara topologia, publica e consome. DeclareQueue recebe os
+// argumentos da fila (x-queue-type, x-max-length, DLX...) e falha se a fila
+// já existir com argumentos diferentes; CheckExchange e CheckQueue são
+// declarações passivas, que só verificam se a entidade existe.
+type Broker interface {
+	DeclareExchange(name, kind string) error
+	DeclareQueue(name string, args map[string]interface{}) error
+	CheckExchange(name, kind string) error
+	CheckQueue(name string) error
+	BindQueue(queue, key, exchange string) error
+	Publish(ctx context.Context, exchange string, msg Message, mandatory bool) (*Confirmation, error)
+	Consume(queue string, prefetch int) (Source, error)
+	Close() error
+}
+
+// Confirmation é resolvida quando o broker confirma (ou rejeita) a
+// publicação. Returned indica que a mensagem mandatory não tinha rota, e
+// Lost que o canal fechou antes da confirmação.
+type Confirmation struct {
+	done     chan struct{}
+	acked    bool
+	returned bool
+	lost     bool
+}
+
+func NewConfirmation() *Confirmation {
+	return &Confirmation{done: make(chan struct{})}
+}
+
+func (c *Confirmation) resolve(acked, returned, lost bool) {
+	c.acked = acked
+	c.returned = returned
+	c.lost = lost
+	close(c.done)
+}
+
+func (c *Confirmation) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Confirmation) Acked() bool {
+	<-c.done
+	return c.acked
+}
+
+func (c *Confirmation) Returned() bool {
+	<-c.done
+	return c.returned
+}
+
+func (c *Confirmation) Lost() bool {
+	<-c.done
+	return c.lost
+}
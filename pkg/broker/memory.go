@@ -0,0 +1,423 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Memory é um broker em processo com exchanges topic/direct/fanout, filas
+// duráveis enquanto o processo viver, prefetch, ack, nack e reentrega.
+// Das filas, entende x-max-length (descarta as mais antigas) e
+// x-dead-letter-exchange/x-dead-letter-routing-key (rejeitadas sem requeue
+// e descartadas por tamanho vão para o DLX). Serve para rodar gerador e
+// consumidor em testes sem RabbitMQ.
+type Memory struct {
+	mu        sync.Mutex
+	exchanges map[string]string
+	bindings  map[string][]memoryBinding
+	queues    map[string]*memoryQueue
+	closed    bool
+}
+
+type memoryBinding struct {
+	queue string
+	key   string
+}
+
+type memoryQueue struct {
+	name    string
+	args    map[string]interface{}
+	ready   []Delivery
+	cond    *sync.Cond
+	nextTag uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		exchanges: map[string]string{"": "direct"},
+		bindings:  make(map[string][]memoryBinding),
+		queues:    make(map[string]*memoryQueue),
+	}
+}
+
+func (m *Memory) DeclareExchange(name, kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if existing, ok := m.exchanges[name]; ok && existing != kind {
+		return fmt.Errorf("exchange %s já declarado com tipo %s", name, existing)
+	}
+	switch kind {
+	case "topic", "direct", "fanout":
+	default:
+		return fmt.Errorf("tipo de exchange não suportado: %s", kind)
+	}
+
+	m.exchanges[name] = kind
+	return nil
+}
+
+func (m *Memory) DeclareQueue(name string, args map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if q, ok := m.queues[name]; ok {
+		if !sameArgs(q.args, args) {
+			return fmt.Errorf("fila %s já declarada com argumentos diferentes: %v", name, q.args)
+		}
+		return nil
+	}
+
+	q := &memoryQueue{name: name, cond: sync.NewCond(&m.mu)}
+	if len(args) > 0 {
+		q.args = make(map[string]interface{}, len(args))
+		for k, v := range args {
+			q.args[k] = v
+		}
+	}
+	m.queues[name] = q
+	return nil
+}
+
+func (m *Memory) CheckExchange(name, kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.exchanges[name]; !ok {
+		return fmt.Errorf("exchange %s não encontrado", name)
+	}
+	return nil
+}
+
+func (m *Memory) CheckQueue(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.queues[name]; !ok {
+		return fmt.Errorf("fila %s não encontrada", name)
+	}
+	return nil
+}
+
+func sameArgs(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (m *Memory) BindQueue(queue, key, exchange string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	if _, ok := m.exchanges[exchange]; !ok {
+		return fmt.Errorf("exchange %s não declarado", exchange)
+	}
+	if _, ok := m.queues[queue]; !ok {
+		return fmt.Errorf("fila %s não declarada", queue)
+	}
+
+	m.bindings[exchange] = append(m.bindings[exchange], memoryBinding{queue: queue, key: key})
+	return nil
+}
+
+func (m *Memory) Publish(ctx context.Context, exchange string, msg Message, mandatory bool) (*Confirmation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	kind, ok := m.exchanges[exchange]
+	if !ok {
+		return nil, fmt.Errorf("exchange %s não declarado", exchange)
+	}
+
+	routed := m.routeLocked(exchange, kind, msg)
+	for _, name := range routed {
+		m.enqueueLocked(m.queues[name], Delivery{Message: copyMessage(msg)})
+	}
+
+	confirmation := NewConfirmation()
+	confirmation.resolve(true, mandatory && len(routed) == 0, false)
+	return confirmation, nil
+}
+
+func (m *Memory) routeLocked(exchange, kind string, msg Message) []string {
+	routed := make(map[string]bool)
+	if exchange == "" {
+		if _, ok := m.queues[msg.RoutingKey]; ok {
+			routed[msg.RoutingKey] = true
+		}
+	}
+	for _, b := range m.bindings[exchange] {
+		if kind == "fanout" || (kind == "direct" && b.key == msg.RoutingKey) || (kind == "topic" && MatchTopic(b.key, msg.RoutingKey)) {
+			routed[b.queue] = true
+		}
+	}
+
+	names := make([]string, 0, len(routed))
+	for name := range routed {
+		names = append(names, name)
+	}
+	return names
+}
+
+// enqueueLocked aplica x-max-length como o overflow padrão do RabbitMQ
+// (drop-head): as mensagens mais antigas saem da fila e vão para o DLX.
+func (m *Memory) enqueueLocked(q *memoryQueue, d Delivery) {
+	q.ready = append(q.ready, d)
+	if max, ok := intArg(q.args[ArgMaxLength]); ok {
+		for len(q.ready) > max {
+			head := q.ready[0]
+			q.ready = q.ready[1:]
+			m.deadLetterLocked(q, head.Message, "maxlen")
+		}
+	}
+	q.cond.Broadcast()
+}
+
+// deadLetterLocked republica a mensagem no DLX da fila, se houver, com os
+// headers x-first-death-* que o RabbitMQ adiciona.
+func (m *Memory) deadLetterLocked(q *memoryQueue, msg Message, reason string) {
+	dlx, ok := q.args[ArgDeadLetterExchange].(string)
+	if !ok {
+		return
+	}
+	kind, ok := m.exchanges[dlx]
+	if !ok {
+		return
+	}
+
+	out := copyMessage(msg)
+	if key, ok := q.args[ArgDeadLetterRoutingKey].(string); ok {
+		out.RoutingKey = key
+	}
+	if out.Headers == nil {
+		out.Headers = make(map[string]interface{})
+	}
+	if _, ok := out.Headers["x-first-death-reason"]; !ok {
+		out.Headers["x-first-death-reason"] = reason
+		out.Headers["x-first-death-queue"] = q.name
+	}
+
+	for _, name := range m.routeLocked(dlx, kind, out) {
+		if name == q.name {
+			continue
+		}
+		m.enqueueLocked(m.queues[name], Delivery{Message: copyMessage(out)})
+	}
+}
+
+func intArg(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+func (m *Memory) Consume(queue string, prefetch int) (Source, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	q, ok := m.queues[queue]
+	if !ok {
+		return nil, fmt.Errorf("fila %s não declarada", queue)
+	}
+
+	s := &memorySource{
+		broker:     m,
+		queue:      q,
+		prefetch:   prefetch,
+		unacked:    make(map[uint64]Delivery),
+		deliveries: make(chan Delivery),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Depth retorna quantas mensagens aguardam entrega na fila.
+func (m *Memory) Depth(queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if q, ok := m.queues[queue]; ok {
+		return len(q.ready)
+	}
+	return 0
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	for _, q := range m.queues {
+		q.cond.Broadcast()
+	}
+	return nil
+}
+
+type memorySource struct {
+	broker     *Memory
+	queue      *memoryQueue
+	prefetch   int
+	unacked    map[uint64]Delivery
+	deliveries chan Delivery
+	done       chan struct{}
+	closeOnce  sync.Once
+	stopped    bool
+}
+
+func (s *memorySource) Deliveries() <-chan Delivery {
+	return s.deliveries
+}
+
+func (s *memorySource) run() {
+	defer close(s.deliveries)
+
+	m := s.broker
+	for {
+		m.mu.Lock()
+		for !s.stopped && !m.closed && (len(s.queue.ready) == 0 || (s.prefetch > 0 && len(s.unacked) >= s.prefetch)) {
+			s.queue.cond.Wait()
+		}
+		if s.stopped || m.closed {
+			m.mu.Unlock()
+			return
+		}
+
+		d := s.queue.ready[0]
+		s.queue.ready = s.queue.ready[1:]
+		s.queue.nextTag++
+		tag := s.queue.nextTag
+		s.unacked[tag] = d
+		m.mu.Unlock()
+
+		delivery := NewDelivery(d.Message, tag, d.Redelivered,
+			func() error { return s.settle(tag, false, false) },
+			func(requeue bool) error { return s.settle(tag, true, requeue) })
+
+		select {
+		case s.deliveries <- delivery:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *memorySource) settle(tag uint64, nack, requeue bool) error {
+	m := s.broker
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := s.unacked[tag]
+	if !ok {
+		return fmt.Errorf("delivery tag %d desconhecida ou já confirmada", tag)
+	}
+	delete(s.unacked, tag)
+
+	if nack && requeue {
+		d.Redelivered = true
+		s.queue.ready = append([]Delivery{d}, s.queue.ready...)
+	} else if nack {
+		m.deadLetterLocked(s.queue, d.Message, "rejected")
+	}
+	s.queue.cond.Broadcast()
+	return nil
+}
+
+// Close devolve à fila as mensagens entregues e não confirmadas, marcadas
+// como reentregues, como o RabbitMQ faz ao fechar o canal.
+func (s *memorySource) Close() error {
+	s.closeOnce.Do(func() {
+		m := s.broker
+		m.mu.Lock()
+		s.stopped = true
+
+		var requeue []Delivery
+		for tag, d := range s.unacked {
+			d.Redelivered = true
+			requeue = append(requeue, d)
+			delete(s.unacked, tag)
+		}
+		s.queue.ready = append(requeue, s.queue.ready...)
+		s.queue.cond.Broadcast()
+		m.mu.Unlock()
+
+		close(s.done)
+	})
+	return nil
+}
+
+func copyMessage(msg Message) Message {
+	out := msg
+	out.Body = append([]byte(nil), msg.Body...)
+	if msg.Headers != nil {
+		out.Headers = make(map[string]interface{}, len(msg.Headers))
+		for k, v := range msg.Headers {
+			out.Headers[k] = v
+		}
+	}
+	return out
+}
+
+// MatchTopic implementa a semântica de binding do exchange topic:
+// "*" casa exatamente uma palavra e "#" casa zero ou mais.
+func MatchTopic(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+	}
+}
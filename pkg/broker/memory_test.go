@@ -0,0 +1,242 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTopicBroker(t *testing.T) *Memory {
+	t.Helper()
+
+	b := NewMemory()
+	if err := b.DeclareExchange("events", "topic"); err != nil {
+		t.Fatalf("Erro ao declarar exchange: %v", err)
+	}
+	if err := b.DeclareQueue("counter", nil); err != nil {
+		t.Fatalf("Erro ao declarar fila: %v", err)
+	}
+	if err := b.BindQueue("counter", "*.event.*", "events"); err != nil {
+		t.Fatalf("Erro ao ligar fila: %v", err)
+	}
+	return b
+}
+
+func receive(t *testing.T, source Source) Delivery {
+	t.Helper()
+
+	select {
+	case d, ok := <-source.Deliveries():
+		if !ok {
+			t.Fatal("Canal de entregas fechado inesperadamente")
+		}
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("Nenhuma mensagem entregue")
+	}
+	return Delivery{}
+}
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"*.event.*", "user_a.event.created", true},
+		{"*.event.*", ".event.created", true},
+		{"*.event.*", "user.a.event.created", false},
+		{"#.event.*", "tenant.user_a.event.created", true},
+		{"#", "", true},
+		{"user_a.#", "user_a", true},
+		{"*.event.created", "user_a.event.deleted", false},
+	}
+
+	for _, c := range cases {
+		if got := MatchTopic(c.pattern, c.key); got != c.match {
+			t.Errorf("MatchTopic(%q, %q) = %v, esperado %v", c.pattern, c.key, got, c.match)
+		}
+	}
+}
+
+func TestMemory_PublishRoutesAndReturnsUnroutable(t *testing.T) {
+	b := newTopicBroker(t)
+	ctx := context.Background()
+
+	confirmation, err := b.Publish(ctx, "events", Message{RoutingKey: "user_a.event.created", Body: []byte("1")}, true)
+	if err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	if !confirmation.Acked() || confirmation.Returned() {
+		t.Error("Mensagem roteável deveria ser confirmada sem devolução")
+	}
+
+	confirmation, err = b.Publish(ctx, "events", Message{RoutingKey: "user_a.created", Body: []byte("2")}, true)
+	if err != nil {
+		t.Fatalf("Erro ao publicar: %v", err)
+	}
+	if !confirmation.Returned() {
+		t.Error("Mensagem mandatory sem rota deveria ser devolvida")
+	}
+
+	if depth := b.Depth("counter"); depth != 1 {
+		t.Errorf("Esperado 1 mensagem na fila, obtido %d", depth)
+	}
+
+	if _, err := b.Publish(ctx, "missing", Message{RoutingKey: "x"}, false); err == nil {
+		t.Error("Esperado erro ao publicar em exchange não declarado")
+	}
+}
+
+func TestMemory_NackRequeueRedelivers(t *testing.T) {
+	b := newTopicBroker(t)
+	b.Publish(context.Background(), "events", Message{RoutingKey: "user_a.event.created", Body: []byte("1")}, false)
+
+	source, err := b.Consume("counter", 1)
+	if err != nil {
+		t.Fatalf("Erro ao consumir: %v", err)
+	}
+	defer source.Close()
+
+	first := receive(t, source)
+	if first.Redelivered {
+		t.Error("Primeira entrega não deveria estar marcada como reentregue")
+	}
+	if err := first.Nack(true); err != nil {
+		t.Fatalf("Erro no nack: %v", err)
+	}
+
+	second := receive(t, source)
+	if !second.Redelivered || string(second.Body) != "1" {
+		t.Errorf("Esperada reentrega da mesma mensagem, obtido %+v", second)
+	}
+	if err := second.Ack(); err != nil {
+		t.Fatalf("Erro no ack: %v", err)
+	}
+	if err := second.Ack(); err == nil {
+		t.Error("Ack duplicado deveria retornar erro")
+	}
+}
+
+func TestMemory_NackWithoutRequeueDiscards(t *testing.T) {
+	b := newTopicBroker(t)
+	b.Publish(context.Background(), "events", Message{RoutingKey: "user_a.event.created"}, false)
+
+	source, _ := b.Consume("counter", 1)
+	defer source.Close()
+
+	receive(t, source).Nack(false)
+
+	select {
+	case d := <-source.Deliveries():
+		t.Errorf("Mensagem descartada não deveria ser reentregue: %+v", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemory_PrefetchAndCloseRequeue(t *testing.T) {
+	b := newTopicBroker(t)
+	for i := 0; i < 3; i++ {
+		b.Publish(context.Background(), "events", Message{RoutingKey: "user_a.event.created"}, false)
+	}
+
+	source, _ := b.Consume("counter", 1)
+	receive(t, source)
+
+	select {
+	case <-source.Deliveries():
+		t.Error("Prefetch 1 não deveria entregar uma segunda mensagem antes do ack")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	source.Close()
+	if depth := b.Depth("counter"); depth != 3 {
+		t.Errorf("Mensagem não confirmada deveria voltar para a fila: esperado 3, obtido %d", depth)
+	}
+
+	other, _ := b.Consume("counter", 0)
+	defer other.Close()
+	if d := receive(t, other); !d.Redelivered {
+		t.Error("Mensagem devolvida ao fechar o consumidor deveria estar marcada como reentregue")
+	}
+}
+
+func newDeadLetterBroker(t *testing.T, args map[string]interface{}) *Memory {
+	t.Helper()
+
+	b := NewMemory()
+	b.DeclareExchange("events", "topic")
+	b.DeclareExchange("dlx", "fanout")
+	b.DeclareQueue("dead", nil)
+	b.BindQueue("dead", "", "dlx")
+
+	args[ArgDeadLetterExchange] = "dlx"
+	if err := b.DeclareQueue("counter", args); err != nil {
+		t.Fatalf("Erro ao declarar fila: %v", err)
+	}
+	b.BindQueue("counter", "*.event.*", "events")
+	return b
+}
+
+func TestMemory_NackWithoutRequeueDeadLetters(t *testing.T) {
+	b := newDeadLetterBroker(t, map[string]interface{}{ArgDeadLetterRoutingKey: "rejected"})
+	b.Publish(context.Background(), "events", Message{RoutingKey: "user_a.event.created", Body: []byte("x")}, false)
+
+	source, _ := b.Consume("counter", 1)
+	defer source.Close()
+	receive(t, source).Nack(false)
+
+	dead, _ := b.Consume("dead", 1)
+	defer dead.Close()
+	d := receive(t, dead)
+	if d.RoutingKey != "rejected" || string(d.Body) != "x" {
+		t.Errorf("Mensagem no DLX incorreta: %+v", d.Message)
+	}
+	if d.Headers["x-first-death-reason"] != "rejected" || d.Headers["x-first-death-queue"] != "counter" {
+		t.Errorf("Headers de dead-letter incorretos: %v", d.Headers)
+	}
+}
+
+func TestMemory_MaxLengthDropsOldestToDLX(t *testing.T) {
+	b := newDeadLetterBroker(t, map[string]interface{}{ArgMaxLength: int64(2)})
+	for i := 0; i < 3; i++ {
+		b.Publish(context.Background(), "events", Message{RoutingKey: "user_a.event.created", MessageID: string(rune('a' + i))}, false)
+	}
+
+	if depth := b.Depth("counter"); depth != 2 {
+		t.Errorf("Esperado 2 mensagens na fila limitada, obtido %d", depth)
+	}
+	if depth := b.Depth("dead"); depth != 1 {
+		t.Fatalf("Esperado 1 mensagem no DLX, obtido %d", depth)
+	}
+
+	dead, _ := b.Consume("dead", 1)
+	defer dead.Close()
+	if d := receive(t, dead); d.MessageID != "a" || d.Headers["x-first-death-reason"] != "maxlen" {
+		t.Errorf("A mensagem mais antiga deveria ir ao DLX por maxlen: %+v", d.Message)
+	}
+}
+
+func TestMemory_QueueArgsAndPassiveChecks(t *testing.T) {
+	b := NewMemory()
+
+	if err := b.CheckQueue("counter"); err == nil {
+		t.Error("Verificação passiva de fila inexistente deveria falhar")
+	}
+	if err := b.CheckExchange("events", "topic"); err == nil {
+		t.Error("Verificação passiva de exchange inexistente deveria falhar")
+	}
+
+	args := map[string]interface{}{ArgQueueType: "quorum"}
+	if err := b.DeclareQueue("counter", args); err != nil {
+		t.Fatalf("Erro ao declarar fila: %v", err)
+	}
+	if err := b.DeclareQueue("counter", map[string]interface{}{ArgQueueType: "quorum"}); err != nil {
+		t.Errorf("Redeclarar com os mesmos argumentos deveria funcionar: %v", err)
+	}
+	if err := b.DeclareQueue("counter", nil); err == nil {
+		t.Error("Redeclarar com argumentos diferentes deveria falhar")
+	}
+	if err := b.CheckQueue("counter"); err != nil {
+		t.Errorf("Verificação passiva deveria encontrar a fila: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+)
+
+// ContentTypeBatch identifica o envelope em lote: um array JSON de
+// eventcounter.Message, com usuário e tipo em cada evento, já que a chave de
+// roteamento da entrega não os representa.
+const ContentTypeBatch = "application/vnd.eventcounter.batch+json"
+
+// IsBatch diz se a mensagem é um envelope em lote.
+func IsBatch(msg broker.Message) bool {
+	media_type, _, err := mime.ParseMediaType(msg.ContentType)
+	return err == nil && media_type == ContentTypeBatch
+}
+
+// EncodeBatch monta o envelope com as mensagens na ordem recebida.
+func EncodeBatch(msgs []eventcounter.Message) (broker.Message, error) {
+	body, err := json.Marshal(msgs)
+	return broker.Message{Body: body, ContentType: ContentTypeBatch}, err
+}
+
+// DecodeBatch devolve os campos de cada evento do envelope, com uid
+// renomeado para id como no payload de uma mensagem avulsa. Um envelope
+// vazio é inválido.
+func DecodeBatch(msg broker.Message) ([]Fields, error) {
+	decoder := json.NewDecoder(bytes.NewReader(msg.Body))
+	decoder.UseNumber()
+
+	var entries []Fields
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("lote inválido: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("lote inválido: conteúdo após o array")
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("lote inválido: nenhum evento")
+	}
+
+	for i, fields := range entries {
+		if fields == nil {
+			return nil, fmt.Errorf("lote inválido: evento %d deve ser um objeto", i)
+		}
+		if uid, ok := fields["uid"]; ok {
+			delete(fields, "uid")
+			fields["id"] = uid
+		}
+	}
+	return entries, nil
+}
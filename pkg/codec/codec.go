@@ -0,0 +1,284 @@
+// Package codec codifica e decodifica o payload dos eventos nos formatos
+// aceitos pelo consumidor (JSON, MessagePack, Protobuf e CloudEvents), com
+// o formato escolhido pelo ContentType da mensagem.
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeMsgPack     = "application/msgpack"
+	ContentTypeProtobuf    = "application/x-protobuf"
+	ContentTypeCloudEvents = "application/cloudevents+json"
+)
+
+// Formatos que o gerador sabe emitir.
+const (
+	FormatJSON                  = "json"
+	FormatMsgPack               = "msgpack"
+	FormatProtobuf              = "protobuf"
+	FormatCloudEventsBinary     = "cloudevents-binary"
+	FormatCloudEventsStructured = "cloudevents-structured"
+)
+
+var Formats = []string{FormatJSON, FormatMsgPack, FormatProtobuf, FormatCloudEventsBinary, FormatCloudEventsStructured}
+
+// Atributos CloudEvents. No modo binário eles vão nos headers com o prefixo
+// do binding AMQP (cloudEvents:); ce_ e ce- (Kafka e HTTP) também são
+// aceitos na leitura.
+const (
+	CloudEventsHeaderPrefix = "cloudEvents:"
+	CloudEventsSpecVersion  = "1.0"
+	CloudEventsSource       = "eventcounter/generator"
+	CloudEventsTypePrefix   = "eventcounter.user."
+)
+
+var cloudEventsPrefixes = []string{CloudEventsHeaderPrefix, "cloudEvents_", "ce_", "ce-"}
+
+var ErrUnsupportedContentType = errors.New("content type não suportado")
+
+// Fields são os campos do payload decodificado, com os nomes do JSON
+// (id, user_id, event_type, value) qualquer que seja o formato de origem.
+type Fields map[string]interface{}
+
+type Decoder interface {
+	Decode(msg broker.Message) (Fields, error)
+}
+
+type DecoderFunc func(msg broker.Message) (Fields, error)
+
+func (f DecoderFunc) Decode(msg broker.Message) (Fields, error) {
+	return f(msg)
+}
+
+// Registry escolhe o Decoder pelo ContentType (sem parâmetros como
+// charset). Mensagens sem ContentType são lidas como JSON, como as
+// publicadas antes da existência do registro.
+type Registry struct {
+	mu       sync.RWMutex
+	decoders map[string]Decoder
+}
+
+// NewRegistry devolve um registro com JSON, MessagePack, Protobuf e
+// CloudEvents estruturado registrados; o modo binário do CloudEvents é
+// reconhecido pelos headers, com os dados no ContentType da mensagem.
+func NewRegistry() *Registry {
+	r := &Registry{decoders: make(map[string]Decoder)}
+	r.Register(ContentTypeJSON, DecoderFunc(decodeJSON))
+	r.Register(ContentTypeMsgPack, DecoderFunc(decodeMsgPack))
+	r.Register("application/x-msgpack", DecoderFunc(decodeMsgPack))
+	r.Register(ContentTypeProtobuf, DecoderFunc(decodeProtobuf))
+	r.Register("application/protobuf", DecoderFunc(decodeProtobuf))
+	r.Register(ContentTypeCloudEvents, DecoderFunc(r.decodeCloudEventsStructured))
+	return r
+}
+
+func (r *Registry) Register(content_type string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[content_type] = d
+}
+
+func (r *Registry) Decode(msg broker.Message) (Fields, error) {
+	if attrs := cloudEventsHeaders(msg.Headers); attrs != nil {
+		return r.decodeCloudEventsBinary(msg, attrs)
+	}
+	return r.decodeContent(msg)
+}
+
+func (r *Registry) decodeContent(msg broker.Message) (Fields, error) {
+	media_type := ContentTypeJSON
+	if msg.ContentType != "" {
+		parsed, _, err := mime.ParseMediaType(msg.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentType, msg.ContentType)
+		}
+		media_type = parsed
+	}
+
+	r.mu.RLock()
+	d, ok := r.decoders[media_type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentType, media_type)
+	}
+	return d.Decode(msg)
+}
+
+func decodeJSON(msg broker.Message) (Fields, error) {
+	decoder := json.NewDecoder(bytes.NewReader(msg.Body))
+	decoder.UseNumber()
+
+	var fields Fields
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("JSON inválido: %w", err)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("JSON inválido: payload deve ser um objeto")
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("JSON inválido: conteúdo após o objeto")
+	}
+	return fields, nil
+}
+
+func decodeMsgPack(msg broker.Message) (Fields, error) {
+	var fields Fields
+	if err := msgpack.Unmarshal(msg.Body, &fields); err != nil {
+		return nil, fmt.Errorf("MessagePack inválido: %w", err)
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("MessagePack inválido: payload deve ser um mapa")
+	}
+	return fields, nil
+}
+
+func decodeProtobuf(msg broker.Message) (Fields, error) {
+	var m eventcounter.Message
+	if err := m.UnmarshalProto(msg.Body); err != nil {
+		return nil, err
+	}
+	return messageFields(m), nil
+}
+
+func messageFields(m eventcounter.Message) Fields {
+	fields := Fields{}
+	if m.UID != "" {
+		fields["id"] = m.UID
+	}
+	if m.UserID != "" {
+		fields["user_id"] = m.UserID
+	}
+	if m.EventType != "" {
+		fields["event_type"] = string(m.EventType)
+	}
+	if m.Value != nil {
+		fields["value"] = *m.Value
+	}
+	return fields
+}
+
+// cloudEvent são os atributos CloudEvents usados pelo consumidor.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+func (e cloudEvent) validate() error {
+	if e.SpecVersion != CloudEventsSpecVersion {
+		return fmt.Errorf("CloudEvents: specversion %q não suportada", e.SpecVersion)
+	}
+	for name, value := range map[string]string{"id": e.ID, "source": e.Source, "type": e.Type} {
+		if value == "" {
+			return fmt.Errorf("CloudEvents: atributo %s obrigatório", name)
+		}
+	}
+	return nil
+}
+
+// apply sobrepõe aos campos dos dados os atributos do evento: id, subject
+// (usuário) e type (tipo, sem o prefixo CloudEventsTypePrefix).
+func (e cloudEvent) apply(fields Fields) Fields {
+	if fields == nil {
+		fields = Fields{}
+	}
+	fields["id"] = e.ID
+	if e.Subject != "" {
+		fields["user_id"] = e.Subject
+	}
+	if event_type, ok := strings.CutPrefix(e.Type, CloudEventsTypePrefix); ok {
+		fields["event_type"] = event_type
+	}
+	return fields
+}
+
+func cloudEventsHeaders(headers map[string]interface{}) map[string]string {
+	var attrs map[string]string
+	for key, value := range headers {
+		for _, prefix := range cloudEventsPrefixes {
+			name, ok := strings.CutPrefix(key, prefix)
+			if !ok {
+				continue
+			}
+			if attrs == nil {
+				attrs = make(map[string]string)
+			}
+			attrs[strings.ToLower(name)] = fmt.Sprint(value)
+		}
+	}
+	if _, ok := attrs["specversion"]; !ok {
+		return nil
+	}
+	return attrs
+}
+
+func (r *Registry) decodeCloudEventsBinary(msg broker.Message, attrs map[string]string) (Fields, error) {
+	event := cloudEvent{
+		SpecVersion: attrs["specversion"],
+		ID:          attrs["id"],
+		Source:      attrs["source"],
+		Type:        attrs["type"],
+		Subject:     attrs["subject"],
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+
+	var fields Fields
+	if len(msg.Body) > 0 {
+		data := msg
+		data.Headers = nil
+		var err error
+		if fields, err = r.decodeContent(data); err != nil {
+			return nil, fmt.Errorf("CloudEvents: dados: %w", err)
+		}
+	}
+	return event.apply(fields), nil
+}
+
+func (r *Registry) decodeCloudEventsStructured(msg broker.Message) (Fields, error) {
+	var event cloudEvent
+	if err := json.Unmarshal(msg.Body, &event); err != nil {
+		return nil, fmt.Errorf("CloudEvents inválido: %w", err)
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+
+	data := broker.Message{ContentType: event.DataContentType, Body: event.Data}
+	if event.DataBase64 != "" {
+		body, err := base64.StdEncoding.DecodeString(event.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("CloudEvents: data_base64 inválido: %w", err)
+		}
+		data.Body = body
+	}
+
+	var fields Fields
+	if len(data.Body) > 0 && string(data.Body) != "null" {
+		var err error
+		if fields, err = r.decodeContent(data); err != nil {
+			return nil, fmt.Errorf("CloudEvents: dados: %w", err)
+		}
+	}
+	return event.apply(fields), nil
+}
@@ -0,0 +1,157 @@
+package codec
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+)
+
+var testMessage = eventcounter.Message{UID: "0b6f1c55-8a4d-4c3e-9f4e-2b1d6a7c9e10", EventType: eventcounter.EventUpdated, UserID: "user_a"}
+
+func TestRegistry_DecodesEveryFormat(t *testing.T) {
+	registry := NewRegistry()
+
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			msg, err := Encode(format, testMessage)
+			if err != nil {
+				t.Fatalf("Erro ao codificar: %v", err)
+			}
+
+			fields, err := registry.Decode(msg)
+			if err != nil {
+				t.Fatalf("Erro ao decodificar: %v", err)
+			}
+			if fields["id"] != testMessage.UID {
+				t.Errorf("ID esperado %s, obtido %v", testMessage.UID, fields["id"])
+			}
+			if format != FormatJSON && (fields["user_id"] != "user_a" || fields["event_type"] != "updated") {
+				t.Errorf("Usuário e tipo deveriam ser decodificados, obtido %v", fields)
+			}
+
+			msg.Body = msg.Body[:len(msg.Body)-1]
+			if _, err := registry.Decode(msg); err == nil {
+				t.Error("Payload truncado deveria falhar")
+			}
+		})
+	}
+}
+
+func TestRegistry_LegacyAndUnsupportedContentTypes(t *testing.T) {
+	registry := NewRegistry()
+
+	fields, err := registry.Decode(broker.Message{Body: []byte(`{"id":"m-1"}`), ContentEncoding: "application/json"})
+	if err != nil || fields["id"] != "m-1" {
+		t.Errorf("Mensagem sem ContentType deveria ser lida como JSON, obtido %v (%v)", fields, err)
+	}
+
+	fields, err = registry.Decode(broker.Message{Body: []byte(`{"id":"m-2"}`), ContentType: "application/json; charset=utf-8"})
+	if err != nil || fields["id"] != "m-2" {
+		t.Errorf("Parâmetros do ContentType deveriam ser ignorados, obtido %v (%v)", fields, err)
+	}
+
+	if _, err := registry.Decode(broker.Message{Body: []byte("id=m-3"), ContentType: "text/plain"}); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Errorf("Esperado ErrUnsupportedContentType, obtido %v", err)
+	}
+	if _, err := registry.Decode(broker.Message{Body: []byte(`["m-4"]`)}); err == nil {
+		t.Error("JSON que não é objeto deveria falhar")
+	}
+}
+
+func TestRegistry_CloudEvents(t *testing.T) {
+	registry := NewRegistry()
+
+	// Binding Kafka (ce_) sem dados: os atributos bastam.
+	fields, err := registry.Decode(broker.Message{Headers: map[string]interface{}{
+		"ce_specversion": "1.0",
+		"ce_id":          "m-1",
+		"ce_source":      "test",
+		"ce_type":        CloudEventsTypePrefix + "created",
+	}})
+	if err != nil || fields["id"] != "m-1" || fields["event_type"] != "created" {
+		t.Errorf("CloudEvents binário com ce_ inesperado: %v (%v)", fields, err)
+	}
+
+	_, err = registry.Decode(broker.Message{Headers: map[string]interface{}{
+		CloudEventsHeaderPrefix + "specversion": "1.0",
+		CloudEventsHeaderPrefix + "id":          "m-2",
+	}})
+	if err == nil {
+		t.Error("CloudEvents sem source e type deveria falhar")
+	}
+
+	data := base64.StdEncoding.EncodeToString(mustMarshalProto(t, testMessage))
+	body := fmt.Sprintf(`{"specversion":"1.0","id":"m-3","source":"test","type":"other","datacontenttype":%q,"data_base64":%q}`, ContentTypeProtobuf, data)
+	fields, err = registry.Decode(broker.Message{Body: []byte(body), ContentType: ContentTypeCloudEvents})
+	if err != nil {
+		t.Fatalf("Erro ao decodificar CloudEvents com data_base64: %v", err)
+	}
+	if fields["id"] != "m-3" || fields["user_id"] != "user_a" || fields["event_type"] != "updated" {
+		t.Errorf("Atributos deveriam prevalecer sobre os dados, obtido %v", fields)
+	}
+}
+
+func mustMarshalProto(t *testing.T, m eventcounter.Message) []byte {
+	t.Helper()
+
+	body, err := m.MarshalProto()
+	if err != nil {
+		t.Fatalf("Erro ao codificar: %v", err)
+	}
+	return body
+}
+
+func TestMessage_ProtoRoundTrip(t *testing.T) {
+	var decoded eventcounter.Message
+	if err := decoded.UnmarshalProto(mustMarshalProto(t, testMessage)); err != nil {
+		t.Fatalf("Erro ao decodificar: %v", err)
+	}
+	if decoded != testMessage {
+		t.Errorf("Esperado %+v, obtido %+v", testMessage, decoded)
+	}
+
+	value := 12.5
+	withValue := testMessage
+	withValue.Value = &value
+	if err := decoded.UnmarshalProto(mustMarshalProto(t, withValue)); err != nil || decoded.Value == nil || *decoded.Value != value {
+		t.Errorf("Valor deveria ser preservado: %+v (%v)", decoded, err)
+	}
+
+	// Campo desconhecido (número 9, varint) é ignorado, como no proto3.
+	withUnknown := append(mustMarshalProto(t, testMessage), 0x48, 0x01)
+	if err := decoded.UnmarshalProto(withUnknown); err != nil || decoded != testMessage {
+		t.Errorf("Campo desconhecido deveria ser ignorado: %+v (%v)", decoded, err)
+	}
+}
+
+func TestBatch_RoundTrip(t *testing.T) {
+	msg, err := EncodeBatch([]eventcounter.Message{testMessage, {UID: "m-2", EventType: eventcounter.EventCreated, UserID: "user_b"}})
+	if err != nil {
+		t.Fatalf("Erro ao codificar lote: %v", err)
+	}
+	msg.ContentType += "; charset=utf-8"
+	if !IsBatch(msg) {
+		t.Fatal("Envelope deveria ser reconhecido como lote")
+	}
+
+	entries, err := DecodeBatch(msg)
+	if err != nil {
+		t.Fatalf("Erro ao decodificar lote: %v", err)
+	}
+	if len(entries) != 2 || entries[0]["id"] != testMessage.UID || entries[1]["user_id"] != "user_b" {
+		t.Errorf("Lote inesperado: %v", entries)
+	}
+	if _, ok := entries[0]["uid"]; ok {
+		t.Error("uid deveria ser renomeado para id")
+	}
+
+	for _, body := range []string{`[]`, `[null]`, `[1]`, `{"uid":"m-1"}`} {
+		if _, err := DecodeBatch(broker.Message{Body: []byte(body)}); err == nil {
+			t.Errorf("Lote %s deveria falhar", body)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+var Encodings = []string{"none", EncodingGzip, EncodingZstd}
+
+var (
+	ErrUnsupportedEncoding  = errors.New("content encoding não suportado")
+	ErrDecompressedTooLarge = errors.New("payload descomprimido excede o limite")
+)
+
+// Compress comprime o corpo com o encoding pedido e o registra em
+// ContentEncoding; "none" ou vazio deixam a mensagem como está.
+func Compress(msg broker.Message, encoding string) (broker.Message, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "", "none":
+		return msg, nil
+	case EncodingGzip:
+		w = gzip.NewWriter(&buf)
+	case EncodingZstd:
+		// EncodeAll grava o tamanho do conteúdo no frame, que então declara
+		// uma janela do tamanho do corpo e passa pelo limite do decoder.
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return msg, err
+		}
+		defer enc.Close()
+		msg.Body = enc.EncodeAll(msg.Body, nil)
+		msg.ContentEncoding = encoding
+		return msg, nil
+	default:
+		return msg, fmt.Errorf("%w: %q (use %v)", ErrUnsupportedEncoding, encoding, Encodings)
+	}
+
+	if _, err := w.Write(msg.Body); err != nil {
+		return msg, err
+	}
+	if err := w.Close(); err != nil {
+		return msg, err
+	}
+	msg.Body = buf.Bytes()
+	msg.ContentEncoding = encoding
+	return msg, nil
+}
+
+// Decompress devolve a mensagem com o corpo descomprimido conforme o
+// ContentEncoding (gzip ou zstd), lendo no máximo limit bytes para se
+// proteger de bombas de descompressão (0 = sem limite). ContentEncoding
+// vazio, identity ou um tipo MIME, como o gerador publicava antes, não
+// comprimem nada.
+func Decompress(msg broker.Message, limit int) (broker.Message, error) {
+	encoding := strings.ToLower(strings.TrimSpace(msg.ContentEncoding))
+
+	var r io.Reader
+	switch {
+	case encoding == "" || encoding == "identity" || strings.Contains(encoding, "/"):
+		return msg, nil
+	case encoding == EncodingGzip || encoding == "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(msg.Body))
+		if err != nil {
+			return msg, fmt.Errorf("gzip inválido: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case encoding == EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(msg.Body), zstdDecoderOptions(limit)...)
+		if err != nil {
+			return msg, fmt.Errorf("zstd inválido: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return msg, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, msg.ContentEncoding)
+	}
+
+	if limit > 0 {
+		r = io.LimitReader(r, int64(limit)+1)
+	}
+	body, err := io.ReadAll(r)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return msg, fmt.Errorf("%w de %d bytes: %v", ErrDecompressedTooLarge, limit, err)
+	}
+	if err != nil {
+		return msg, fmt.Errorf("erro ao descomprimir %s: %w", encoding, err)
+	}
+	if limit > 0 && len(body) > limit {
+		return msg, fmt.Errorf("%w de %d bytes", ErrDecompressedTooLarge, limit)
+	}
+
+	msg.Body = body
+	msg.ContentEncoding = ""
+	return msg, nil
+}
+
+// zstdDecoderOptions limita a janela e a memória do decoder ao limite do
+// payload: um frame que declara uma janela maior que o corpo permitido é
+// recusado antes de o decoder alocá-la.
+func zstdDecoderOptions(limit int) []zstd.DOption {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if limit <= 0 {
+		return opts
+	}
+	window := uint64(limit)
+	if window < zstd.MinWindowSize {
+		window = zstd.MinWindowSize
+	}
+	if window > zstd.MaxWindowSize {
+		window = zstd.MaxWindowSize
+	}
+	return append(opts, zstd.WithDecoderMaxWindow(window), zstd.WithDecoderMaxMemory(window))
+}
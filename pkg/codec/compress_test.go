@@ -0,0 +1,84 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompress_RoundTrip(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"id":"m-1"}`), 100)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			msg, err := Compress(broker.Message{Body: body, ContentType: ContentTypeJSON}, encoding)
+			if err != nil {
+				t.Fatalf("Erro ao comprimir: %v", err)
+			}
+			if msg.ContentEncoding != encoding || len(msg.Body) >= len(body) {
+				t.Fatalf("Corpo deveria estar comprimido com %s: %d bytes (%q)", encoding, len(msg.Body), msg.ContentEncoding)
+			}
+
+			plain, err := Decompress(msg, len(body))
+			if err != nil {
+				t.Fatalf("Erro ao descomprimir: %v", err)
+			}
+			if !bytes.Equal(plain.Body, body) || plain.ContentEncoding != "" {
+				t.Errorf("Corpo descomprimido diferente do original")
+			}
+		})
+	}
+}
+
+func TestDecompress_RejectsBombs(t *testing.T) {
+	bomb := make([]byte, 10*1024*1024)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		msg, err := Compress(broker.Message{Body: bomb}, encoding)
+		if err != nil {
+			t.Fatalf("Erro ao comprimir: %v", err)
+		}
+		if _, err := Decompress(msg, 1024*1024); !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Errorf("%s: esperado ErrDecompressedTooLarge para %d bytes comprimidos, obtido %v", encoding, len(msg.Body), err)
+		}
+	}
+}
+
+func TestDecompress_ZstdWindowAboveLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf, zstd.WithWindowSize(8<<20), zstd.WithSingleSegment(false))
+	if err != nil {
+		t.Fatalf("Erro ao criar encoder: %v", err)
+	}
+	w.Write(bytes.Repeat([]byte("a"), 200*1024))
+	w.Close()
+
+	// A janela declarada (8 MiB) passa do limite, mesmo com o conteúdo cabendo nele.
+	msg := broker.Message{Body: buf.Bytes(), ContentEncoding: EncodingZstd}
+	if _, err := Decompress(msg, 1024*1024); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("Esperado ErrDecompressedTooLarge para janela acima do limite, obtido %v", err)
+	}
+	if plain, err := Decompress(msg, 0); err != nil || len(plain.Body) != 200*1024 {
+		t.Errorf("Sem limite o frame deveria ser aceito, obtido %d bytes (%v)", len(plain.Body), err)
+	}
+}
+
+func TestDecompress_Encodings(t *testing.T) {
+	legacy := broker.Message{Body: []byte(`{"id":"m-1"}`), ContentEncoding: "application/json"}
+	if msg, err := Decompress(legacy, 0); err != nil || string(msg.Body) != `{"id":"m-1"}` {
+		t.Errorf("ContentEncoding com tipo MIME deveria ser ignorado, obtido %q (%v)", msg.Body, err)
+	}
+
+	if _, err := Decompress(broker.Message{Body: []byte("x"), ContentEncoding: "br"}, 0); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Esperado ErrUnsupportedEncoding, obtido %v", err)
+	}
+	if _, err := Decompress(broker.Message{Body: []byte("não é gzip"), ContentEncoding: "gzip"}, 0); err == nil {
+		t.Error("gzip inválido deveria falhar")
+	}
+	if _, err := Compress(broker.Message{}, "lz4"); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Compressão desconhecida deveria falhar, obtido %v", err)
+	}
+}
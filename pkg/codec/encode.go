@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	eventcounter "github.com/Julia-Marcal/eventcounter/pkg"
+	"github.com/Julia-Marcal/eventcounter/pkg/broker"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encode monta corpo, ContentType e headers da mensagem no formato pedido.
+// Chave de roteamento e MessageID ficam a cargo de quem publica.
+func Encode(format string, m eventcounter.Message) (broker.Message, error) {
+	switch format {
+	case FormatJSON:
+		body, err := json.Marshal(dataFields(m))
+		return broker.Message{Body: body, ContentType: ContentTypeJSON}, err
+
+	case FormatMsgPack:
+		body, err := msgpack.Marshal(messageFields(m))
+		return broker.Message{Body: body, ContentType: ContentTypeMsgPack}, err
+
+	case FormatProtobuf:
+		body, err := m.MarshalProto()
+		return broker.Message{Body: body, ContentType: ContentTypeProtobuf}, err
+
+	case FormatCloudEventsBinary:
+		body, err := json.Marshal(dataFields(m))
+		return broker.Message{
+			Body:        body,
+			ContentType: ContentTypeJSON,
+			Headers: map[string]interface{}{
+				CloudEventsHeaderPrefix + "specversion": CloudEventsSpecVersion,
+				CloudEventsHeaderPrefix + "id":          m.UID,
+				CloudEventsHeaderPrefix + "source":      CloudEventsSource,
+				CloudEventsHeaderPrefix + "type":        CloudEventsTypePrefix + string(m.EventType),
+				CloudEventsHeaderPrefix + "subject":     m.UserID,
+			},
+		}, err
+
+	case FormatCloudEventsStructured:
+		data, err := json.Marshal(dataFields(m))
+		if err != nil {
+			return broker.Message{}, err
+		}
+		body, err := json.Marshal(cloudEvent{
+			SpecVersion:     CloudEventsSpecVersion,
+			ID:              m.UID,
+			Source:          CloudEventsSource,
+			Type:            CloudEventsTypePrefix + string(m.EventType),
+			Subject:         m.UserID,
+			DataContentType: ContentTypeJSON,
+			Data:            data,
+		})
+		return broker.Message{Body: body, ContentType: ContentTypeCloudEvents}, err
+	}
+	return broker.Message{}, fmt.Errorf("formato desconhecido: %q (use %v)", format, Formats)
+}
+
+// dataFields é o payload JSON, em que usuário e tipo ficam na chave de
+// roteamento (ou nos atributos CloudEvents): só id e o valor, se houver.
+func dataFields(m eventcounter.Message) Fields {
+	fields := Fields{"id": m.UID}
+	if m.Value != nil {
+		fields["value"] = *m.Value
+	}
+	return fields
+}
@@ -3,11 +3,45 @@ package logger
 import (
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
 )
 
+type Level int32
+
+const (
+	LevelInfo Level = iota
+	LevelWarning
+	LevelError
+)
+
+var level atomic.Int32
+
+// ParseLevel aceita info, warning ou error.
+func ParseLevel(name string) (Level, error) {
+	switch name {
+	case "info":
+		return LevelInfo, nil
+	case "warning":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("nível de log desconhecido: %q (use info, warning ou error)", name)
+}
+
+// SetLevel descarta as mensagens abaixo do nível; pode ser chamado com o
+// serviço rodando. Fatal sempre é impresso.
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+func enabled(l Level) bool {
+	return Level(level.Load()) <= l
+}
+
 var (
 	InfoColor    = color.New(color.FgCyan)
 	SuccessColor = color.New(color.FgGreen)
@@ -18,36 +52,54 @@ var (
 )
 
 func Info(format string, v ...interface{}) {
+	if !enabled(LevelInfo) {
+		return
+	}
 	timestamp := time.Now().Format("15:04:05")
 	message := fmt.Sprintf(format, v...)
 	InfoColor.Printf("[%s] [INFO] %s\n", timestamp, message)
 }
 
 func Success(format string, v ...interface{}) {
+	if !enabled(LevelInfo) {
+		return
+	}
 	timestamp := time.Now().Format("15:04:05")
 	message := fmt.Sprintf(format, v...)
 	SuccessColor.Printf("[%s] [SUCESSO] %s\n", timestamp, message)
 }
 
 func Warning(format string, v ...interface{}) {
+	if !enabled(LevelWarning) {
+		return
+	}
 	timestamp := time.Now().Format("15:04:05")
 	message := fmt.Sprintf(format, v...)
 	WarningColor.Printf("[%s] [AVISO] %s\n", timestamp, message)
 }
 
 func Error(format string, v ...interface{}) {
+	if !enabled(LevelError) {
+		return
+	}
 	timestamp := time.Now().Format("15:04:05")
 	message := fmt.Sprintf(format, v...)
 	ErrorColor.Printf("[%s] [ERRO] %s\n", timestamp, message)
 }
 
 func Process(format string, v ...interface{}) {
+	if !enabled(LevelInfo) {
+		return
+	}
 	timestamp := time.Now().Format("15:04:05")
 	message := fmt.Sprintf(format, v...)
 	ProcessColor.Printf("[%s] [PROCESSO] %s\n", timestamp, message)
 }
 
 func System(format string, v ...interface{}) {
+	if !enabled(LevelInfo) {
+		return
+	}
 	timestamp := time.Now().Format("15:04:05")
 	message := fmt.Sprintf(format, v...)
 	SystemColor.Printf("[%s] [SISTEMA] %s\n", timestamp, message)
@@ -12,4 +12,7 @@ type Message struct {
 	UID       string    `json:"uid"`
 	EventType EventType `json:"event_type"`
 	UserID    string    `json:"user_id"`
+	// Value é o valor numérico opcional do evento (bytes, valor), agregado
+	// quando o tipo tem agregações configuradas no consumidor.
+	Value *float64 `json:"value,omitempty"`
 }
@@ -0,0 +1,39 @@
+package eventcounter
+
+import (
+	"fmt"
+
+	"github.com/Julia-Marcal/eventcounter/pkg/eventpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// MarshalProto codifica a mensagem no formato de message.proto, usando o
+// código gerado em pkg/eventpb.
+func (m *Message) MarshalProto() ([]byte, error) {
+	b, err := proto.Marshal(&eventpb.Message{
+		Uid:       m.UID,
+		EventType: string(m.EventType),
+		UserId:    m.UserID,
+		Value:     m.Value,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("falha ao codificar protobuf: %w", err)
+	}
+	return b, nil
+}
+
+// UnmarshalProto decodifica o formato de message.proto; campos
+// desconhecidos são ignorados, como no proto3.
+func (m *Message) UnmarshalProto(b []byte) error {
+	var pb eventpb.Message
+	if err := proto.Unmarshal(b, &pb); err != nil {
+		return fmt.Errorf("protobuf inválido: %w", err)
+	}
+	*m = Message{
+		UID:       pb.GetUid(),
+		EventType: EventType(pb.GetEventType()),
+		UserID:    pb.GetUserId(),
+		Value:     pb.Value,
+	}
+	return nil
+}
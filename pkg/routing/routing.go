@@ -0,0 +1,143 @@
+// Package routing descreve as chaves de roteamento dos eventos, comum ao
+// gerador, que as monta, e ao consumidor, que as interpreta.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultPattern aceita user IDs com pontos: {nome+} casa uma ou mais
+// palavras, {nome} exatamente uma.
+const DefaultPattern = "{user+}.event.{type}"
+
+var (
+	ErrEmptyKey    = errors.New("chave de roteamento vazia")
+	ErrKeyMismatch = errors.New("chave de roteamento não corresponde ao padrão")
+)
+
+type KeyError struct {
+	Key     string
+	Pattern string
+	Err     error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("chave de roteamento %q inválida para o padrão %q: %v", e.Key, e.Pattern, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+type Schema struct {
+	pattern string
+	re      *regexp.Regexp
+	fields  []string
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)(\+?)\}`)
+
+// NewSchema compila um padrão como "{tenant}.{user}.event.{type}". Os campos
+// user e type são obrigatórios; os demais são repassados ao consumidor como
+// atributos do evento.
+func NewSchema(pattern string) (*Schema, error) {
+	var expr strings.Builder
+	var fields []string
+	seen := make(map[string]bool)
+
+	expr.WriteString("^")
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:m[0]]))
+
+		name := pattern[m[2]:m[3]]
+		if seen[name] {
+			return nil, fmt.Errorf("campo %q repetido no padrão %q", name, pattern)
+		}
+		seen[name] = true
+		fields = append(fields, name)
+
+		if m[5] > m[4] {
+			fmt.Fprintf(&expr, "(?P<%s>.+)", name)
+		} else {
+			fmt.Fprintf(&expr, "(?P<%s>[^.]+)", name)
+		}
+		last = m[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	for _, required := range []string{"user", "type"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("padrão %q sem o campo obrigatório {%s}", pattern, required)
+		}
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("padrão %q inválido: %w", pattern, err)
+	}
+
+	return &Schema{pattern: pattern, re: re, fields: fields}, nil
+}
+
+// MustSchema compila um padrão embutido no código, como DefaultPattern, e
+// entra em pânico se ele for inválido.
+func MustSchema(pattern string) *Schema {
+	schema, err := NewSchema(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func (s *Schema) Pattern() string {
+	return s.pattern
+}
+
+// Fields devolve os campos do padrão, na ordem em que aparecem.
+func (s *Schema) Fields() []string {
+	return s.fields
+}
+
+// Format monta a chave de roteamento com os valores dos campos, para
+// origens que não têm chave própria (Kafka e replay). Campos ausentes ficam
+// vazios, e a chave resultante é recusada por Parse.
+func (s *Schema) Format(fields map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(s.pattern, func(m string) string {
+		return fields[placeholder.FindStringSubmatch(m)[1]]
+	})
+}
+
+// Binding devolve o binding de topic exchange que casa com as chaves do
+// padrão: {nome} vira "*" e {nome+} vira "#".
+func (s *Schema) Binding() string {
+	return placeholder.ReplaceAllStringFunc(s.pattern, func(m string) string {
+		if placeholder.FindStringSubmatch(m)[2] != "" {
+			return "#"
+		}
+		return "*"
+	})
+}
+
+func (s *Schema) Parse(routing_key string) (map[string]string, error) {
+	if routing_key == "" {
+		return nil, &KeyError{Key: routing_key, Pattern: s.pattern, Err: ErrEmptyKey}
+	}
+
+	match := s.re.FindStringSubmatch(routing_key)
+	if match == nil {
+		return nil, &KeyError{Key: routing_key, Pattern: s.pattern, Err: ErrKeyMismatch}
+	}
+
+	fields := make(map[string]string, len(s.fields))
+	for i, name := range s.re.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,67 @@
+package routing
+
+import (
+	"errors"
+	"testing"
+)
+
+// =============================================================================
+// TESTES DE PADRÃO DE CHAVE DE ROTEAMENTO
+// =============================================================================
+
+func TestSchema_FormatRoundTrips(t *testing.T) {
+	schema, err := NewSchema("{tenant}.{user+}.event.{type}")
+	if err != nil {
+		t.Fatalf("Erro ao compilar padrão: %v", err)
+	}
+
+	key := schema.Format(map[string]string{"tenant": "acme", "user": "user.a", "type": "created"})
+	if key != "acme.user.a.event.created" {
+		t.Fatalf("Chave montada incorretamente: %s", key)
+	}
+	fields, err := schema.Parse(key)
+	if err != nil || fields["tenant"] != "acme" || fields["user"] != "user.a" || fields["type"] != "created" {
+		t.Errorf("Chave montada não volta aos mesmos campos: %v, %v", fields, err)
+	}
+
+	if _, err := schema.Parse(schema.Format(map[string]string{"user": "user_a", "type": "created"})); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Chave sem tenant deveria ser recusada, obtido %v", err)
+	}
+}
+
+func TestNewSchema_InvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"{user}.event", "{user}.{user}.{type}", "event.{type}"} {
+		if _, err := NewSchema(pattern); err == nil {
+			t.Errorf("Esperado erro para o padrão %q", pattern)
+		}
+	}
+}
+
+func TestMustSchema_PanicsOnInvalidPattern(t *testing.T) {
+	if schema := MustSchema(DefaultPattern); schema.Pattern() != DefaultPattern {
+		t.Errorf("Esperado o padrão %q, obtido %q", DefaultPattern, schema.Pattern())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustSchema deveria entrar em pânico com um padrão inválido")
+		}
+	}()
+	MustSchema("event.{type}")
+}
+
+func TestSchema_Binding(t *testing.T) {
+	for pattern, want := range map[string]string{
+		DefaultPattern:                 "#.event.*",
+		"{tenant}.{user}.event.{type}": "*.*.event.*",
+		"{type}.{user+}":               "*.#",
+	} {
+		schema, err := NewSchema(pattern)
+		if err != nil {
+			t.Fatalf("Erro ao compilar %q: %v", pattern, err)
+		}
+		if got := schema.Binding(); got != want {
+			t.Errorf("Binding de %q: esperado %q, obtido %q", pattern, want, got)
+		}
+	}
+}
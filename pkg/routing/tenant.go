@@ -0,0 +1,17 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidTenant garante que o nome possa virar um diretório de resultados sem
+// escapar da raiz. O tenant vazio é o padrão.
+func ValidTenant(tenant string) error {
+	if tenant == "" || tenantNamePattern.MatchString(tenant) {
+		return nil
+	}
+	return fmt.Errorf("tenant inválido: %q", tenant)
+}
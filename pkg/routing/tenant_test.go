@@ -0,0 +1,20 @@
+package routing
+
+import "testing"
+
+// =============================================================================
+// TESTES DE NOME DE TENANT
+// =============================================================================
+
+func TestValidTenant(t *testing.T) {
+	for _, tenant := range []string{"", "acme", "tenant_1", "a-b"} {
+		if err := ValidTenant(tenant); err != nil {
+			t.Errorf("Tenant %q deveria ser válido: %v", tenant, err)
+		}
+	}
+	for _, tenant := range []string{"..", "a/b", "-acme", "a b"} {
+		if err := ValidTenant(tenant); err == nil {
+			t.Errorf("Tenant %q deveria ser inválido", tenant)
+		}
+	}
+}